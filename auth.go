@@ -0,0 +1,121 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/emil2k/go-aes/mac"
+)
+
+// errAuthentication is returned when the tag of an authenticated input does not verify.
+var errAuthentication = errors.New("input authentication failed, it was modified or the cipher key is wrong")
+
+// parseAuth returns the identifier of the named message authentication code, none for an empty name.
+func parseAuth(name string) (byte, error) {
+	switch name {
+	case "":
+		return noAuth, nil
+	case "hmac":
+		return hmacAuth, nil
+	case "cmac":
+		return cmacAuth, nil
+	default:
+		return 0, fmt.Errorf("unknown authentication %q chosen", name)
+	}
+}
+
+// authKeyLength returns the length in bytes of the key of the message authentication code of the
+// header, which follows the cipher key in the key file.
+func authKeyLength(h *header) int {
+	switch h.auth {
+	case hmacAuth:
+		return sha256.Size
+	case cmacAuth:
+		return int(h.keySize / 8)
+	default:
+		return 0
+	}
+}
+
+// splitKey splits the key into the cipher key and the key of the message authentication code.
+func splitKey(h *header, key []byte) (ck []byte, mk []byte) {
+	n := len(key) - authKeyLength(h)
+	return key[:n], key[n:]
+}
+
+// newAuthMAC returns the message authentication code of the header keyed by the passed key, with
+// the header written to it. Returns nil if the header is not authenticated.
+func newAuthMAC(h *header, mk []byte) (hash.Hash, error) {
+	var m hash.Hash
+	switch h.auth {
+	case hmacAuth:
+		m = hmac.New(sha256.New, mk)
+	case cmacAuth:
+		cf, err := getCipherFactory()
+		if err != nil {
+			return nil, err
+		}
+		if m, err = mac.NewCMAC(cf, mk); err != nil {
+			return nil, err
+		}
+	default:
+		return nil, nil
+	}
+	m.Write(h.bytes())
+	return m, nil
+}
+
+// hashOutput writes the cipher text of the output file, which follows the header, to the message
+// authentication code. Leaves the file at its end, ready for the tag to be appended.
+func hashOutput(f *os.File, h *header, m hash.Hash) error {
+	if _, err := f.Seek(int64(h.size()), 0); err != nil {
+		return err
+	}
+	_, err := io.Copy(m, f)
+	return err
+}
+
+// authenticate verifies the tag that follows the cipher text of the input, positioned after the
+// header, before anything is decrypted. Returns a reader of the cipher text and its size in bytes,
+// without the tag, or errAuthentication if the tag does not verify.
+// Input that can not be seeked is buffered in memory, otherwise the size of the cipher text must be
+// passed and the input is read twice.
+func authenticate(f *os.File, h *header, m hash.Hash, size uint64) (io.Reader, uint64, error) {
+	ts := uint64(m.Size())
+	if isStream() {
+		data, err := ioutil.ReadAll(f)
+		if err != nil {
+			return nil, 0, err
+		}
+		if uint64(len(data)) < ts {
+			return nil, 0, errAuthentication
+		}
+		ct, tag := data[:uint64(len(data))-ts], data[uint64(len(data))-ts:]
+		m.Write(ct)
+		if !mac.Equal(m.Sum(nil), tag) {
+			return nil, 0, errAuthentication
+		}
+		return bytes.NewReader(ct), uint64(len(ct)), nil
+	}
+	if size < ts {
+		return nil, 0, errAuthentication
+	}
+	if _, err := io.CopyN(m, f, int64(size-ts)); err != nil {
+		return nil, 0, err
+	}
+	tag := make([]byte, ts)
+	if _, err := io.ReadFull(f, tag); err != nil {
+		return nil, 0, err
+	}
+	if !mac.Equal(m.Sum(nil), tag) {
+		return nil, 0, errAuthentication
+	}
+	return f, size - ts, nil
+}
@@ -0,0 +1,61 @@
+package cipher
+
+import (
+	"github.com/emil2k/go-aes/state"
+)
+
+const BlockSize int = 16 // size of a cipher block in bytes
+
+// Block is a block cipher bound to a cipher key, it implements the crypto/cipher.Block interface
+// so it can be used with the standard library's block cipher modes.
+// Safe for concurrent use, each operation runs on its own copy of an expanded Cipher.
+type Block struct {
+	ck     []byte        // cipher key
+	size   CipherKeySize // cipher key size in bits
+	cipher *Cipher       // cipher with the expanded cipher key
+}
+
+// NewBlock creates a new block from the cipher key, the cipher key size is determined from
+// the length of the key. Returns ErrKeySize if the key is not 16, 24, or 32 bytes.
+func NewBlock(ck []byte) (*Block, error) {
+	size := CipherKeySize(len(ck) * 8)
+	c, err := NewCipher(size, TableEngine)
+	if err != nil {
+		return nil, err
+	}
+	k := make([]byte, len(ck))
+	copy(k, ck)
+	if err := c.Expand(k); err != nil {
+		return nil, err
+	}
+	return &Block{ck: k, size: size, cipher: c}, nil
+}
+
+// BlockSize returns the cipher's block size in bytes.
+func (b *Block) BlockSize() int {
+	return BlockSize
+}
+
+// Encrypt encrypts the first block in src into dst, dst and src may overlap.
+func (b *Block) Encrypt(dst, src []byte) {
+	checkBlocks(dst, src)
+	out := b.cipher.Copy().Encrypt(*state.NewStateFromBytes(src), b.ck)
+	copy(dst, out.GetBytes())
+}
+
+// Decrypt decrypts the first block in src into dst, dst and src may overlap.
+func (b *Block) Decrypt(dst, src []byte) {
+	checkBlocks(dst, src)
+	out := b.cipher.Copy().Decrypt(*state.NewStateFromBytes(src), b.ck)
+	copy(dst, out.GetBytes())
+}
+
+// checkBlocks panics if either the destination or source is shorter than a block.
+func checkBlocks(dst, src []byte) {
+	if len(src) < BlockSize {
+		panic("cipher : input not full block")
+	}
+	if len(dst) < BlockSize {
+		panic("cipher : output not full block")
+	}
+}
@@ -0,0 +1,90 @@
+package cipher
+
+import (
+	"bytes"
+	"crypto/aes"
+	gocipher "crypto/cipher"
+	"encoding/hex"
+	"testing"
+
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+var _ gocipher.Block = (*Block)(nil) // must implement the standard library interface
+
+func TestNewBlock(t *testing.T) {
+	for _, n := range []int{16, 24, 32} {
+		if b, err := NewBlock(rand.GetRand(n)); err != nil {
+			t.Errorf("New block failed for %d byte key with error : %s", n, err.Error())
+		} else if b.size != CipherKeySize(n*8) {
+			t.Errorf("New block failed for %d byte key, wrong key size %d", n, b.size)
+		}
+	}
+	if _, err := NewBlock(rand.GetRand(20)); err != ErrKeySize {
+		t.Errorf("New block with invalid key size should fail")
+	}
+}
+
+func TestBlockSize(t *testing.T) {
+	b, _ := NewBlock(rand.GetRand(16))
+	if b.BlockSize() != 16 {
+		t.Errorf("Block size failed with %d", b.BlockSize())
+	}
+}
+
+func TestBlockEncrypt(t *testing.T) {
+	ck := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f} // cipher key
+	in := []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	out := []byte{0x69, 0xc4, 0xe0, 0xd8, 0x6a, 0x7b, 0x04, 0x30, 0xd8, 0xcd, 0xb7, 0x80, 0x70, 0xb4, 0xc5, 0x5a}
+	b, _ := NewBlock(ck)
+	dst := make([]byte, 16)
+	if b.Encrypt(dst, in); !bytes.Equal(dst, out) {
+		t.Errorf("Block encrypt failed with %s", hex.EncodeToString(dst))
+	}
+	if b.Decrypt(dst, dst); !bytes.Equal(dst, in) { // in place
+		t.Errorf("Block decrypt failed with %s", hex.EncodeToString(dst))
+	}
+}
+
+// TestBlockStandardLibrary compares the block against the standard library's AES implementation.
+func TestBlockStandardLibrary(t *testing.T) {
+	for _, n := range []int{16, 24, 32} {
+		ck, in := rand.GetRand(n), rand.GetRand(16)
+		b, _ := NewBlock(ck)
+		sb, _ := aes.NewCipher(ck)
+		x, expected := make([]byte, 16), make([]byte, 16)
+		b.Encrypt(x, in)
+		sb.Encrypt(expected, in)
+		if !bytes.Equal(x, expected) {
+			t.Errorf("Block encrypt with %d byte key failed with %s, expected %s", n, hex.EncodeToString(x), hex.EncodeToString(expected))
+		}
+		b.Decrypt(x, in)
+		sb.Decrypt(expected, in)
+		if !bytes.Equal(x, expected) {
+			t.Errorf("Block decrypt with %d byte key failed with %s, expected %s", n, hex.EncodeToString(x), hex.EncodeToString(expected))
+		}
+	}
+}
+
+// TestBlockStandardMode runs the block through the standard library's CBC mode.
+func TestBlockStandardMode(t *testing.T) {
+	ck, iv, in := rand.GetRand(16), rand.GetRand(16), rand.GetRand(64)
+	b, _ := NewBlock(ck)
+	sb, _ := aes.NewCipher(ck)
+	x, expected := make([]byte, len(in)), make([]byte, len(in))
+	gocipher.NewCBCEncrypter(b, iv).CryptBlocks(x, in)
+	gocipher.NewCBCEncrypter(sb, iv).CryptBlocks(expected, in)
+	if !bytes.Equal(x, expected) {
+		t.Errorf("Block in standard CBC mode failed with %s, expected %s", hex.EncodeToString(x), hex.EncodeToString(expected))
+	}
+}
+
+func TestBlockShortPanic(t *testing.T) {
+	defer func() {
+		if r := recover(); r != "cipher : input not full block" {
+			t.Errorf("Short block panic failed")
+		}
+	}()
+	b, _ := NewBlock(rand.GetRand(16))
+	b.Encrypt(make([]byte, 16), make([]byte, 8))
+}
@@ -1,6 +1,7 @@
 package cipher
 
 import (
+	"errors"
 	"io/ioutil"
 	"log"
 
@@ -16,24 +17,45 @@ const (
 	CK256 CipherKeySize = 256
 )
 
+// Engine selects the implementation used to run the rounds of the cipher. Key expansion is the same
+// for every engine and substitutes through the S-box lookup table, so it is not constant time.
+type Engine int
+
+const (
+	StepEngine      Engine = iota // runs each step of a round separately, logging each round, for teaching and debugging
+	TableEngine                   // fuses the steps of a round through precomputed tables, for throughput
+	BitslicedEngine               // runs the rounds on bit planes with only boolean operations, in constant time, not key expansion
+)
+
+// ErrKeySize is returned when a cipher key is not 128, 192, or 256 bits, or does not match the
+// cipher key size of the cipher.
+var ErrKeySize = key.ErrKeySize
+
+// ErrEngine is returned when an unknown engine is selected.
+var ErrEngine = errors.New("cipher : unknown engine")
+
 // CipherFactory is a function that creates a new Cipher instance
-type CipherFactory func() *Cipher
+type CipherFactory func() (*Cipher, error)
 
 // Cipher keeps the state of encyption or decryption
 type Cipher struct {
-	key       *key.Key     // keeps the state of the key as it is expanded
-	state     *state.State // keeps the current state of encryption
-	nk        int          // the number of bytes in the cipher key
-	nr        int          // the number of rounds of encyption
-	r         int          // keeps track of the current round
-	isDecrypt bool         // whether decrypting, affects round key iteration
-	ErrorLog  *log.Logger  // log for errors
-	InfoLog   *log.Logger  // log for regular progress information, non-verbose
-	DebugLog  *log.Logger  // log for debug information, verbose
-}
-
-// NewCipher constructs a new cipher loading the initial state with the input
-func NewCipher(ck CipherKeySize) *Cipher {
+	schedule  *key.Schedule     // expanded round keys, immutable and shared between copies
+	state     *state.State      // keeps the current state of encryption
+	nk        int               // the number of bytes in the cipher key
+	nr        int               // the number of rounds of encyption
+	r         int               // keeps track of the current round
+	isDecrypt bool              // whether decrypting, affects round key iteration
+	engine    Engine            // implementation used to run the rounds
+	encPlanes []state.Bitsliced // bitsliced encryption round keys, for the bitsliced engine
+	decPlanes []state.Bitsliced // bitsliced decryption round keys, for the bitsliced engine
+	ErrorLog  *log.Logger       // log for errors
+	InfoLog   *log.Logger       // log for regular progress information, non-verbose
+	DebugLog  *log.Logger       // log for debug information, verbose
+}
+
+// NewCipher constructs a new cipher for the cipher key size, running the rounds with the passed engine.
+// Returns ErrKeySize for an invalid cipher key size or ErrEngine for an unknown engine.
+func NewCipher(ck CipherKeySize, e Engine) (*Cipher, error) {
 	var nk, nr int
 	switch ck {
 	case CK128:
@@ -43,29 +65,100 @@ func NewCipher(ck CipherKeySize) *Cipher {
 	case CK256:
 		nk, nr = 8, 14
 	default:
-		panic("invalid cipher key size selected")
+		return nil, ErrKeySize
+	}
+	switch e {
+	case StepEngine, TableEngine, BitslicedEngine:
+	default:
+		return nil, ErrEngine
 	}
 	return &Cipher{
 		nk:       nk,
 		nr:       nr,
+		engine:   e,
 		ErrorLog: log.New(ioutil.Discard, "", 0),
 		InfoLog:  log.New(ioutil.Discard, "", 0),
 		DebugLog: log.New(ioutil.Discard, "", 0),
+	}, nil
+}
+
+// Copy returns a new cipher with the same configuration, sharing the round key schedule.
+// Used to run the cipher on separate goroutines without expanding the cipher key again.
+func (c *Cipher) Copy() *Cipher {
+	n := *c
+	n.state = nil
+	return &n
+}
+
+// Expand expands the cipher key into the round key schedule, unless the schedule was already
+// expanded from the same cipher key. Returns ErrKeySize if the cipher key does not match the
+// cipher key size of the cipher.
+func (c *Cipher) Expand(ck []byte) error {
+	if c.schedule == nil || !c.schedule.Matches(ck) {
+		ks, err := key.NewSchedule(c.nk, ck)
+		if err != nil {
+			return err
+		}
+		c.schedule = ks
+		c.encPlanes, c.decPlanes = nil, nil
+		c.DebugLog.Println("expanded cipher key")
 	}
+	if c.engine == BitslicedEngine && c.encPlanes == nil {
+		c.slicePlanes()
+	}
+	return nil
 }
 
-// initCipher initializes the cipher either for encryption or decryption
+// slicePlanes transposes the round keys into bit planes, repeating each round key for every
+// state processed in parallel.
+func (c *Cipher) slicePlanes() {
+	c.encPlanes = make([]state.Bitsliced, c.nr+1)
+	c.decPlanes = make([]state.Bitsliced, c.nr+1)
+	rks := make([]state.State, state.NBitslicedStates)
+	for r := 0; r <= c.nr; r++ {
+		for i := range rks {
+			rks[i] = c.schedule.RoundKey(r)
+		}
+		c.encPlanes[r] = state.NewBitsliced(rks)
+		for i := range rks {
+			rks[i] = c.schedule.InvRoundKey(r)
+		}
+		c.decPlanes[r] = state.NewBitsliced(rks)
+	}
+}
+
+// initCipher initializes the cipher either for encryption or decryption.
+// Panics if the cipher key is invalid, check it beforehand with Expand.
 func (c *Cipher) initCipher(in state.State, ck []byte, isDecrypt bool) {
 	c.state = &in
 	c.InfoLog.Println(c.state, "input")
-	c.key = key.NewKey(c.nk, ck)
+	if err := c.Expand(ck); err != nil {
+		panic(err)
+	}
 	c.r = 0
 	c.isDecrypt = isDecrypt
 }
 
-// Encrypt configures a cipher and runs an encryption on the input
+// Encrypt configures a cipher and runs an encryption on the input.
+// Panics if the cipher key is invalid, check it beforehand with Expand.
 func (c *Cipher) Encrypt(in state.State, ck []byte) state.State {
 	c.initCipher(in, ck, false)
+	switch c.engine {
+	case TableEngine:
+		c.encryptTable()
+	case BitslicedEngine:
+		states := []state.State{*c.state}
+		c.encryptBitsliced(states)
+		*c.state = states[0]
+	default:
+		c.encryptStep()
+	}
+	c.InfoLog.Println(c.state, "encrypted")
+	return *c.state
+}
+
+// encryptStep runs the encryption rounds one step at a time.
+func (c *Cipher) encryptStep() {
 	c.AddRoundKey()
 	for c.r <= c.nr {
 		c.state.Sub()
@@ -74,25 +167,147 @@ func (c *Cipher) Encrypt(in state.State, ck []byte) state.State {
 			c.state.Mix()
 		}
 		c.AddRoundKey()
+		c.DebugLog.Println(c.state, "after round", c.r-1)
 	}
-	c.InfoLog.Println(c.state, "encrypted")
-	return *c.state
 }
 
-// Decrypt configures the cipher and runs a decryption on the cipher text
+// encryptTable runs the encryption rounds through the round tables.
+func (c *Cipher) encryptTable() {
+	c.AddRoundKey()
+	for ; c.r < c.nr; c.r++ {
+		c.state.Round(c.schedule.RoundKey(c.r))
+	}
+	c.state.FinalRound(c.schedule.RoundKey(c.r))
+	c.r++
+}
+
+// encryptBitsliced runs the encryption rounds on up to NBitslicedStates states in parallel, in place.
+func (c *Cipher) encryptBitsliced(states []state.State) {
+	b := state.NewBitsliced(states)
+	b.Xor(c.encPlanes[0])
+	for r := 1; r < c.nr; r++ {
+		b.Sub()
+		b.Shift()
+		b.Mix()
+		b.Xor(c.encPlanes[r])
+	}
+	b.Sub()
+	b.Shift()
+	b.Xor(c.encPlanes[c.nr])
+	b.States(states)
+}
+
+// EncryptBlocks encrypts each of the input blocks, returning the cipher text blocks.
+// Panics if the cipher key is invalid, check it beforehand with Expand.
+// The bitsliced engine processes NBitslicedStates blocks at a time in parallel, the other
+// engines one block at a time.
+func (c *Cipher) EncryptBlocks(in []state.State, ck []byte) []state.State {
+	out := make([]state.State, len(in))
+	if c.engine != BitslicedEngine {
+		for i, s := range in {
+			out[i] = c.Encrypt(s, ck)
+		}
+		return out
+	}
+	if err := c.Expand(ck); err != nil {
+		panic(err)
+	}
+	copy(out, in)
+	for i := 0; i < len(out); i += state.NBitslicedStates {
+		end := i + state.NBitslicedStates
+		if end > len(out) {
+			end = len(out)
+		}
+		c.encryptBitsliced(out[i:end])
+	}
+	return out
+}
+
+// Decrypt configures the cipher and runs a decryption on the cipher text.
+// Panics if the cipher key is invalid, check it beforehand with Expand.
+// Uses the equivalent inverse cipher, which has the same sequence of steps as encryption
+// with the round keys of the inverse mix.
 func (c *Cipher) Decrypt(in state.State, ck []byte) state.State {
 	c.initCipher(in, ck, true)
+	switch c.engine {
+	case TableEngine:
+		c.decryptTable()
+	case BitslicedEngine:
+		states := []state.State{*c.state}
+		c.decryptBitsliced(states)
+		*c.state = states[0]
+	default:
+		c.decryptStep()
+	}
+	c.InfoLog.Println(c.state, "decrypted")
+	return *c.state
+}
+
+// decryptStep runs the decryption rounds one step at a time.
+func (c *Cipher) decryptStep() {
 	c.AddRoundKey()
 	for c.r <= c.nr {
-		if c.r != 1 { // don't inverse mix on first round
+		c.state.InvSub()
+		c.state.InvShift()
+		if c.r%c.nr != 0 { // no inverse mix on last round
 			c.state.InvMix()
 		}
-		c.state.InvShift()
-		c.state.InvSub()
 		c.AddRoundKey()
+		c.DebugLog.Println(c.state, "after inverse round", c.r-1)
 	}
-	c.InfoLog.Println(c.state, "decrypted")
-	return *c.state
+}
+
+// decryptTable runs the decryption rounds through the inverse round tables.
+func (c *Cipher) decryptTable() {
+	c.AddRoundKey()
+	for ; c.r < c.nr; c.r++ {
+		c.state.InvRound(c.schedule.InvRoundKey(c.r))
+	}
+	c.state.InvFinalRound(c.schedule.InvRoundKey(c.r))
+	c.r++
+}
+
+// decryptBitsliced runs the equivalent inverse cipher rounds on up to NBitslicedStates states in
+// parallel, in place.
+func (c *Cipher) decryptBitsliced(states []state.State) {
+	b := state.NewBitsliced(states)
+	b.Xor(c.decPlanes[0])
+	for r := 1; r < c.nr; r++ {
+		b.InvSub()
+		b.InvShift()
+		b.InvMix()
+		b.Xor(c.decPlanes[r])
+	}
+	b.InvSub()
+	b.InvShift()
+	b.Xor(c.decPlanes[c.nr])
+	b.States(states)
+}
+
+// DecryptBlocks decrypts each of the input blocks, returning the plaintext blocks.
+// Panics if the cipher key is invalid, check it beforehand with Expand.
+// The bitsliced engine processes NBitslicedStates blocks at a time in parallel, the other
+// engines one block at a time.
+func (c *Cipher) DecryptBlocks(in []state.State, ck []byte) []state.State {
+	out := make([]state.State, len(in))
+	if c.engine != BitslicedEngine {
+		for i, s := range in {
+			out[i] = c.Decrypt(s, ck)
+		}
+		return out
+	}
+	if err := c.Expand(ck); err != nil {
+		panic(err)
+	}
+	copy(out, in)
+	for i := 0; i < len(out); i += state.NBitslicedStates {
+		end := i + state.NBitslicedStates
+		if end > len(out) {
+			end = len(out)
+		}
+		c.decryptBitsliced(out[i:end])
+	}
+	return out
 }
 
 // String provides a string representation of the currest cipher state
@@ -102,21 +317,24 @@ func (c Cipher) String() string {
 
 // AddRoundKey xors the current round key to the cipher's state
 func (c *Cipher) AddRoundKey() {
-	var i int
+	var rk *state.State
 	if c.isDecrypt {
-		i = c.nr - c.r // reverse iteration
+		rk = c.GetInvRoundKey(c.r)
 	} else {
-		i = c.r
+		rk = c.GetRoundKey(c.r)
 	}
-	rk := c.GetRoundKey(i)
 	c.state.Xor(*rk)
 	c.r++ // iterate round
 }
 
-// GetRoundKey gets the ith round key as a state instance, expands the key if necessary.
+// GetRoundKey gets the ith round key as a state instance from the expanded round key schedule.
 func (c *Cipher) GetRoundKey(i int) *state.State {
-	for c.key.NWords() < (i+1)*4 { // need to expand the key, 4 word per state
-		c.key.Expand()
-	}
-	return state.NewStateFromWords(c.key.GetWordSlice(i*4, (i+1)*4))
+	rk := c.schedule.RoundKey(i)
+	return &rk
+}
+
+// GetInvRoundKey gets the round key for the ith round of the equivalent inverse cipher.
+func (c *Cipher) GetInvRoundKey(i int) *state.State {
+	rk := c.schedule.InvRoundKey(i)
+	return &rk
 }
@@ -0,0 +1,93 @@
+package cipher
+
+import (
+	"testing"
+
+	"github.com/emil2k/go-aes/state"
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+func BenchmarkEncrypt(b *testing.B) {
+	c, _ := NewCipher(CK128, StepEngine)
+	ck := rand.GetRand(16)
+	in := *state.NewStateFromBytes(rand.GetRand(16))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Encrypt(in, ck)
+	}
+}
+
+func BenchmarkDecrypt(b *testing.B) {
+	c, _ := NewCipher(CK128, StepEngine)
+	ck := rand.GetRand(16)
+	in := *state.NewStateFromBytes(rand.GetRand(16))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Decrypt(in, ck)
+	}
+}
+
+// BenchmarkEncryptCopy benchmarks encrypting with a copy of an expanded cipher, as done by
+// the counter mode for every block.
+func BenchmarkEncryptCopy(b *testing.B) {
+	c, _ := NewCipher(CK128, StepEngine)
+	ck := rand.GetRand(16)
+	c.Expand(ck)
+	in := *state.NewStateFromBytes(rand.GetRand(16))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Copy().Encrypt(in, ck)
+	}
+}
+
+func BenchmarkExpand(b *testing.B) {
+	ck := rand.GetRand(16)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c, _ := NewCipher(CK128, StepEngine)
+		c.Expand(ck)
+	}
+}
+
+func BenchmarkEncryptTable(b *testing.B) {
+	c, _ := NewCipher(CK128, TableEngine)
+	ck := rand.GetRand(16)
+	in := *state.NewStateFromBytes(rand.GetRand(16))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Encrypt(in, ck)
+	}
+}
+
+func BenchmarkDecryptTable(b *testing.B) {
+	c, _ := NewCipher(CK128, TableEngine)
+	ck := rand.GetRand(16)
+	in := *state.NewStateFromBytes(rand.GetRand(16))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Decrypt(in, ck)
+	}
+}
+
+func BenchmarkEncryptBitsliced(b *testing.B) {
+	c, _ := NewCipher(CK128, BitslicedEngine)
+	ck := rand.GetRand(16)
+	in := *state.NewStateFromBytes(rand.GetRand(16))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.Encrypt(in, ck)
+	}
+}
+
+func BenchmarkEncryptBlocksBitsliced(b *testing.B) {
+	c, _ := NewCipher(CK128, BitslicedEngine)
+	ck := rand.GetRand(16)
+	in := make([]state.State, state.NBitslicedStates)
+	for i := range in {
+		in[i] = *state.NewStateFromBytes(rand.GetRand(16))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		c.EncryptBlocks(in, ck)
+	}
+}
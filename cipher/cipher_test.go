@@ -6,6 +6,7 @@ import (
 
 	"github.com/emil2k/go-aes/key"
 	"github.com/emil2k/go-aes/state"
+	"github.com/emil2k/go-aes/util/rand"
 )
 
 func TestCipherString(t *testing.T) {
@@ -17,28 +18,28 @@ func TestCipherString(t *testing.T) {
 }
 
 func TestNewCipher(t *testing.T) {
-	if c := NewCipher(CK128); c.nk != 4 || c.nr != 10 {
+	if c, err := NewCipher(CK128, StepEngine); err != nil || c.nk != 4 || c.nr != 10 {
 		t.Errorf("New 128 bit cipher failed")
 	}
-	if c := NewCipher(CK192); c.nk != 6 || c.nr != 12 {
+	if c, err := NewCipher(CK192, StepEngine); err != nil || c.nk != 6 || c.nr != 12 {
 		t.Errorf("New 128 bit cipher failed")
 	}
-	if c := NewCipher(CK256); c.nk != 8 || c.nr != 14 {
+	if c, err := NewCipher(CK256, StepEngine); err != nil || c.nk != 8 || c.nr != 14 {
 		t.Errorf("New 128 bit cipher failed")
 	}
 }
 
-func TestNewCipherPanic(t *testing.T) {
-	defer func() {
-		if r := recover(); r != "invalid cipher key size selected" {
-			t.Errorf("Invalid cipher key size panic failed.")
-		}
-	}()
-	_ = NewCipher(CipherKeySize(734))
+func TestNewCipherError(t *testing.T) {
+	if _, err := NewCipher(CipherKeySize(734), StepEngine); err != ErrKeySize {
+		t.Errorf("Invalid cipher key size error failed with %v", err)
+	}
+	if _, err := NewCipher(CK128, Engine(9)); err != ErrEngine {
+		t.Errorf("Invalid engine error failed with %v", err)
+	}
 }
 
 func TestAddRoundKey(t *testing.T) {
-	c := NewCipher(CK128)
+	c, _ := NewCipher(CK128, StepEngine)
 	ck := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f} // cipher key
 	in := *state.NewStateFromBytes([]byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
 	c.initCipher(in, ck, false)
@@ -51,7 +52,8 @@ func TestAddRoundKey(t *testing.T) {
 func TestGetRoundKey(t *testing.T) {
 	ck := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f} // cipher key
 	r1 := []byte{0xd6, 0xaa, 0x74, 0xfd, 0xd2, 0xaf, 0x72, 0xfa, 0xda, 0xa6, 0x78, 0xf1, 0xd6, 0xab, 0x76, 0xfe} // round 1 key
-	c := Cipher{key: key.NewKey(4, ck)}
+	ks, _ := key.NewSchedule(4, ck)
+	c := Cipher{schedule: ks}
 	if out0 := c.GetRoundKey(0); !bytes.Equal(out0.GetBytes(), ck) {
 		t.Errorf("Get round key for round 0 failed with %v", out0)
 	}
@@ -60,8 +62,42 @@ func TestGetRoundKey(t *testing.T) {
 	}
 }
 
+func TestGetInvRoundKey(t *testing.T) {
+	ck := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f} // cipher key
+	ks, _ := key.NewSchedule(4, ck)
+	c := Cipher{schedule: ks}
+	if out10 := c.GetInvRoundKey(10); !bytes.Equal(out10.GetBytes(), ck) {
+		t.Errorf("Get inverse round key for round 10 failed with %v", out10)
+	}
+}
+
+func TestExpand(t *testing.T) {
+	c, _ := NewCipher(CK128, StepEngine)
+	ck := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f} // cipher key
+	c.Expand(ck)
+	ks := c.schedule
+	if c.Expand(ck); c.schedule != ks {
+		t.Errorf("Expand should reuse the schedule for the same cipher key")
+	}
+	other := make([]byte, len(ck))
+	if c.Expand(other); c.schedule == ks || !c.schedule.Matches(other) {
+		t.Errorf("Expand should expand a new schedule for a different cipher key")
+	}
+	if err := c.Expand(make([]byte, 24)); err != ErrKeySize || !c.schedule.Matches(other) {
+		t.Errorf("Expand with a mismatched cipher key size failed with %v", err)
+	}
+}
+
+func TestCopy(t *testing.T) {
+	c, _ := NewCipher(CK256, StepEngine)
+	c.Expand(make([]byte, 32))
+	if x := c.Copy(); x == c || x.schedule != c.schedule || x.nk != c.nk || x.nr != c.nr || x.InfoLog != c.InfoLog {
+		t.Errorf("Copy failed, should be a new cipher sharing the schedule")
+	}
+}
+
 func TestEncrypt(t *testing.T) {
-	c := NewCipher(CK128)
+	c, _ := NewCipher(CK128, StepEngine)
 	ck := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f} // cipher key
 	in := *state.NewStateFromBytes([]byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
 	out := *state.NewStateFromBytes([]byte{0x69, 0xc4, 0xe0, 0xd8, 0x6a, 0x7b, 0x04, 0x30, 0xd8, 0xcd, 0xb7, 0x80, 0x70, 0xb4, 0xc5, 0x5a})
@@ -71,7 +107,7 @@ func TestEncrypt(t *testing.T) {
 }
 
 func TestDecrypt(t *testing.T) {
-	c := NewCipher(CK128)
+	c, _ := NewCipher(CK128, StepEngine)
 	ck := []byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f} // cipher key
 	ct := *state.NewStateFromBytes([]byte{0x69, 0xc4, 0xe0, 0xd8, 0x6a, 0x7b, 0x04, 0x30, 0xd8, 0xcd, 0xb7, 0x80, 0x70, 0xb4, 0xc5, 0x5a})
 	out := *state.NewStateFromBytes([]byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff})
@@ -79,3 +115,83 @@ func TestDecrypt(t *testing.T) {
 		t.Errorf("Decrypt failed with %s", x)
 	}
 }
+
+// TestDecryptAll tests decryption with each of the cipher key sizes, using the examples from FIPS-197.
+func TestDecryptAll(t *testing.T) {
+	test := func(ck []byte, size CipherKeySize, ct []byte) {
+		out := []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+		c, _ := NewCipher(size, StepEngine)
+		x := c.Decrypt(*state.NewStateFromBytes(ct), ck)
+		if !bytes.Equal(x.GetBytes(), out) {
+			t.Errorf("Decrypt with %d bit key failed with %s", size, x)
+		}
+	}
+	test([]byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17},
+		CK192, []byte{0xdd, 0xa9, 0x7c, 0xa4, 0x86, 0x4c, 0xdf, 0xe0, 0x6e, 0xaf, 0x70, 0xa0, 0xec, 0x0d, 0x71, 0x91})
+	test([]byte{0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f, 0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f},
+		CK256, []byte{0x8e, 0xa2, 0xb7, 0xca, 0x51, 0x67, 0x45, 0xbf, 0xea, 0xfc, 0x49, 0x90, 0x4b, 0x49, 0x60, 0x89})
+}
+
+// TestEngines tests encryption and decryption with each engine using the examples from FIPS-197.
+func TestEngines(t *testing.T) {
+	pt := []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	ck := make([]byte, 32)
+	for i := range ck {
+		ck[i] = byte(i)
+	}
+	test := func(e Engine, size CipherKeySize, ct []byte) {
+		c, _ := NewCipher(size, e)
+		if x := c.Encrypt(*state.NewStateFromBytes(pt), ck[:size/8]); !bytes.Equal(x.GetBytes(), ct) {
+			t.Errorf("Encrypt with engine %d and %d bit key failed with %s", e, size, x)
+		}
+		if x := c.Decrypt(*state.NewStateFromBytes(ct), ck[:size/8]); !bytes.Equal(x.GetBytes(), pt) {
+			t.Errorf("Decrypt with engine %d and %d bit key failed with %s", e, size, x)
+		}
+	}
+	for _, e := range []Engine{StepEngine, TableEngine, BitslicedEngine} {
+		test(e, CK128, []byte{0x69, 0xc4, 0xe0, 0xd8, 0x6a, 0x7b, 0x04, 0x30, 0xd8, 0xcd, 0xb7, 0x80, 0x70, 0xb4, 0xc5, 0x5a})
+		test(e, CK192, []byte{0xdd, 0xa9, 0x7c, 0xa4, 0x86, 0x4c, 0xdf, 0xe0, 0x6e, 0xaf, 0x70, 0xa0, 0xec, 0x0d, 0x71, 0x91})
+		test(e, CK256, []byte{0x8e, 0xa2, 0xb7, 0xca, 0x51, 0x67, 0x45, 0xbf, 0xea, 0xfc, 0x49, 0x90, 0x4b, 0x49, 0x60, 0x89})
+	}
+}
+
+// TestEncryptBlocks tests that each engine produces the same output as the step by step engine
+// when processing several blocks, including a partial group of bitsliced blocks.
+func TestEncryptBlocks(t *testing.T) {
+	ck := rand.GetRand(24)
+	in := make([]state.State, 7)
+	for i := range in {
+		in[i] = *state.NewStateFromBytes(rand.GetRand(16))
+	}
+	sc, _ := NewCipher(CK192, StepEngine)
+	expected := sc.EncryptBlocks(in, ck)
+	for _, e := range []Engine{TableEngine, BitslicedEngine} {
+		c, _ := NewCipher(CK192, e)
+		out := c.EncryptBlocks(in, ck)
+		for i := range in {
+			if out[i] != expected[i] {
+				t.Errorf("Encrypt blocks with engine %d failed on block %d with %s, expected %s", e, i, out[i], expected[i])
+			}
+		}
+		if dec := c.DecryptBlocks(out, ck); len(dec) != len(in) {
+			t.Errorf("Decrypt blocks with engine %d returned %d blocks", e, len(dec))
+		} else {
+			for i := range in {
+				if dec[i] != in[i] {
+					t.Errorf("Decrypt blocks with engine %d failed on block %d with %s, expected %s", e, i, dec[i], in[i])
+				}
+			}
+		}
+	}
+}
+
+func TestExpandBitsliced(t *testing.T) {
+	c, _ := NewCipher(CK128, BitslicedEngine)
+	c.Expand(make([]byte, 16))
+	if len(c.encPlanes) != 11 || len(c.decPlanes) != 11 {
+		t.Errorf("Expand with bitsliced engine failed to slice round keys")
+	}
+	if c.Expand(rand.GetRand(16)); c.encPlanes[0] == state.NewBitsliced(make([]state.State, state.NBitslicedStates)) {
+		t.Errorf("Expand with bitsliced engine failed to slice round keys for a new cipher key")
+	}
+}
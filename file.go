@@ -6,73 +6,84 @@ import (
 	"os"
 )
 
-// writeToFile writes the data bytes to given file, panics if error.
-func writeToFile(f *os.File, data ...byte) {
-	if _, err := f.Write(data); err != nil {
-		panic(err)
-	}
+// writeToFile writes the data bytes to given file.
+func writeToFile(f *os.File, data ...byte) error {
+	_, err := f.Write(data)
+	return err
 }
 
-// readFromFile reads data from given file into a byte slice, panics if error.
+// readFromFile reads data from given file into a byte slice.
 // Maximum size 20KB
-func readFromFile(f *os.File) []byte {
+func readFromFile(f *os.File) ([]byte, error) {
 	var fsize int64
 	if finfo, err := f.Stat(); err != nil {
-		panic(err)
-		return nil
+		return nil, err
 	} else if fsize = finfo.Size(); fsize > 20*1024 {
-		panic(fmt.Sprintf("file is to large to read, file size : %d bytes", fsize))
-		return nil
+		return nil, fmt.Errorf("file is to large to read, file size : %d bytes", fsize)
 	}
 	data := make([]byte, fsize)
 	if n, err := f.Read(data); err != nil {
 		if err == io.EOF {
 			veryVerboseLog.Println("read to eof", f.Name())
-			return data
+			return data, nil
 		}
-		panic(fmt.Sprintf("Error reading from file : %s", err))
-		return nil
+		return nil, fmt.Errorf("error reading from file : %s", err)
 	} else {
 		verboseLog.Println(n, "bytes read from", f.Name())
 	}
-	return data
+	return data, nil
 }
 
-// getFileSize returns the files size, panics if error.
-func getFileSize(name string) int64 {
-	if finfo, err := os.Stat(name); err != nil {
-		panic(err)
-	} else {
-		return finfo.Size()
+// getFileSize returns the files size.
+func getFileSize(name string) (int64, error) {
+	finfo, err := os.Stat(name)
+	if err != nil {
+		return 0, err
 	}
+	return finfo.Size(), nil
 }
 
-// createFile creates a file, truncates an existing file, panics if error.
-func createFile(name string) *os.File {
-	if f, err := os.Create(name); err != nil {
-		panic(err)
-		return nil
-	} else {
-		verboseLog.Println("created file", f.Name())
-		return f
+// createFile creates a file, truncates an existing file.
+func createFile(name string) (*os.File, error) {
+	f, err := os.Create(name)
+	if err != nil {
+		return nil, err
 	}
+	verboseLog.Println("created file", f.Name())
+	return f, nil
 }
 
-// openFile opens a file, panics if error.
-func openFile(name string) *os.File {
-	if f, err := os.Open(name); err != nil {
-		panic(err)
+// openFile opens a file.
+func openFile(name string) (*os.File, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	veryVerboseLog.Println("opened file", f.Name())
+	return f, nil
+}
+
+// removeFile closes then removes a file, standard output is left open.
+func removeFile(f *os.File) error {
+	if f == os.Stdout {
 		return nil
-	} else {
-		veryVerboseLog.Println("opened file", f.Name())
-		return f
 	}
+	f.Close()
+	if err := os.Remove(f.Name()); err != nil {
+		return err
+	}
+	verboseLog.Println("removed file", f.Name())
+	return nil
 }
 
-// closeFile closes a file, panics if error.
-func closeFile(f *os.File) {
+// closeFile closes a file, standard input and output are left open.
+func closeFile(f *os.File) error {
+	if f == os.Stdin || f == os.Stdout {
+		return nil
+	}
 	if err := f.Close(); err != nil {
-		panic(err)
+		return err
 	}
 	veryVerboseLog.Println("closed file", f.Name())
+	return nil
 }
@@ -8,33 +8,59 @@ import (
 )
 
 func TestCreateFile(t *testing.T) {
-	f := createFile(test_files.TestOutputFile)
+	f, err := createFile(test_files.TestOutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer closeFile(f)
 	defer removeTestFile(t, test_files.TestOutputFile)
 }
 
 func TestOpenFile(t *testing.T) {
-	f := createFile(test_files.TestOutputFile)
+	f, err := createFile(test_files.TestOutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer closeFile(f)
 	defer removeTestFile(t, test_files.TestOutputFile)
-	f = openFile(test_files.TestOutputFile)
+	if f, err = openFile(test_files.TestOutputFile); err != nil {
+		t.Fatal(err)
+	}
 	defer closeFile(f)
 }
 
+func TestOpenFileMissing(t *testing.T) {
+	if _, err := openFile(test_files.TestOutputFile + ".missing"); err == nil {
+		t.Errorf("Opening a missing file should fail")
+	}
+}
+
 func TestCloseFile(t *testing.T) {
-	f := createFile(test_files.TestOutputFile)
+	f, err := createFile(test_files.TestOutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer removeTestFile(t, test_files.TestOutputFile)
-	closeFile(f)
+	if err := closeFile(f); err != nil {
+		t.Errorf("Closing file failed with %v", err)
+	}
 }
 
 func TestWriteRead(t *testing.T) {
-	f := createFile(test_files.TestOutputFile)
+	f, err := createFile(test_files.TestOutputFile)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer closeFile(f)
 	defer removeTestFile(t, test_files.TestOutputFile)
 	data := []byte{0x01, 0x02, 0x03}
-	writeToFile(f, data...)
-	f = openFile(test_files.TestOutputFile) // need to create a new file descriptor
-	if out := readFromFile(f); !bytes.Equal(out, data) {
+	if err := writeToFile(f, data...); err != nil {
+		t.Fatal(err)
+	}
+	if f, err = openFile(test_files.TestOutputFile); err != nil { // need to create a new file descriptor
+		t.Fatal(err)
+	}
+	if out, err := readFromFile(f); err != nil || !bytes.Equal(out, data) {
 		t.Errorf("File write then read failed with %s", hex.EncodeToString(out))
 	}
 }
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+const headerVersion byte = 4 // version of the header format written on encryption, version 1 lacks key derivation, version 2 lacks authentication, and version 3 lacks padding
+
+// magic identifies files encrypted by the command.
+var magic = []byte("GAES")
+
+// errNotEncrypted is returned when the input does not start with the magic bytes.
+var errNotEncrypted = errors.New("input is not a file encrypted by go-aes")
+
+// Identifiers of the block cipher modes, stored in the header.
+const (
+	ctrMode     byte = iota + 1 // counter mode
+	cbcMode                     // cipher-block chaining mode
+	gcmMode                     // galois/counter mode
+	cfbMode                     // cipher feedback mode, 128 bit segments
+	cfb8Mode                    // cipher feedback mode, 8 bit segments
+	ofbMode                     // output feedback mode
+	xtsMode                     // XEX-based tweaked-codebook mode with ciphertext stealing
+	chunkedMode                 // galois/counter mode sealing each chunk, STREAM construction
+	cbcCS1Mode                  // cipher-block chaining mode with ciphertext stealing, CS1 variant
+	cbcCS2Mode                  // cipher-block chaining mode with ciphertext stealing, CS2 variant
+	cbcCS3Mode                  // cipher-block chaining mode with ciphertext stealing, CS3 variant
+	ccmMode                     // counter with CBC-MAC mode
+	sivMode                     // synthetic initialization vector mode, AES-SIV
+)
+
+// Identifiers of the key derivation functions, stored in the header.
+const (
+	noKDF     byte = iota // cipher key stored in a key file
+	pbkdf2KDF             // cipher key derived from a password with PBKDF2-HMAC-SHA256
+)
+
+// Identifiers of the message authentication codes, stored in the header.
+const (
+	noAuth   byte = iota // not authenticated, or authenticated by the mode
+	hmacAuth             // encrypt-then-MAC with HMAC-SHA256
+	cmacAuth             // encrypt-then-MAC with AES-CMAC
+)
+
+// Identifiers of the padding schemes, stored in the header.
+const (
+	pkcs7Padding   byte = iota // PKCS#7, the padding of all modes before version 4
+	x923Padding                // ANSI X.923
+	iso7816Padding             // ISO/IEC 7816-4
+	zeroPadding                // zero bytes
+	noPadding                  // length preserving
+)
+
+// header describes how a file was encrypted, it precedes the cipher text using the following format :
+//
+//	 4 Octet - magic bytes "GAES"
+//	 1 Octet - format version
+//	 1 Octet - block cipher mode identifier
+//	 1 Octet - cipher key size in bytes
+//	 1 Octet - length of nonce or IV in bytes
+//	nn Octet - nonce or IV
+//	 1 Octet - key derivation function identifier, since version 2
+//
+// Followed by the key derivation parameters when the cipher key is derived from a password :
+//
+//	 4 Octet - number of iterations, big endian
+//	 1 Octet - length of salt in bytes
+//	nn Octet - salt
+//
+// Followed by the message authentication code identifier, since version 3 :
+//
+//	1 Octet - message authentication code identifier
+//
+// Followed by the padding scheme identifier, since version 4 :
+//
+//	1 Octet - padding scheme identifier
+//
+// When authenticated with a message authentication code, the tag of the header and the cipher
+// text follows the cipher text.
+type header struct {
+	version    byte   // format version
+	mode       byte   // block cipher mode identifier
+	keySize    uint64 // cipher key size in bits
+	nonce      []byte // nonce or initialization vector
+	kdf        byte   // key derivation function identifier
+	iterations uint32 // iterations of the key derivation function
+	salt       []byte // salt of the key derivation function
+	auth       byte   // message authentication code identifier
+	padding    byte   // padding scheme identifier
+}
+
+// newHeader creates a header in the current format version.
+func newHeader(mode byte, keySize uint64, nonce []byte) *header {
+	return &header{
+		version: headerVersion,
+		mode:    mode,
+		keySize: keySize,
+		nonce:   nonce,
+	}
+}
+
+// bytes returns the encoded header.
+func (h *header) bytes() []byte {
+	b := append([]byte{}, magic...)
+	b = append(b, h.version, h.mode, byte(h.keySize/8), byte(len(h.nonce)))
+	b = append(b, h.nonce...)
+	if h.version < 2 {
+		return b
+	}
+	b = append(b, h.kdf)
+	if h.kdf != noKDF {
+		it := make([]byte, 4)
+		binary.BigEndian.PutUint32(it, h.iterations)
+		b = append(b, it...)
+		b = append(b, byte(len(h.salt)))
+		b = append(b, h.salt...)
+	}
+	if h.version < 3 {
+		return b
+	}
+	b = append(b, h.auth)
+	if h.version < 4 {
+		return b
+	}
+	return append(b, h.padding)
+}
+
+// size returns the size of the encoded header in bytes.
+func (h *header) size() uint64 {
+	return uint64(len(h.bytes()))
+}
+
+// readHeader reads and validates a header from the start of the input.
+// Returns errNotEncrypted if the input does not start with the magic bytes.
+func readHeader(r io.Reader) (*header, error) {
+	b := make([]byte, len(magic)+4)
+	if _, err := io.ReadFull(r, b); err == io.EOF || err == io.ErrUnexpectedEOF {
+		return nil, errNotEncrypted
+	} else if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(b[:len(magic)], magic) {
+		return nil, errNotEncrypted
+	}
+	b = b[len(magic):]
+	h := &header{version: b[0], mode: b[1], keySize: uint64(b[2]) * 8}
+	if h.version < 1 || h.version > headerVersion {
+		return nil, fmt.Errorf("unsupported format version %d, expected at most %d", h.version, headerVersion)
+	}
+	if _, err := modeName(h.mode); err != nil {
+		return nil, err
+	}
+	if err := checkKeySize(h.keySize); err != nil {
+		return nil, err
+	}
+	h.nonce = make([]byte, b[3])
+	if _, err := io.ReadFull(r, h.nonce); err != nil {
+		return nil, fmt.Errorf("header nonce truncated : %s", err)
+	}
+	if h.version < 2 {
+		return h, nil
+	}
+	if err := readKDF(r, h); err != nil {
+		return nil, err
+	}
+	if h.version < 3 {
+		return h, nil
+	}
+	if err := readAuth(r, h); err != nil {
+		return nil, err
+	}
+	if h.version < 4 {
+		return h, nil
+	}
+	if err := readPadding(r, h); err != nil {
+		return nil, err
+	}
+	return h, nil
+}
+
+// readPadding reads the padding scheme identifier into the header.
+func readPadding(r io.Reader, h *header) error {
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return fmt.Errorf("header padding truncated : %s", err)
+	}
+	switch h.padding = b[0]; h.padding {
+	case pkcs7Padding, x923Padding, iso7816Padding, zeroPadding, noPadding:
+		return nil
+	default:
+		return fmt.Errorf("unknown padding identifier %d in header", h.padding)
+	}
+}
+
+// readAuth reads the message authentication code identifier into the header.
+func readAuth(r io.Reader, h *header) error {
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return fmt.Errorf("header authentication truncated : %s", err)
+	}
+	switch h.auth = b[0]; h.auth {
+	case noAuth, hmacAuth, cmacAuth:
+		return nil
+	default:
+		return fmt.Errorf("unknown authentication identifier %d in header", h.auth)
+	}
+}
+
+// readKDF reads the key derivation function identifier and its parameters into the header.
+func readKDF(r io.Reader, h *header) error {
+	b := make([]byte, 1)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return fmt.Errorf("header key derivation truncated : %s", err)
+	}
+	switch h.kdf = b[0]; h.kdf {
+	case noKDF:
+		return nil
+	case pbkdf2KDF:
+	default:
+		return fmt.Errorf("unknown key derivation identifier %d in header", h.kdf)
+	}
+	b = make([]byte, 5)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return fmt.Errorf("header key derivation truncated : %s", err)
+	}
+	if h.iterations = binary.BigEndian.Uint32(b); h.iterations == 0 {
+		return errors.New("header key derivation iterations must be positive")
+	}
+	h.salt = make([]byte, b[4])
+	if _, err := io.ReadFull(r, h.salt); err != nil {
+		return fmt.Errorf("header salt truncated : %s", err)
+	}
+	return nil
+}
+
+// parseMode returns the identifier of the named block cipher mode.
+func parseMode(name string) (byte, error) {
+	switch name {
+	case "ctr", "cm", "icm", "sic":
+		return ctrMode, nil
+	case "cbc":
+		return cbcMode, nil
+	case "gcm":
+		return gcmMode, nil
+	case "cfb":
+		return cfbMode, nil
+	case "cfb8":
+		return cfb8Mode, nil
+	case "ofb":
+		return ofbMode, nil
+	case "xts":
+		return xtsMode, nil
+	case "chunked":
+		return chunkedMode, nil
+	case "cbc-cs1":
+		return cbcCS1Mode, nil
+	case "cbc-cs2":
+		return cbcCS2Mode, nil
+	case "cbc-cs3":
+		return cbcCS3Mode, nil
+	case "ccm":
+		return ccmMode, nil
+	case "siv":
+		return sivMode, nil
+	default:
+		return 0, fmt.Errorf("unknown mode %q chosen", name)
+	}
+}
+
+// parsePadding returns the identifier of the named padding scheme.
+func parsePadding(name string) (byte, error) {
+	switch name {
+	case "pkcs7":
+		return pkcs7Padding, nil
+	case "x923":
+		return x923Padding, nil
+	case "iso7816":
+		return iso7816Padding, nil
+	case "zero":
+		return zeroPadding, nil
+	case "none":
+		return noPadding, nil
+	default:
+		return 0, fmt.Errorf("unknown padding %q chosen", name)
+	}
+}
+
+// modeName returns the name of the block cipher mode identifier.
+func modeName(mode byte) (string, error) {
+	switch mode {
+	case ctrMode:
+		return "ctr", nil
+	case cbcMode:
+		return "cbc", nil
+	case gcmMode:
+		return "gcm", nil
+	case cfbMode:
+		return "cfb", nil
+	case cfb8Mode:
+		return "cfb8", nil
+	case ofbMode:
+		return "ofb", nil
+	case xtsMode:
+		return "xts", nil
+	case chunkedMode:
+		return "chunked", nil
+	case cbcCS1Mode:
+		return "cbc-cs1", nil
+	case cbcCS2Mode:
+		return "cbc-cs2", nil
+	case cbcCS3Mode:
+		return "cbc-cs3", nil
+	case ccmMode:
+		return "ccm", nil
+	case sivMode:
+		return "siv", nil
+	default:
+		return "", fmt.Errorf("unknown mode identifier %d in header", mode)
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHeader(t *testing.T) {
+	h := newHeader(cbcMode, 192, []byte{0x01, 0x02, 0x03})
+	b := h.bytes()
+	expected := []byte{'G', 'A', 'E', 'S', headerVersion, cbcMode, 24, 3, 0x01, 0x02, 0x03, noKDF, noAuth, pkcs7Padding}
+	if !bytes.Equal(b, expected) {
+		t.Errorf("Header encoding failed with %x", b)
+	} else if h.size() != uint64(len(expected)) {
+		t.Errorf("Header size failed with %d", h.size())
+	}
+	r := bytes.NewReader(append(b, 0xff))
+	if x, err := readHeader(r); err != nil {
+		t.Errorf("Reading header failed with %v", err)
+	} else if x.version != h.version || x.mode != h.mode || x.keySize != h.keySize || !bytes.Equal(x.nonce, h.nonce) {
+		t.Errorf("Reading header failed with %+v", x)
+	} else if r.Len() != 1 {
+		t.Errorf("Reading header should leave the input at the encrypted message")
+	}
+}
+
+// TestHeaderKDF tests encoding and reading the key derivation parameters.
+func TestHeaderKDF(t *testing.T) {
+	h := newHeader(gcmMode, 256, []byte{0x01})
+	h.kdf, h.iterations, h.salt = pbkdf2KDF, 0x010203, []byte{0xaa, 0xbb}
+	expected := []byte{'G', 'A', 'E', 'S', headerVersion, gcmMode, 32, 1, 0x01, pbkdf2KDF, 0x00, 0x01, 0x02, 0x03, 2, 0xaa, 0xbb, noAuth, pkcs7Padding}
+	if b := h.bytes(); !bytes.Equal(b, expected) {
+		t.Errorf("Header encoding with key derivation failed with %x", b)
+	}
+	if x, err := readHeader(bytes.NewReader(expected)); err != nil {
+		t.Errorf("Reading header with key derivation failed with %v", err)
+	} else if x.kdf != h.kdf || x.iterations != h.iterations || !bytes.Equal(x.salt, h.salt) {
+		t.Errorf("Reading header with key derivation failed with %+v", x)
+	}
+	test := func(b []byte, desc string) {
+		if _, err := readHeader(bytes.NewReader(b)); err == nil {
+			t.Errorf("Reading header should fail with %s", desc)
+		}
+	}
+	test(expected[:len(expected)-3], "truncated salt")
+	test(append(append([]byte{}, expected[:9]...), 7), "unknown key derivation")
+	test(append(append([]byte{}, expected[:10]...), 0, 0, 0, 0, 0), "no iterations")
+}
+
+// TestHeaderAuth tests encoding and reading the message authentication code identifier.
+func TestHeaderAuth(t *testing.T) {
+	h := newHeader(ctrMode, 128, []byte{0x01})
+	h.auth = cmacAuth
+	expected := []byte{'G', 'A', 'E', 'S', headerVersion, ctrMode, 16, 1, 0x01, noKDF, cmacAuth, pkcs7Padding}
+	if b := h.bytes(); !bytes.Equal(b, expected) {
+		t.Errorf("Header encoding with authentication failed with %x", b)
+	}
+	if x, err := readHeader(bytes.NewReader(expected)); err != nil {
+		t.Errorf("Reading header with authentication failed with %v", err)
+	} else if x.auth != h.auth {
+		t.Errorf("Reading header with authentication failed with %+v", x)
+	}
+	if _, err := readHeader(bytes.NewReader(expected[:len(expected)-2])); err == nil {
+		t.Errorf("Reading header should fail with truncated authentication")
+	}
+	if _, err := readHeader(bytes.NewReader(append(append([]byte{}, expected[:len(expected)-2]...), 7, pkcs7Padding))); err == nil {
+		t.Errorf("Reading header should fail with unknown authentication")
+	}
+}
+
+// TestHeaderPadding tests encoding and reading the padding scheme identifier.
+func TestHeaderPadding(t *testing.T) {
+	h := newHeader(ctrMode, 128, []byte{0x01})
+	h.padding = noPadding
+	expected := []byte{'G', 'A', 'E', 'S', headerVersion, ctrMode, 16, 1, 0x01, noKDF, noAuth, noPadding}
+	if b := h.bytes(); !bytes.Equal(b, expected) {
+		t.Errorf("Header encoding with padding failed with %x", b)
+	}
+	if x, err := readHeader(bytes.NewReader(expected)); err != nil {
+		t.Errorf("Reading header with padding failed with %v", err)
+	} else if x.padding != h.padding {
+		t.Errorf("Reading header with padding failed with %+v", x)
+	}
+	if _, err := readHeader(bytes.NewReader(expected[:len(expected)-1])); err == nil {
+		t.Errorf("Reading header should fail with truncated padding")
+	}
+	if _, err := readHeader(bytes.NewReader(append(expected[:len(expected)-1], 7))); err == nil {
+		t.Errorf("Reading header should fail with unknown padding")
+	}
+}
+
+// TestHeaderVersion3 tests that headers written before padding schemes can still be read, as the
+// PKCS#7 padding all modes used.
+func TestHeaderVersion3(t *testing.T) {
+	b := []byte{'G', 'A', 'E', 'S', 3, ctrMode, 16, 1, 0x01, noKDF, hmacAuth, 0xff}
+	r := bytes.NewReader(b)
+	if x, err := readHeader(r); err != nil {
+		t.Errorf("Reading version 3 header failed with %v", err)
+	} else if x.padding != pkcs7Padding || !bytes.Equal(x.bytes(), b[:len(b)-1]) || r.Len() != 1 {
+		t.Errorf("Reading version 3 header failed with %+v", x)
+	}
+}
+
+// TestHeaderVersion2 tests that headers written before authentication can still be read.
+func TestHeaderVersion2(t *testing.T) {
+	b := []byte{'G', 'A', 'E', 'S', 2, cbcMode, 16, 1, 0x01, noKDF, 0xff}
+	r := bytes.NewReader(b)
+	if x, err := readHeader(r); err != nil {
+		t.Errorf("Reading version 2 header failed with %v", err)
+	} else if x.auth != noAuth || !bytes.Equal(x.bytes(), b[:len(b)-1]) || r.Len() != 1 {
+		t.Errorf("Reading version 2 header failed with %+v", x)
+	}
+}
+
+// TestHeaderVersion1 tests that headers written before key derivation can still be read.
+func TestHeaderVersion1(t *testing.T) {
+	b := []byte{'G', 'A', 'E', 'S', 1, ctrMode, 16, 2, 0x01, 0x02, 0xff}
+	r := bytes.NewReader(b)
+	if x, err := readHeader(r); err != nil {
+		t.Errorf("Reading version 1 header failed with %v", err)
+	} else if x.kdf != noKDF || !bytes.Equal(x.bytes(), b[:len(b)-1]) || r.Len() != 1 {
+		t.Errorf("Reading version 1 header failed with %+v", x)
+	}
+}
+
+// TestReadHeaderInvalid tests that foreign and corrupted headers are rejected.
+func TestReadHeaderInvalid(t *testing.T) {
+	test := func(b []byte, desc string) {
+		if _, err := readHeader(bytes.NewReader(b)); err == nil {
+			t.Errorf("Reading header should fail with %s", desc)
+		}
+	}
+	valid := newHeader(ctrMode, 128, make([]byte, 8)).bytes()
+	modify := func(i int, v byte) []byte {
+		b := append([]byte{}, valid...)
+		b[i] = v
+		return b
+	}
+	test(nil, "empty input")
+	test([]byte("GAE"), "truncated magic")
+	test(modify(0, 'X'), "foreign magic")
+	test(modify(4, headerVersion+1), "unknown version")
+	test(modify(5, 0), "unknown mode")
+	test(modify(6, 20), "invalid key size")
+	test(valid[:len(valid)-4], "truncated nonce")
+	if _, err := readHeader(bytes.NewReader([]byte("PK\x03\x04 not encrypted"))); err != errNotEncrypted {
+		t.Errorf("Reading header of a foreign file failed with %v", err)
+	}
+}
+
+func TestParseMode(t *testing.T) {
+	for _, name := range []string{"ctr", "cm", "icm", "sic", "cbc", "gcm", "chunked", "cbc-cs1", "cbc-cs2", "cbc-cs3", "ccm", "siv"} {
+		if id, err := parseMode(name); err != nil {
+			t.Errorf("Parsing mode %s failed with %v", name, err)
+		} else if x, _ := modeName(id); name != x && id != ctrMode {
+			t.Errorf("Parsing mode %s failed with identifier of %s", name, x)
+		}
+	}
+	if _, err := parseMode("ecb"); err == nil {
+		t.Errorf("Parsing unknown mode should fail")
+	}
+}
@@ -0,0 +1,46 @@
+package kdf
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+)
+
+const DefaultIterations int = 100 * 1000 // iterations used to derive cipher keys from passwords
+const SaltSize int = 16                  // size of randomly generated salts in bytes
+
+// ErrParameters is returned when the number of iterations or the key length is not positive.
+var ErrParameters = errors.New("kdf : iterations and key length must be positive")
+
+// PBKDF2 derives a key of keyLen bytes from the password and salt, as specified by RFC 8018,
+// using HMAC-SHA256 as the pseudorandom function. Each additional iteration makes guessing the
+// password more costly.
+func PBKDF2(password []byte, salt []byte, iterations int, keyLen int) ([]byte, error) {
+	if iterations < 1 || keyLen < 1 {
+		return nil, ErrParameters
+	}
+	prf := hmac.New(sha256.New, password)
+	out := make([]byte, 0, keyLen)
+	t := make([]byte, prf.Size())
+	u := make([]byte, 0, prf.Size())
+	for i := uint32(1); len(out) < keyLen; i++ {
+		// The first iteration hashes the salt followed by the big endian block index
+		prf.Reset()
+		prf.Write(salt)
+		binary.Write(prf, binary.BigEndian, i)
+		u = prf.Sum(u[:0])
+		copy(t, u)
+		// Each following iteration hashes the previous one, all are xored together
+		for j := 1; j < iterations; j++ {
+			prf.Reset()
+			prf.Write(u)
+			u = prf.Sum(u[:0])
+			for k := range t {
+				t[k] ^= u[k]
+			}
+		}
+		out = append(out, t...)
+	}
+	return out[:keyLen], nil
+}
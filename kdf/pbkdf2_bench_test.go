@@ -0,0 +1,11 @@
+package kdf
+
+import (
+	"testing"
+)
+
+func BenchmarkPBKDF2(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		PBKDF2([]byte("password"), make([]byte, SaltSize), DefaultIterations, 32)
+	}
+}
@@ -0,0 +1,41 @@
+package kdf
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+// TestPBKDF2 tests key derivation with the PBKDF2-HMAC-SHA256 examples from RFC 7914.
+func TestPBKDF2(t *testing.T) {
+	test := func(password, salt string, iterations int, out string) {
+		expected, _ := hex.DecodeString(out)
+		if x, err := PBKDF2([]byte(password), []byte(salt), iterations, len(expected)); err != nil {
+			t.Errorf("PBKDF2 with %d iterations failed with error %v", iterations, err)
+		} else if !bytes.Equal(x, expected) {
+			t.Errorf("PBKDF2 with %d iterations failed with %s", iterations, hex.EncodeToString(x))
+		}
+	}
+	test("passwd", "salt", 1, "55ac046e56e3089fec1691c22544b605f94185216dde0465e68b9d57c20dacbc49ca9cccf179b645991664b39d77ef317c71b845b1e30bd509112041d3a19783")
+	test("Password", "NaCl", 80000, "4ddcd8f60b98be21830cee5ef22701f9641a4418d04c0414aeff08876b34ab56a1d425a1225833549adb841b51c9b3176a272bdebba1d078478f62b397f33c8d")
+}
+
+// TestPBKDF2Truncated tests that shorter keys are a prefix of longer keys.
+func TestPBKDF2Truncated(t *testing.T) {
+	long, _ := PBKDF2([]byte("password"), []byte("salt"), 4096, 32)
+	short, _ := PBKDF2([]byte("password"), []byte("salt"), 4096, 24)
+	if expected, _ := hex.DecodeString("c5e478d59288c841aa530db6845c4c8d962893a001ce4e11a4963873aa98134a"); !bytes.Equal(long, expected) {
+		t.Errorf("PBKDF2 failed with %s", hex.EncodeToString(long))
+	} else if !bytes.Equal(short, long[:24]) {
+		t.Errorf("PBKDF2 truncated key failed with %s", hex.EncodeToString(short))
+	}
+}
+
+func TestPBKDF2Parameters(t *testing.T) {
+	if _, err := PBKDF2([]byte("password"), nil, 0, 16); err != ErrParameters {
+		t.Errorf("PBKDF2 with no iterations failed with %v", err)
+	}
+	if _, err := PBKDF2([]byte("password"), nil, 1, 0); err != ErrParameters {
+		t.Errorf("PBKDF2 with empty key failed with %v", err)
+	}
+}
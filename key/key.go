@@ -1,11 +1,16 @@
 package key
 
 import (
+	"errors"
+
 	"github.com/emil2k/go-aes/util/bytes"
 	"github.com/emil2k/go-aes/word"
 	rj "github.com/emil2k/go-math/rijndael"
 )
 
+// ErrKeySize is returned when a cipher key is not 128, 192, or 256 bits, or does not match Nk.
+var ErrKeySize = errors.New("key : invalid cipher key size")
+
 // Key represents a key and maintains the state of while a cipher key is expanded
 type Key struct {
 	i     int         // keeps track of iteration during key expansion
@@ -23,18 +28,24 @@ func (k Key) String() string {
 	return out
 }
 
-// NewKey constructs a Key object by seeding it with a cipher key and setting Nk
-func NewKey(nk int, seed []byte) *Key {
+// NewKey constructs a Key object by seeding it with a cipher key and setting Nk.
+// Returns ErrKeySize if Nk is not 4, 6, or 8 or the seed is not Nk words long.
+func NewKey(nk int, seed []byte) (*Key, error) {
+	switch {
+	case nk != 4 && nk != 6 && nk != 8, len(seed) != nk*4:
+		return nil, ErrKeySize
+	}
 	k := Key{i: 0, nk: nk, words: make([]word.Word, 0)}
 	// Initiate key with seed
 	for j := 0; j < len(seed)/4; j++ {
 		k.words = append(k.words, word.Word(bytes.Join32(seed[4*j:4*(j+1)])))
 		k.i++
 	}
-	return &k
+	return &k, nil
 }
 
 // Expand the key by Nk * 4 bytes
+// Substitutes words through the lookup table of the S-box, so it does not run in constant time.
 func (k *Key) Expand() {
 	for start := k.i; k.i == start || k.i%k.nk != 0; k.i++ {
 		t := k.GetWord(k.i - 1)
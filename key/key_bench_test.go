@@ -8,7 +8,7 @@ import (
 func BenchmarkExpand(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		b.StopTimer()
-		k := NewKey(4, rand.GetRand(16))
+		k, _ := NewKey(4, rand.GetRand(16))
 		b.StartTimer()
 		for i := 0; i < 10; i++ {
 			k.Expand()
@@ -17,7 +17,7 @@ func BenchmarkExpand(b *testing.B) {
 }
 
 func BenchmarkString(b *testing.B) {
-	k := NewKey(4, rand.GetRand(16))
+	k, _ := NewKey(4, rand.GetRand(16))
 	for i := 0; i < 10; i++ {
 		k.Expand()
 	}
@@ -28,7 +28,7 @@ func BenchmarkString(b *testing.B) {
 }
 
 func BenchmarkGetWord(b *testing.B) {
-	k := NewKey(4, rand.GetRand(16))
+	k, _ := NewKey(4, rand.GetRand(16))
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
 		k.GetWord(1)
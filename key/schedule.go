@@ -0,0 +1,68 @@
+package key
+
+import (
+	"crypto/subtle"
+
+	"github.com/emil2k/go-aes/state"
+)
+
+// Schedule holds the round keys of a fully expanded cipher key, along with the round keys of the
+// equivalent inverse cipher used for decryption. Immutable once created, so it can be shared
+// between goroutines.
+type Schedule struct {
+	ck  []byte        // copy of the cipher key
+	enc []state.State // round keys in encryption order
+	dec []state.State // round keys of the equivalent inverse cipher in decryption order
+}
+
+// NewSchedule expands the cipher key into a round key schedule, nk is the number of 4 byte columns
+// in the cipher key. The equivalent inverse cipher round keys are the encryption round keys in
+// reverse order with the inverse mix applied to all but the first and last.
+// Returns ErrKeySize if the cipher key does not match Nk.
+func NewSchedule(nk int, ck []byte) (*Schedule, error) {
+	nr := nk + 6
+	k, err := NewKey(nk, ck)
+	if err != nil {
+		return nil, err
+	}
+	for k.NWords() < (nr+1)*4 { // 4 words per round key
+		k.Expand()
+	}
+	s := &Schedule{
+		ck:  make([]byte, len(ck)),
+		enc: make([]state.State, nr+1),
+		dec: make([]state.State, nr+1),
+	}
+	copy(s.ck, ck)
+	for i := 0; i <= nr; i++ {
+		s.enc[i] = *state.NewStateFromWords(k.GetWordSlice(i*4, (i+1)*4))
+	}
+	for i := 0; i <= nr; i++ {
+		rk := s.enc[nr-i]
+		if i != 0 && i != nr {
+			rk.InvMix()
+		}
+		s.dec[i] = rk
+	}
+	return s, nil
+}
+
+// NRounds returns the number of rounds the schedule has keys for.
+func (s *Schedule) NRounds() int {
+	return len(s.enc) - 1
+}
+
+// RoundKey returns the round key for the ith round of encryption.
+func (s *Schedule) RoundKey(i int) state.State {
+	return s.enc[i]
+}
+
+// InvRoundKey returns the round key for the ith round of decryption with the equivalent inverse cipher.
+func (s *Schedule) InvRoundKey(i int) state.State {
+	return s.dec[i]
+}
+
+// Matches checks whether the schedule was expanded from the passed cipher key.
+func (s *Schedule) Matches(ck []byte) bool {
+	return subtle.ConstantTimeCompare(s.ck, ck) == 1
+}
@@ -0,0 +1,76 @@
+package key
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestNewSchedule(t *testing.T) {
+	ck := []byte{0x2b, 0x7e, 0x15, 0x16, 0x28, 0xae, 0xd2, 0xa6, 0xab, 0xf7, 0x15, 0x88, 0x09, 0xcf, 0x4f, 0x3c}  // cipher key
+	r10 := []byte{0xd0, 0x14, 0xf9, 0xa8, 0xc9, 0xee, 0x25, 0x89, 0xe1, 0x3f, 0x0c, 0xc8, 0xb6, 0x63, 0x0c, 0xa6} // round 10 key
+	s, _ := NewSchedule(4, ck)
+	if s.NRounds() != 10 {
+		t.Errorf("New schedule failed with %d rounds", s.NRounds())
+	}
+	if rk := s.RoundKey(0); !bytes.Equal(rk.GetBytes(), ck) {
+		t.Errorf("New schedule failed round 0 key %s", rk)
+	}
+	if rk := s.RoundKey(10); !bytes.Equal(rk.GetBytes(), r10) {
+		t.Errorf("New schedule failed round 10 key %s", rk)
+	}
+}
+
+func TestScheduleNRounds(t *testing.T) {
+	test := func(nk, nr int) {
+		if s, err := NewSchedule(nk, make([]byte, nk*4)); err != nil {
+			t.Errorf("Schedule for nk %d failed with error : %s", nk, err.Error())
+		} else if x := s.NRounds(); x != nr {
+			t.Errorf("Schedule for nk %d should have %d rounds, has %d", nk, nr, x)
+		}
+	}
+	test(4, 10)
+	test(6, 12)
+	test(8, 14)
+}
+
+// TestInvRoundKey tests that the decryption round keys are the reversed encryption round keys
+// with the inverse mix applied to the middle rounds.
+func TestInvRoundKey(t *testing.T) {
+	ck := []byte{0x2b, 0x7e, 0x15, 0x16, 0x28, 0xae, 0xd2, 0xa6, 0xab, 0xf7, 0x15, 0x88, 0x09, 0xcf, 0x4f, 0x3c} // cipher key
+	s, _ := NewSchedule(4, ck)
+	if s.InvRoundKey(0) != s.RoundKey(10) || s.InvRoundKey(10) != s.RoundKey(0) {
+		t.Errorf("First and last inverse round keys should match encryption round keys")
+	}
+	for i := 1; i < 10; i++ {
+		expected := s.RoundKey(10 - i)
+		expected.InvMix()
+		if x := s.InvRoundKey(i); x != expected {
+			t.Errorf("Inverse round key %d failed with %s, expected %s", i, x, expected)
+		}
+	}
+}
+
+func TestScheduleMatches(t *testing.T) {
+	ck := []byte{0x2b, 0x7e, 0x15, 0x16, 0x28, 0xae, 0xd2, 0xa6, 0xab, 0xf7, 0x15, 0x88, 0x09, 0xcf, 0x4f, 0x3c} // cipher key
+	s, _ := NewSchedule(4, ck)
+	if !s.Matches(ck) {
+		t.Errorf("Schedule should match its cipher key")
+	}
+	other := make([]byte, len(ck))
+	copy(other, ck)
+	other[0] ^= 0x01
+	if s.Matches(other) {
+		t.Errorf("Schedule should not match a different cipher key %s", hex.EncodeToString(other))
+	}
+	ck[0] ^= 0x01 // schedule keeps its own copy
+	if s.Matches(ck) {
+		t.Errorf("Schedule should not be affected by changes to the passed cipher key")
+	}
+}
+
+func TestNewScheduleKeySize(t *testing.T) {
+	if _, err := NewSchedule(4, make([]byte, 24)); err != ErrKeySize {
+		t.Errorf("New schedule with mismatched cipher key should fail")
+	}
+}
@@ -0,0 +1,179 @@
+package keywrap
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/state"
+)
+
+const semiblock int = 8 // size of the halves of a block processed by the wrapping function, in bytes
+
+// defaultIV is the initial value of RFC 3394, checked on unwrapping to verify integrity.
+var defaultIV = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6}
+
+// padIV is the constant prefix of the alternative initial value of RFC 5649, followed by the
+// length of the key data.
+var padIV = []byte{0xa6, 0x59, 0x59, 0xa6}
+
+// ErrInputSize is returned when the key data to wrap is too short or not a multiple of 8 bytes, or
+// the wrapped key is too short or not a multiple of 8 bytes.
+var ErrInputSize = errors.New("keywrap : invalid input size")
+
+// ErrIntegrity is returned when unwrapping a key fails the integrity check, as the wrapped key was
+// modified or the key encryption key is wrong.
+var ErrIntegrity = errors.New("keywrap : integrity check failed")
+
+// Wrap wraps the key data with the key encryption key, as specified by RFC 3394.
+// The key data must be a multiple of 8 bytes and at least 16 bytes, the wrapped key is 8 bytes
+// longer. The block cipher created by the cipher factory must match the size of the key encryption key.
+func Wrap(cf cipher.CipherFactory, kek []byte, plaintext []byte) ([]byte, error) {
+	if len(plaintext) < 2*semiblock || len(plaintext)%semiblock != 0 {
+		return nil, ErrInputSize
+	}
+	c, err := newCipher(cf, kek)
+	if err != nil {
+		return nil, err
+	}
+	return wrap(c, kek, defaultIV, plaintext), nil
+}
+
+// Unwrap unwraps the wrapped key with the key encryption key, as specified by RFC 3394.
+// Returns ErrIntegrity if the integrity check fails, without any key data.
+func Unwrap(cf cipher.CipherFactory, kek []byte, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < 3*semiblock || len(ciphertext)%semiblock != 0 {
+		return nil, ErrInputSize
+	}
+	c, err := newCipher(cf, kek)
+	if err != nil {
+		return nil, err
+	}
+	a, r := unwrap(c, kek, ciphertext)
+	if subtle.ConstantTimeCompare(a, defaultIV) != 1 {
+		return nil, ErrIntegrity
+	}
+	return r, nil
+}
+
+// WrapPad wraps key data of any length with the key encryption key, as specified by RFC 5649.
+// The key data is padded with zeros to a multiple of 8 bytes, its length being recorded in the
+// initial value. Key data of up to 8 bytes is encrypted as a single block.
+func WrapPad(cf cipher.CipherFactory, kek []byte, plaintext []byte) ([]byte, error) {
+	if len(plaintext) == 0 || uint64(len(plaintext)) > 0xFFFFFFFF {
+		return nil, ErrInputSize
+	}
+	c, err := newCipher(cf, kek)
+	if err != nil {
+		return nil, err
+	}
+	iv := make([]byte, semiblock)
+	copy(iv, padIV)
+	binary.BigEndian.PutUint32(iv[4:], uint32(len(plaintext)))
+	padded := make([]byte, (len(plaintext)+semiblock-1)/semiblock*semiblock)
+	copy(padded, plaintext)
+	if len(padded) == semiblock {
+		return encrypt(c, kek, append(iv, padded...)), nil
+	}
+	return wrap(c, kek, iv, padded), nil
+}
+
+// UnwrapPad unwraps the wrapped key with the key encryption key, as specified by RFC 5649,
+// removing the padding. Returns ErrIntegrity if the integrity check fails, without any key data.
+func UnwrapPad(cf cipher.CipherFactory, kek []byte, ciphertext []byte) ([]byte, error) {
+	if len(ciphertext) < 2*semiblock || len(ciphertext)%semiblock != 0 {
+		return nil, ErrInputSize
+	}
+	c, err := newCipher(cf, kek)
+	if err != nil {
+		return nil, err
+	}
+	var a, r []byte
+	if len(ciphertext) == 2*semiblock {
+		b := decrypt(c, kek, ciphertext)
+		a, r = b[:semiblock], b[semiblock:]
+	} else {
+		a, r = unwrap(c, kek, ciphertext)
+	}
+	// Check the constant prefix, that the length falls within the last semiblock, and that the
+	// padding is zeros
+	n := binary.BigEndian.Uint32(a[4:])
+	if subtle.ConstantTimeCompare(a[:4], padIV) != 1 || n <= uint32(len(r)-semiblock) || n > uint32(len(r)) {
+		return nil, ErrIntegrity
+	}
+	var pad byte
+	for _, b := range r[n:] {
+		pad |= b
+	}
+	if pad != 0 {
+		return nil, ErrIntegrity
+	}
+	return r[:n], nil
+}
+
+// newCipher creates a block cipher with the key encryption key expanded.
+func newCipher(cf cipher.CipherFactory, kek []byte) (*cipher.Cipher, error) {
+	c, err := cf()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Expand(kek); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// encrypt returns the encryption of the block.
+func encrypt(c *cipher.Cipher, kek []byte, b []byte) []byte {
+	s := c.Encrypt(*state.NewStateFromBytes(b), kek)
+	return s.GetBytes()
+}
+
+// decrypt returns the decryption of the block.
+func decrypt(c *cipher.Cipher, kek []byte, b []byte) []byte {
+	s := c.Decrypt(*state.NewStateFromBytes(b), kek)
+	return s.GetBytes()
+}
+
+// wrap runs the wrapping function W on the semiblocks of the plaintext with the initial value,
+// running 6 rounds of encryptions over all of them, the step number xored into the integrity value.
+func wrap(c *cipher.Cipher, kek []byte, iv []byte, plaintext []byte) []byte {
+	n := len(plaintext) / semiblock
+	a := append([]byte{}, iv...)
+	r := append([]byte{}, plaintext...)
+	for j := 0; j < 6; j++ {
+		for i := 0; i < n; i++ {
+			b := encrypt(c, kek, append(a, r[i*semiblock:(i+1)*semiblock]...))
+			a = xorStep(b[:semiblock], uint64(n*j+i+1))
+			copy(r[i*semiblock:], b[semiblock:])
+		}
+	}
+	return append(a, r...)
+}
+
+// unwrap runs the unwrapping function W^-1 on the semiblocks of the cipher text, the inverse of wrap.
+// Returns the integrity value, to be checked against the initial value, and the plaintext.
+func unwrap(c *cipher.Cipher, kek []byte, ciphertext []byte) ([]byte, []byte) {
+	n := len(ciphertext)/semiblock - 1
+	a := append([]byte{}, ciphertext[:semiblock]...)
+	r := append([]byte{}, ciphertext[semiblock:]...)
+	for j := 5; j >= 0; j-- {
+		for i := n - 1; i >= 0; i-- {
+			b := decrypt(c, kek, append(xorStep(a, uint64(n*j+i+1)), r[i*semiblock:(i+1)*semiblock]...))
+			a = b[:semiblock]
+			copy(r[i*semiblock:], b[semiblock:])
+		}
+	}
+	return a, r
+}
+
+// xorStep returns the semiblock xored with the step number as a big endian integer.
+func xorStep(a []byte, t uint64) []byte {
+	out := make([]byte, semiblock)
+	binary.BigEndian.PutUint64(out, t)
+	for i := range out {
+		out[i] ^= a[i]
+	}
+	return out
+}
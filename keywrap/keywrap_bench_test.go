@@ -0,0 +1,27 @@
+package keywrap
+
+import (
+	"testing"
+
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+func BenchmarkWrap(b *testing.B) {
+	kek := rand.GetRand(16)
+	cf := newCipherFactory(kek)
+	key := rand.GetRand(32)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Wrap(cf, kek, key)
+	}
+}
+
+func BenchmarkUnwrap(b *testing.B) {
+	kek := rand.GetRand(16)
+	cf := newCipherFactory(kek)
+	w, _ := Wrap(cf, kek, rand.GetRand(32))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		Unwrap(cf, kek, w)
+	}
+}
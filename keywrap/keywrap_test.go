@@ -0,0 +1,147 @@
+package keywrap
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+// newCipherFactory returns a cipher factory for block ciphers matching the size of the key
+// encryption key, running with the table engine.
+func newCipherFactory(kek []byte) cipher.CipherFactory {
+	return func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CipherKeySize(len(kek)*8), cipher.TableEngine)
+	}
+}
+
+// Test vectors from RFC 3394, section 4.
+var vectors = []struct {
+	kek, key, wrapped string
+}{
+	{ // 4.1 128 bits of key data with a 128 bit key encryption key
+		"000102030405060708090a0b0c0d0e0f",
+		"00112233445566778899aabbccddeeff",
+		"1fa68b0a8112b447aef34bd8fb5a7b829d3e862371d2cfe5",
+	},
+	{ // 4.2 128 bits of key data with a 192 bit key encryption key
+		"000102030405060708090a0b0c0d0e0f1011121314151617",
+		"00112233445566778899aabbccddeeff",
+		"96778b25ae6ca435f92b5b97c050aed2468ab8a17ad84e5d",
+	},
+	{ // 4.3 128 bits of key data with a 256 bit key encryption key
+		"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		"00112233445566778899aabbccddeeff",
+		"64e8c3f9ce0f5ba263e9777905818a2a93c8191e7d6e8ae7",
+	},
+	{ // 4.4 192 bits of key data with a 192 bit key encryption key
+		"000102030405060708090a0b0c0d0e0f1011121314151617",
+		"00112233445566778899aabbccddeeff0001020304050607",
+		"031d33264e15d33268f24ec260743edce1c6c7ddee725a936ba814915c6762d2",
+	},
+	{ // 4.5 192 bits of key data with a 256 bit key encryption key
+		"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		"00112233445566778899aabbccddeeff0001020304050607",
+		"a8f9bc1612c68b3ff6e6f4fbe30e71e4769c8b80a32cb8958cd5d17d6b254da1",
+	},
+	{ // 4.6 256 bits of key data with a 256 bit key encryption key
+		"000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		"00112233445566778899aabbccddeeff000102030405060708090a0b0c0d0e0f",
+		"28c9f404c4b810f4cbccb35cfb87f8263f5786e2d80ed326cbc7f0e71a99f43bfb988b9b7a02dd21",
+	},
+}
+
+// Test vectors from RFC 5649, section 6.
+var padVectors = []struct {
+	kek, key, wrapped string
+}{
+	{ // 20 octets of key data
+		"5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8",
+		"c37b7e6492584340bed12207808941155068f738",
+		"138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a",
+	},
+	{ // 7 octets of key data
+		"5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8",
+		"466f7250617369",
+		"afbeb0f07dfbf5419200f2ccb50bb24f",
+	},
+}
+
+// vectorTest wraps the key data of each vector and checks the wrapped key, then unwraps it back.
+func vectorTest(t *testing.T, wrap, unwrap func(cipher.CipherFactory, []byte, []byte) ([]byte, error),
+	vectors []struct{ kek, key, wrapped string }) {
+	for i, v := range vectors {
+		kek, _ := hex.DecodeString(v.kek)
+		key, _ := hex.DecodeString(v.key)
+		cf := newCipherFactory(kek)
+		w, err := wrap(cf, kek, key)
+		if err != nil {
+			t.Fatalf("Vector %d wrap failed with %v", i, err)
+		}
+		if x := hex.EncodeToString(w); x != v.wrapped {
+			t.Errorf("Vector %d wrap failed with %s, expected %s", i, x, v.wrapped)
+		}
+		if x, err := unwrap(cf, kek, w); err != nil || !bytes.Equal(x, key) {
+			t.Errorf("Vector %d unwrap failed with %x, %v", i, x, err)
+		}
+		w[len(w)-1] ^= 0x01
+		if _, err := unwrap(cf, kek, w); err != ErrIntegrity {
+			t.Errorf("Vector %d unwrap of modified key failed with %v", i, err)
+		}
+	}
+}
+
+func TestVectors(t *testing.T) {
+	vectorTest(t, Wrap, Unwrap, vectors)
+}
+
+func TestPadVectors(t *testing.T) {
+	vectorTest(t, WrapPad, UnwrapPad, padVectors)
+}
+
+// TestPadLengths tests that key data of every length up to a few semiblocks is unwrapped, and that
+// a key wrapped without padding does not unwrap with the padded variant.
+func TestPadLengths(t *testing.T) {
+	kek := rand.GetRand(16)
+	cf := newCipherFactory(kek)
+	for n := 1; n <= 4*semiblock; n++ {
+		key := rand.GetRand(n)
+		w, err := WrapPad(cf, kek, key)
+		if err != nil {
+			t.Fatalf("Wrap of %d bytes failed with %v", n, err)
+		}
+		if x, err := UnwrapPad(cf, kek, w); err != nil || !bytes.Equal(x, key) {
+			t.Errorf("Unwrap of %d bytes failed with %x, %v", n, x, err)
+		}
+	}
+	w, _ := Wrap(cf, kek, rand.GetRand(16))
+	if _, err := UnwrapPad(cf, kek, w); err != ErrIntegrity {
+		t.Errorf("Unwrap with padding of key wrapped without padding failed with %v", err)
+	}
+}
+
+// TestErrors tests that invalid input sizes and key encryption keys are returned as errors.
+func TestErrors(t *testing.T) {
+	kek := rand.GetRand(16)
+	cf := newCipherFactory(kek)
+	if _, err := Wrap(cf, kek, rand.GetRand(8)); err != ErrInputSize {
+		t.Errorf("Wrap of a single semiblock failed with %v", err)
+	}
+	if _, err := Wrap(cf, kek, rand.GetRand(20)); err != ErrInputSize {
+		t.Errorf("Wrap of partial semiblock failed with %v", err)
+	}
+	if _, err := Unwrap(cf, kek, rand.GetRand(16)); err != ErrInputSize {
+		t.Errorf("Unwrap of two semiblocks failed with %v", err)
+	}
+	if _, err := WrapPad(cf, kek, nil); err != ErrInputSize {
+		t.Errorf("Wrap with padding of empty key data failed with %v", err)
+	}
+	if _, err := UnwrapPad(cf, kek, rand.GetRand(12)); err != ErrInputSize {
+		t.Errorf("Unwrap with padding of partial semiblock failed with %v", err)
+	}
+	if _, err := Wrap(cf, rand.GetRand(32), rand.GetRand(16)); err != cipher.ErrKeySize {
+		t.Errorf("Wrap with mismatched key encryption key failed with %v", err)
+	}
+}
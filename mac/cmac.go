@@ -0,0 +1,127 @@
+package mac
+
+import (
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/state"
+)
+
+const Size int = 16      // size of a CMAC tag in bytes
+const BlockSize int = 16 // size of the blocks processed by CMAC in bytes
+
+// CMAC keeps the state of a cipher-based message authentication code computation, as specified
+// by RFC 4493 and NIST SP 800-38B. Blocks are chained like CBC encryption with a zero initialization
+// vector, the last block being xored with one of two subkeys derived from the cipher key.
+type CMAC struct {
+	cipher *cipher.Cipher // block cipher instance
+	ck     []byte         // cipher key
+	k1     []byte         // subkey for a complete last block
+	k2     []byte         // subkey for a padded last block
+	x      []byte         // chaining value of the processed blocks
+	buf    []byte         // unprocessed data, held back until more is written as it may be the last block
+}
+
+// NewCMAC creates a new CMAC instance keyed by the cipher key, using a block cipher created by the
+// cipher factory. Returns an error if the block cipher can not be created or the cipher key is invalid.
+func NewCMAC(cf cipher.CipherFactory, ck []byte) (*CMAC, error) {
+	c, err := cf()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Expand(ck); err != nil {
+		return nil, err
+	}
+	m := &CMAC{
+		cipher: c,
+		ck:     ck,
+		x:      make([]byte, BlockSize),
+		buf:    make([]byte, 0, BlockSize),
+	}
+	m.k1 = shiftSubkey(m.encrypt(make([]byte, BlockSize)))
+	m.k2 = shiftSubkey(m.k1)
+	return m, nil
+}
+
+// shiftSubkey derives a subkey by shifting the input one bit to the left as a big endian integer,
+// xoring the constant 0x87 into the last byte if the most significant bit was set.
+func shiftSubkey(in []byte) []byte {
+	out := make([]byte, len(in))
+	for i := range in {
+		out[i] = in[i] << 1
+		if i+1 < len(in) {
+			out[i] |= in[i+1] >> 7
+		}
+	}
+	out[len(out)-1] ^= 0x87 & -(in[0] >> 7)
+	return out
+}
+
+// encrypt returns the encryption of the block with the block cipher.
+func (m *CMAC) encrypt(block []byte) []byte {
+	s := m.cipher.Encrypt(*state.NewStateFromBytes(block), m.ck)
+	return s.GetBytes()
+}
+
+// chain xors the block into the chaining value and encrypts it.
+func (m *CMAC) chain(x []byte, block []byte) []byte {
+	b := make([]byte, BlockSize)
+	for i := range b {
+		b[i] = x[i] ^ block[i]
+	}
+	return m.encrypt(b)
+}
+
+// Write adds more data to the running tag, never returns an error.
+func (m *CMAC) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		if len(m.buf) == BlockSize { // more data follows so the buffered block is not the last
+			m.x = m.chain(m.x, m.buf)
+			m.buf = m.buf[:0]
+		}
+		k := BlockSize - len(m.buf)
+		if k > len(p) {
+			k = len(p)
+		}
+		m.buf = append(m.buf, p[:k]...)
+		p = p[k:]
+	}
+	return n, nil
+}
+
+// Sum appends the tag of the data written so far to b, does not change the running tag.
+// A complete last block is xored with the first subkey, otherwise the last block is padded with
+// a single one bit followed by zeros and xored with the second subkey.
+func (m *CMAC) Sum(b []byte) []byte {
+	last := make([]byte, BlockSize)
+	copy(last, m.buf)
+	k := m.k1
+	if len(m.buf) < BlockSize {
+		last[len(m.buf)] = 0x80
+		k = m.k2
+	}
+	for i := range last {
+		last[i] ^= k[i]
+	}
+	return append(b, m.chain(m.x, last)...)
+}
+
+// Verify returns whether the tag matches the data written so far, in constant time.
+func (m *CMAC) Verify(tag []byte) bool {
+	return Equal(m.Sum(nil), tag)
+}
+
+// Reset resets the running tag to its initial state, keeping the cipher key.
+func (m *CMAC) Reset() {
+	m.x = make([]byte, BlockSize)
+	m.buf = m.buf[:0]
+}
+
+// Size returns the size of the tag in bytes.
+func (m *CMAC) Size() int {
+	return Size
+}
+
+// BlockSize returns the block size of the underlying block cipher in bytes.
+func (m *CMAC) BlockSize() int {
+	return BlockSize
+}
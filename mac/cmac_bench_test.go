@@ -0,0 +1,22 @@
+package mac
+
+import (
+	"testing"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+func BenchmarkCMAC(b *testing.B) {
+	m, err := NewCMAC(newCipherFactory(cipher.TableEngine), rand.GetRand(16))
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := rand.GetRand(1024)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		m.Write(data)
+	}
+	m.Sum(nil)
+}
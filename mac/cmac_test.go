@@ -0,0 +1,112 @@
+package mac
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+// Example vectors from RFC 4493, section 4, for AES-128.
+const vectorKey = "2b7e151628aed2a6abf7158809cf4f3c"
+
+const vectorMessage = "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51" +
+	"30c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710"
+
+var vectors = []struct {
+	length int // length of the message in bytes, a prefix of the vector message
+	tag    string
+}{
+	{0, "bb1d6929e95937287fa37d129b756746"},
+	{16, "070a16b46b4d4144f79bdd9dd04a287c"},
+	{40, "dfa66747de9ae63030ca32611497c827"},
+	{64, "51f0bebf7e3b9d92fc49741779363cfe"},
+}
+
+// newCipherFactory returns a cipher factory for 128 bit block ciphers running with the engine.
+func newCipherFactory(e cipher.Engine) cipher.CipherFactory {
+	return func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, e)
+	}
+}
+
+func TestSubkeys(t *testing.T) {
+	ck, _ := hex.DecodeString(vectorKey)
+	m, err := NewCMAC(newCipherFactory(cipher.TableEngine), ck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if x := hex.EncodeToString(m.k1); x != "fbeed618357133667c85e08f7236a8de" {
+		t.Errorf("First subkey failed with %s", x)
+	}
+	if x := hex.EncodeToString(m.k2); x != "f7ddac306ae266ccf90bc11ee46d513b" {
+		t.Errorf("Second subkey failed with %s", x)
+	}
+}
+
+func TestVectors(t *testing.T) {
+	ck, _ := hex.DecodeString(vectorKey)
+	msg, _ := hex.DecodeString(vectorMessage)
+	for _, e := range []cipher.Engine{cipher.StepEngine, cipher.TableEngine, cipher.BitslicedEngine} {
+		m, err := NewCMAC(newCipherFactory(e), ck)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, v := range vectors {
+			m.Reset()
+			m.Write(msg[:v.length])
+			if x := hex.EncodeToString(m.Sum(nil)); x != v.tag {
+				t.Errorf("Tag of %d bytes with engine %d failed with %s, expected %s", v.length, e, x, v.tag)
+			}
+			tag, _ := hex.DecodeString(v.tag)
+			if !m.Verify(tag) {
+				t.Errorf("Verify of %d bytes with engine %d failed", v.length, e)
+			}
+		}
+	}
+}
+
+// TestHash tests that the tag does not depend on how the data is split between writes, and that
+// Sum appends without changing the running tag.
+func TestHash(t *testing.T) {
+	ck := rand.GetRand(16)
+	data := rand.GetRand(100)
+	m, err := NewCMAC(newCipherFactory(cipher.TableEngine), ck)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var mac MAC = m
+	mac.Write(data)
+	expected := mac.Sum(nil)
+	for _, n := range []int{1, 15, 16, 17, 33} {
+		mac.Reset()
+		for p := data; len(p) > 0; {
+			k := n
+			if k > len(p) {
+				k = len(p)
+			}
+			mac.Write(p[:k])
+			p = p[k:]
+			mac.Sum(nil)
+		}
+		if x := mac.Sum([]byte{0x01}); !bytes.Equal(x[1:], expected) || x[0] != 0x01 {
+			t.Errorf("Tag with writes of %d bytes failed with %s", n, hex.EncodeToString(x))
+		}
+	}
+	if mac.Size() != Size || mac.BlockSize() != BlockSize {
+		t.Errorf("Size or block size failed")
+	}
+	expected[0] ^= 0x01
+	if mac.Verify(expected) {
+		t.Errorf("Verify of modified tag should fail")
+	}
+}
+
+// TestErrors tests that an invalid cipher key is returned as an error.
+func TestErrors(t *testing.T) {
+	if _, err := NewCMAC(newCipherFactory(cipher.TableEngine), rand.GetRand(24)); err != cipher.ErrKeySize {
+		t.Errorf("Mismatched cipher key size failed with %v", err)
+	}
+}
@@ -0,0 +1,22 @@
+package mac
+
+import (
+	"crypto/subtle"
+	"errors"
+	"hash"
+)
+
+// ErrVerification is returned when a tag does not match the message.
+var ErrVerification = errors.New("mac : message authentication failed")
+
+// MAC is a keyed hash that produces message authentication tags, written to like any hash.Hash.
+type MAC interface {
+	hash.Hash
+	// Verify returns whether the tag matches the data written so far, in constant time.
+	Verify(tag []byte) bool
+}
+
+// Equal compares two tags in constant time, returns whether they are equal.
+func Equal(tag1, tag2 []byte) bool {
+	return subtle.ConstantTimeCompare(tag1, tag2) == 1
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io"
@@ -11,7 +12,14 @@ import (
 	"github.com/emil2k/go-aes/cipher"
 	"github.com/emil2k/go-aes/modes"
 	"github.com/emil2k/go-aes/modes/cbc"
+	"github.com/emil2k/go-aes/modes/ccm"
+	"github.com/emil2k/go-aes/modes/cfb"
+	"github.com/emil2k/go-aes/modes/chunked"
 	"github.com/emil2k/go-aes/modes/ctr"
+	"github.com/emil2k/go-aes/modes/gcm"
+	"github.com/emil2k/go-aes/modes/ofb"
+	"github.com/emil2k/go-aes/modes/siv"
+	"github.com/emil2k/go-aes/modes/xts"
 	"github.com/emil2k/go-aes/util/rand"
 )
 
@@ -19,7 +27,20 @@ import (
 const help string = `
 Encrypt and decrypt files using an AES block cipher.
 
-%s [ -d | -v | -vv ] [-mode mode] [-size size] key_file input_file output_file
+%s [ -d | -v | -vv | -progress ] [-mode mode] [-padding padding] [-auth mac] [-size size] [-range start:length] [-engine engine] key_file input_file output_file
+%s [ -d | -v | -vv | -progress ] [-mode mode] [-padding padding] [-auth mac] [-size size] [-range start:length] [-engine engine] -password password | -passfile file input_file output_file
+%s mac [ -v | -vv ] [-size size] [-engine engine] key_file input_file tag_file
+%s verify-mac [ -v | -vv ] [-engine engine] key_file input_file tag_file
+%s wrap [ -v | -vv ] [-engine engine] kek_file key_file wrapped_file
+%s unwrap [ -v | -vv ] [-engine engine] kek_file wrapped_file key_file
+
+The mac command tags the input with AES-CMAC, generating the key file if it does not exist, and
+the verify-mac command checks the tag. The wrap command wraps a key file under the key encryption
+key in kek_file with AES key wrap, and the unwrap command restores it.
+
+Use - as the input_file or output_file to read from standard input or write to standard output.
+Only ctr and cbc are streamed, other modes read the whole input into memory first, so the memory
+used grows with the size of the input.
 
 `
 
@@ -34,46 +55,100 @@ var args CommandArguments // holds the command parameters for the current execut
 type CommandArguments struct {
 	verbose     bool   // whether to log verbose output
 	veryVerbose bool   // whether to log very verbose ouput, including info from block cipher
+	command     string // subcommand to run, empty for encryption or decryption
 	isDecrypt   bool   // whether decrypting
 	mode        string // string identifier for the block cipher mode
+	padding     string // string identifier for the padding scheme, empty for the default of the mode
+	auth        string // string identifier for the message authentication code, empty for none
+	engine      string // string identifier for the block cipher engine, empty to choose based on verbosity
 	keySize     uint64 // cipher key size in bits
-	key         string // the file path for the cipher key, encryption will generate a cipher key at the location
+	key         string // the file path for the cipher key, encryption will generate a cipher key at the location, the key encryption key for the wrap commands
+	password    string // password to derive the cipher key from, instead of a key file
+	passfile    string // the file path for the password to derive the cipher key from, instead of a key file
 	input       string // the file path for the input
-	output      string // the file path for the output
+	output      string // the file path for the output, the tag for the mac commands
+	byteRange   string // byte range of the plaintext to decrypt, start:length, empty for all
+	progress    bool   // whether to show a progress bar on standard error
 }
 
 // init setups the command flags.
 func init() {
-	defer fatalPanic()
 	prepareFlags()
 }
 
-// main executes the main branch of the command.
+// main executes the main branch of the command, exiting with code 1 on any error.
 func main() {
-	defer fatalPanic()
-	// Parse and validate the command flags
-	flag.Parse()
+	if err := execute(); err != nil {
+		errorLog.Fatalln(err)
+	}
+}
+
+// execute parses and validates the command flags, then runs the encryption or decryption.
+func execute() error {
+	// Parse and validate the command flags, which follow the subcommand if any
+	args.command = ""
+	if len(os.Args) > 1 && isSubcommand(os.Args[1]) {
+		args.command = os.Args[1]
+		flag.CommandLine.Parse(os.Args[2:])
+	} else {
+		flag.Parse()
+	}
 	if args.veryVerbose {
 		args.verbose = true
 	}
-	prepareLogs() // instantiates any verbose logs
-	if len(flag.Args()) < 3 {
-		panic("must specify the key, input, output paths for both encryption and decrytption")
+	if args.command != "" {
+		if usePassword() {
+			return fmt.Errorf("the %s command requires a key file, not a password", args.command)
+		} else if len(flag.Args()) < 3 {
+			return fmt.Errorf("must specify the key, input, output paths for the %s command", args.command)
+		}
+		args.key, args.input, args.output = flag.Args()[0], flag.Args()[1], flag.Args()[2]
+	} else if usePassword() {
+		if len(flag.Args()) < 2 {
+			return errors.New("must specify the input, output paths for both encryption and decryption with a password")
+		}
+		args.key, args.input, args.output = "", flag.Args()[0], flag.Args()[1]
+	} else if len(flag.Args()) < 3 {
+		return errors.New("must specify the key, input, output paths for both encryption and decrytption")
+	} else {
+		args.key, args.input, args.output = flag.Args()[0], flag.Args()[1], flag.Args()[2]
 	}
-	args.key, args.input, args.output = flag.Args()[0], flag.Args()[1], flag.Args()[2]
+	prepareLogs() // instantiates any verbose logs
+	verboseLog.Println("command : ", args.command)
 	verboseLog.Println("verbose : ", args.verbose)
 	verboseLog.Println("very verbose : ", args.veryVerbose)
 	verboseLog.Println("mode : ", args.mode)
+	verboseLog.Println("auth : ", args.auth)
 	verboseLog.Println("key size : ", args.keySize)
+	verboseLog.Println("engine : ", args.engine)
 	verboseLog.Println("is decryption? : ", args.isDecrypt)
 	verboseLog.Println("key : ", args.key)
 	verboseLog.Println("output : ", args.output)
 	verboseLog.Println("input : ", args.input)
-	// Execute encryption or decryption
+	// Execute the subcommand, encryption, or decryption
+	switch args.command {
+	case macCommand:
+		return tagInput()
+	case verifyMACCommand:
+		return verifyInput()
+	case wrapCommand:
+		return wrapKeyFile()
+	case unwrapCommand:
+		return unwrapKeyFile()
+	}
 	if args.isDecrypt {
-		decrypt()
-	} else {
-		encrypt()
+		return decrypt()
+	}
+	return encrypt()
+}
+
+// isSubcommand returns whether the argument names a subcommand, which is followed by its flags.
+func isSubcommand(name string) bool {
+	switch name {
+	case macCommand, verifyMACCommand, wrapCommand, unwrapCommand:
+		return true
+	default:
+		return false
 	}
 }
 
@@ -82,161 +157,417 @@ func prepareFlags() {
 	// Set the usage string, displayed when help is run
 	flag.Usage = func() {
 		command := os.Args[0]
-		fmt.Fprintf(os.Stderr, help, command)
+		fmt.Fprintf(os.Stderr, help, command, command, command, command, command, command)
 		flag.PrintDefaults()
 		fmt.Fprintln(os.Stderr, "\n~~ by Emil ~~\n")
 	}
 	// Setup the command flags
 	flag.BoolVar(&args.verbose, "v", false, "verbose output, debugging from block cipher mode")
-	flag.BoolVar(&args.veryVerbose, "vv", false, "very verbose output, includes debugging from block cipher")
+	flag.BoolVar(&args.veryVerbose, "vv", false, "very verbose output, includes debugging from block cipher rounds run step by step")
 	flag.BoolVar(&args.isDecrypt, "d", false, "whether in encryption mode")
-	flag.StringVar(&args.mode, "mode", "ctr", "block cipher mode, `ctr` for counter or `cbc` for chain-block chaining")
-	flag.Uint64Var(&args.keySize, "size", 128, "cipher key size in bits, for encryption only")
+	flag.StringVar(&args.mode, "mode", "ctr", "block cipher mode, `ctr` for counter, `cbc` for chain-block chaining, `cbc-cs1`, `cbc-cs2`, or `cbc-cs3` for length preserving chain-block chaining with ciphertext stealing, `gcm` for authenticated galois/counter, `ccm` for authenticated counter with CBC-MAC, `siv` for authenticated synthetic initialization vector resisting nonce reuse, `cfb` or `cfb8` for cipher feedback, `ofb` for output feedback, `xts` for length preserving sectors, or `chunked` for galois/counter authenticated chunks of large files, for encryption only")
+	flag.StringVar(&args.padding, "padding", "", "padding scheme, `pkcs7`, `x923` for ANSI X.923, `iso7816` for ISO/IEC 7816-4, `zero`, or `none` to preserve the length with ctr, cfb, cfb8, and ofb, defaults to `none` for ctr otherwise `pkcs7`, for encryption with ctr, cbc, cfb, cfb8, and ofb only")
+	flag.StringVar(&args.auth, "auth", "", "authenticate the header and cipher text with encrypt-then-MAC, `hmac` for HMAC-SHA256 or `cmac` for AES-CMAC, for encryption with unauthenticated modes only")
+	flag.Uint64Var(&args.keySize, "size", 128, "cipher key size in bits, doubled in the key file for xts and siv, for encryption only")
+	flag.StringVar(&args.password, "password", "", "password to derive the cipher key from instead of a key file, visible to other users of the system so prefer -passfile")
+	flag.StringVar(&args.passfile, "passfile", "", "file containing the password to derive the cipher key from instead of a key file, only the first line is used")
+	flag.BoolVar(&args.progress, "progress", false, "show a progress bar with the throughput and time remaining on standard error, except when streaming ctr or cbc")
+	flag.StringVar(&args.byteRange, "range", "", "decrypt only the byte range `start:length` of the plaintext, omit the length to decrypt to the end, for decryption of files encrypted with ctr only")
+	flag.StringVar(&args.engine, "engine", "", "block cipher engine, `table` for lookup tables, `bitsliced` for constant time rounds, or `step` for debugging, defaults to `step` when very verbose otherwise `table`")
 }
 
 // prepareLogs initiates the different logs based on the verbose parameters.
+// Logs are written to standard error when the output is written to standard output.
 func prepareLogs() {
+	var out io.Writer = os.Stdout
+	if args.output == stdPath {
+		out = os.Stderr
+	}
+	standardLog = log.New(out, "", 0)
 	if args.verbose {
-		verboseLog = log.New(os.Stdout, "debug : ", 0)
+		verboseLog = log.New(out, "debug : ", 0)
 	} else {
 		verboseLog = log.New(ioutil.Discard, "", 0)
 	}
 	if args.veryVerbose {
-		veryVerboseLog = log.New(os.Stdout, "debug : ", 0)
+		veryVerboseLog = log.New(out, "debug : ", 0)
 	} else {
 		veryVerboseLog = log.New(ioutil.Discard, "", 0)
 	}
 }
 
-// encrypt executes the encrypting branch of the command.
-func encrypt() {
-	checkKeySize(args.keySize)
-	kfile, ifile, ofile := createFile(args.key), openFile(args.input), createFile(args.output)
-	defer closeFile(kfile)
+// encrypt executes the encrypting branch of the command. The output is removed if encryption fails
+// once it is created, so no truncated cipher text is left behind.
+func encrypt() (err error) {
+	if err := checkKeySize(args.keySize); err != nil {
+		return err
+	}
+	if !usePassword() && args.key == stdPath {
+		return errors.New("cipher key must be stored in a file")
+	}
+	// Setup the appropriate block cipher mode
+	modeID, err := parseMode(args.mode)
+	if err != nil {
+		return err
+	}
+	cf, err := getCipherFactory()
+	if err != nil {
+		return err
+	}
+	mode, nonceSize, err := getMode(cf, modeID)
+	if err != nil {
+		return err
+	}
+	if err := choosePadding(mode, modeID); err != nil {
+		return err
+	}
+	authID, err := parseAuth(args.auth)
+	if err != nil {
+		return err
+	}
+	if _, ok := mode.(modes.AuthModeInterface); ok && authID != noAuth {
+		return fmt.Errorf("mode %s is already authenticated", args.mode)
+	}
+	ifile, err := openInput(args.input)
+	if err != nil {
+		return err
+	}
 	defer closeFile(ifile)
+	ofile, err := createOutput(args.output)
+	if err != nil {
+		return err
+	}
 	defer closeFile(ofile)
+	defer func() {
+		if err != nil {
+			removeFile(ofile)
+		}
+	}()
 	// Initiate data
-	ck := rand.GetRand(int(args.keySize / 8)) // generate random cipher key
-	// Setup and run the appropriate block cipher mode
-	var nonce []byte
-	var mode modes.ModeInterface
-	switch args.mode {
-	case "ctr", "cm", "icm", "sic":
-		verboseLog.Println("counter mode chosen")
-		nonce = rand.GetRand(8)
-		mode = ctr.NewCounter(getCipherFactory())
-	case "cbc":
-		verboseLog.Println("chain-block chaining mode chosen")
-		nonce = rand.GetRand(16)
-		mode = cbc.NewChain(getCipherFactory())
-	default:
-		panic("unknown mode chosen")
+	h := newHeader(modeID, args.keySize, rand.GetRand(nonceSize))
+	h.auth = authID
+	h.padding = paddingID(mode.Padding())
+	key, err := newCipherKey(h)
+	if err != nil {
+		return err
+	}
+	ck, mk := splitKey(h, key)
+	m, err := newAuthMAC(h, mk)
+	if err != nil {
+		return err
+	}
+	prepareMode(mode, h)
+	if err := prepareOutput(ofile, h); err != nil {
+		return err
+	}
+	// Run the encryption, followed by the tag if authenticated
+	if isStream() {
+		var out io.Writer = ofile
+		if m != nil {
+			out = io.MultiWriter(ofile, m)
+		}
+		if err := encryptStream(modeID, mode, cf, ifile, out, ck, h.nonce); err != nil {
+			return err
+		}
+	} else {
+		size, err := getFileSize(args.input)
+		if err != nil {
+			return err
+		}
+		if err := mode.Encrypt(h.size(), uint64(size), ifile, ofile, ck, h.nonce); err != nil {
+			return err
+		}
+		if m != nil {
+			if err := hashOutput(ofile, h, m); err != nil {
+				return err
+			}
+		}
+	}
+	if m != nil {
+		if err := writeToFile(ofile, m.Sum(nil)...); err != nil {
+			return err
+		}
 	}
-	prepareMode(mode)
-	prepareOutput(ofile, nonce)
-	// Run the encryption
-	mode.Encrypt(uint64(len(nonce)+1), uint64(getFileSize(args.input)), ifile, ofile, ck, nonce)
 	standardLog.Println("encryption stored in", ofile.Name())
-	writeToFile(kfile, ck...)
+	if usePassword() {
+		return nil
+	}
+	kfile, err := createFile(args.key)
+	if err != nil {
+		return err
+	}
+	defer closeFile(kfile)
+	if err := writeToFile(kfile, key...); err != nil {
+		return err
+	}
 	standardLog.Println("cipher key stored in", kfile.Name())
+	return nil
 }
 
 // decrypt executes the decrypting branch of the command.
-func decrypt() {
-	// Check cipher key size
-	kfile := openFile(args.key)
-	defer closeFile(kfile)
-	if info, err := kfile.Stat(); err != nil {
-		panic(err)
-	} else if !info.Mode().IsRegular() {
-		panic("key file is not a regular file")
-	} else {
-		args.keySize = uint64(info.Size()) * 8
-		checkKeySize(args.keySize)
+func decrypt() error {
+	ifile, err := openInput(args.input)
+	if err != nil {
+		return err
 	}
-	ifile, ofile := openFile(args.input), createFile(args.output)
 	defer closeFile(ifile)
-	defer closeFile(ofile)
 	// Initiate data
-	ck := readFromFile(kfile)
-	nonce := processInput(ifile)
-	// Setup and run the appropriate block cipher mode
-	var mode modes.ModeInterface
-	switch args.mode {
-	case "ctr", "cm", "icm", "sic":
+	h, err := processInput(ifile)
+	if err != nil {
+		return err
+	}
+	args.keySize = h.keySize
+	key, err := readCipherKey(h)
+	if err != nil {
+		return err
+	}
+	ck, mk := splitKey(h, key)
+	// Setup the block cipher mode described by the header
+	cf, err := getCipherFactory()
+	if err != nil {
+		return err
+	}
+	mode, _, err := getMode(cf, h.mode)
+	if err != nil {
+		return err
+	}
+	p, err := getPadding(h.padding)
+	if err != nil {
+		return err
+	}
+	mode.SetPadding(p)
+	prepareMode(mode, h)
+	var start, length uint64
+	if args.byteRange != "" {
+		if start, length, err = checkRange(h); err != nil {
+			return err
+		}
+	}
+	// Verify the tag of authenticated input before creating the output
+	var in io.Reader = ifile
+	var size uint64
+	if args.input != stdPath {
+		fsize, err := getFileSize(args.input)
+		if err != nil {
+			return err
+		}
+		size = uint64(fsize) - h.size()
+	}
+	if m, err := newAuthMAC(h, mk); err != nil {
+		return err
+	} else if m != nil {
+		if in, size, err = authenticate(ifile, h, m, size); err != nil {
+			return err
+		}
+		verboseLog.Println("input authenticated")
+	}
+	ofile, err := createOutput(args.output)
+	if err != nil {
+		return err
+	}
+	defer closeFile(ofile)
+	// Run the decryption, removing the output if it fails so no unverified plaintext is left behind,
+	// such as the chunks preceding a modified chunk
+	if args.byteRange != "" {
+		err = decryptRange(mode.(*ctr.Counter), ifile, ofile, h, size, ck, start, length)
+	} else if isStream() {
+		err = decryptStream(h.mode, mode, cf, in, ofile, ck, h.nonce)
+	} else {
+		err = mode.Decrypt(h.size(), size, ifile, ofile, ck, h.nonce)
+	}
+	if err != nil {
+		removeFile(ofile)
+		return err
+	}
+	standardLog.Println("decryption stored in", ofile.Name())
+	return nil
+}
+
+// checkKeySize checks the passed key size in bits, returns an error if invalid cipher key size.
+func checkKeySize(k uint64) error {
+	switch cipher.CipherKeySize(k) {
+	case cipher.CK128, cipher.CK192, cipher.CK256:
+		return nil
+	default:
+		return fmt.Errorf("invalid cipher key size %d bits", k)
+	}
+}
+
+// getMode returns the block cipher mode for the mode identifier, along with the size of the nonce
+// or initialization vector it requires in bytes.
+func getMode(cf cipher.CipherFactory, id byte) (mode modes.ModeInterface, nonceSize int, err error) {
+	switch id {
+	case ctrMode:
 		verboseLog.Println("counter mode chosen")
-		mode = ctr.NewCounter(getCipherFactory())
-	case "cbc":
+		return ctr.NewCounter(cf), 8, nil
+	case cbcMode:
 		verboseLog.Println("chain-block chaining mode chosen")
-		mode = cbc.NewChain(getCipherFactory())
+		return cbc.NewChain(cf), 16, nil
+	case gcmMode:
+		verboseLog.Println("galois/counter mode chosen")
+		return gcm.NewGCM(cf), gcm.NonceSize, nil
+	case cfbMode:
+		verboseLog.Println("cipher feedback mode chosen")
+		return cfb.NewCFB(cf), 16, nil
+	case cfb8Mode:
+		verboseLog.Println("8 bit cipher feedback mode chosen")
+		return cfb.NewCFB8(cf), 16, nil
+	case ofbMode:
+		verboseLog.Println("output feedback mode chosen")
+		return ofb.NewOFB(cf), 16, nil
+	case xtsMode:
+		if cipher.CipherKeySize(args.keySize) == cipher.CK192 {
+			return nil, 0, errors.New("xts mode requires a 128 or 256 bit cipher key size")
+		}
+		verboseLog.Println("xts mode chosen")
+		return xts.NewXTS(cf), 8, nil // nonce is the number of the first sector
+	case chunkedMode:
+		verboseLog.Println("chunked galois/counter mode chosen")
+		return chunked.NewChunked(cf), chunked.NonceSize, nil
+	case cbcCS1Mode:
+		verboseLog.Println("chain-block chaining mode with CS1 ciphertext stealing chosen")
+		return cbc.NewChainCS(cf, cbc.CS1), 16, nil
+	case cbcCS2Mode:
+		verboseLog.Println("chain-block chaining mode with CS2 ciphertext stealing chosen")
+		return cbc.NewChainCS(cf, cbc.CS2), 16, nil
+	case cbcCS3Mode:
+		verboseLog.Println("chain-block chaining mode with CS3 ciphertext stealing chosen")
+		return cbc.NewChainCS(cf, cbc.CS3), 16, nil
+	case ccmMode:
+		verboseLog.Println("counter with CBC-MAC mode chosen")
+		return ccm.NewCCM(cf), ccm.MinNonceSize, nil // leaves 8 bytes to encode the length of the input
+	case sivMode:
+		verboseLog.Println("synthetic initialization vector mode chosen")
+		return siv.NewSIV(cf), siv.NonceSize, nil
 	default:
-		panic("unknown mode chosen")
+		return nil, 0, fmt.Errorf("unknown mode identifier %d", id)
 	}
-	prepareMode(mode)
-	// Run the decryption
-	mode.Decrypt(uint64(len(nonce)+1), uint64(getFileSize(args.input))-uint64(len(nonce)+1), ifile, ofile, ck, nonce)
-	standardLog.Println("decryption stored in", ofile.Name())
 }
 
-// fatalPanic in case of a recovered panic logs and exits execution with code 1.
-func fatalPanic() {
-	// if r := recover(); r != nil {
-	// 	errorLog.Fatal(r)
-	// }
+// choosePadding sets the padding scheme chosen by the command arguments on the mode, keeping the
+// default of the mode if none is chosen. Returns an error for modes that choose their own padding.
+func choosePadding(mode modes.ModeInterface, modeID byte) error {
+	if args.padding == "" {
+		return nil
+	}
+	switch modeID {
+	case gcmMode, xtsMode, chunkedMode, cbcCS1Mode, cbcCS2Mode, cbcCS3Mode, ccmMode, sivMode:
+		return fmt.Errorf("mode %s does not support choosing the padding", args.mode)
+	}
+	id, err := parsePadding(args.padding)
+	if err != nil {
+		return err
+	}
+	p, err := getPadding(id)
+	if err != nil {
+		return err
+	}
+	verboseLog.Println(args.padding, "padding chosen")
+	mode.SetPadding(p)
+	return nil
 }
 
-// checkKeySize checks the passed key size in bits, panics if invalid cipher key size.
-func checkKeySize(k uint64) {
-	switch cipher.CipherKeySize(k) {
-	case cipher.CK128, cipher.CK192, cipher.CK256:
+// getPadding returns the padding scheme for the padding identifier.
+func getPadding(id byte) (modes.Padding, error) {
+	switch id {
+	case pkcs7Padding:
+		return modes.PKCS7Padding, nil
+	case x923Padding:
+		return modes.ANSIX923Padding, nil
+	case iso7816Padding:
+		return modes.ISO7816Padding, nil
+	case zeroPadding:
+		return modes.ZeroPadding, nil
+	case noPadding:
+		return modes.NoPadding, nil
 	default:
-		panic(fmt.Sprintf("invalid cipher key size %d bits", k))
+		return nil, fmt.Errorf("unknown padding identifier %d", id)
+	}
+}
+
+// paddingID returns the identifier of the padding scheme, stored in the header.
+func paddingID(p modes.Padding) byte {
+	switch p {
+	case modes.ANSIX923Padding:
+		return x923Padding
+	case modes.ISO7816Padding:
+		return iso7816Padding
+	case modes.ZeroPadding:
+		return zeroPadding
+	case modes.NoPadding:
+		return noPadding
+	default:
+		return pkcs7Padding
 	}
 }
 
 // getCipherFactory configures and returns an cipher factory instance.
-func getCipherFactory() cipher.CipherFactory {
-	return func() *cipher.Cipher {
-		c := cipher.NewCipher(cipher.CipherKeySize(args.keySize))
+func getCipherFactory() (cipher.CipherFactory, error) {
+	engine, err := getEngine()
+	if err != nil {
+		return nil, err
+	}
+	return func() (*cipher.Cipher, error) {
+		c, err := cipher.NewCipher(cipher.CipherKeySize(args.keySize), engine)
+		if err != nil {
+			return nil, err
+		}
 		c.ErrorLog = errorLog
 		c.InfoLog = verboseLog
 		c.DebugLog = veryVerboseLog
-		return c
+		return c, nil
+	}, nil
+}
+
+// getEngine returns the block cipher engine chosen by the command arguments, returns an error if unknown.
+// Very verbose output defaults to the step by step engine, which logs each round.
+func getEngine() (cipher.Engine, error) {
+	switch args.engine {
+	case "":
+		if args.veryVerbose {
+			return cipher.StepEngine, nil
+		}
+		return cipher.TableEngine, nil
+	case "step":
+		return cipher.StepEngine, nil
+	case "table":
+		return cipher.TableEngine, nil
+	case "bitsliced":
+		return cipher.BitslicedEngine, nil
+	default:
+		return 0, fmt.Errorf("unknown engine %q chosen", args.engine)
 	}
 }
 
 // prepareMode sets the logs on the block cipher mode based on the command line arguments.
-func prepareMode(mode modes.ModeInterface) {
+// Authenticated modes also authenticate the header, so it can not be modified undetected.
+func prepareMode(mode modes.ModeInterface, h *header) {
 	mode.SetErrorLog(errorLog)
 	mode.SetInfoLog(standardLog)
 	mode.SetDebugLog(verboseLog)
+	if args.progress {
+		mode.SetProgress(newProgressBar(os.Stderr).update)
+	}
+	if am, ok := mode.(modes.AuthModeInterface); ok {
+		am.SetAdditionalData(h.bytes())
+	}
 }
 
-// prepareOutput prepares the output by prefixing with info about the initiliazation vector.
-// Uses the following custom AES format :
-//  1 Octet - length of nonce or IV in bytes
-// nn Octet - nonce or IV
-// nn Octet - encrypted message
-func prepareOutput(f *os.File, iv []byte) {
-	writeToFile(f, byte(len(iv)))
-	writeToFile(f, iv...)
-}
-
-// processInput extracts the initialization vector from the input file, parsing the custom AES format.
-// Panics if there is any problems processing the format.
-func processInput(f *os.File) []byte {
-	ivl := make([]byte, 1)
-	if n, err := f.Read(ivl); err != nil && err != io.EOF {
-		panic(err)
-	} else if n != 1 {
-		panic(fmt.Sprintf("iv length must be one byte, read %d bytes", n))
-	}
-	ivLen := int(ivl[0])
-	iv := make([]byte, ivLen)
-	if n, err := f.Read(iv); err != nil && err != io.EOF {
-		panic(err)
-	} else if n != ivLen {
-		panic(fmt.Sprintf("iv length does not match, read %d bytes should have been %d bytes", n, ivLen))
-	}
-	return iv
+// prepareOutput prepares the output by prefixing it with the header, followed by the encrypted message.
+func prepareOutput(f *os.File, h *header) error {
+	return writeToFile(f, h.bytes()...)
+}
+
+// processInput extracts the header from the input file, leaving the file at the start of the
+// encrypted message. Returns an error if the input is not an encrypted file or the header is invalid.
+func processInput(f *os.File) (*header, error) {
+	h, err := readHeader(f)
+	if err != nil {
+		return nil, err
+	}
+	name, _ := modeName(h.mode)
+	verboseLog.Println("header version : ", h.version)
+	verboseLog.Println("header mode : ", name)
+	verboseLog.Println("header key size : ", h.keySize)
+	return h, nil
 }
@@ -4,6 +4,10 @@ import (
 	"bytes"
 	"encoding/hex"
 	"flag"
+	"github.com/emil2k/go-aes/keywrap"
+	"github.com/emil2k/go-aes/mac"
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/modes/xts"
 	"github.com/emil2k/go-aes/util/test_files"
 	"log"
 	"os"
@@ -15,41 +19,50 @@ func init() {
 	veryVerboseLog = log.New(os.Stdout, "debug : ", 0)
 }
 
-// mockExecute emulates a command execution.
-func mockExecute(args ...string) {
+// mockExecute emulates a command execution, returning any error.
+func mockExecute(args ...string) error {
 	flag.CommandLine = flag.NewFlagSet("go-aes", flag.ExitOnError) // reset the flag set
 	os.Args = []string{"go-aes"}
 	os.Args = append(os.Args, args...)
 	prepareFlags()
-	main()
+	return execute()
 }
 
 // testModeEncryptDecrypt setups and runs a mock command call to encrypt/decrypt cycle using
-// the given mode checking that the decryption is the inverse of encryption.
+// the given mode and any extra flags, checking that the decryption is the inverse of encryption.
 // Outputs to test files, which are cleaned up afterward.
-func testModeEncryptDecrypt(t *testing.T, mode string) {
+func testModeEncryptDecrypt(t *testing.T, mode string, flags ...string) {
 	// Prepare file to encrypt
 	f, err := test_files.Open10KBTestFile()
-	defer closeFile(f)
 	if err != nil {
 		panic(err.Error())
 	}
-	data := readFromFile(f)
+	defer closeFile(f)
+	data, err := readFromFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
 	// Encrypt file
 	key := test_files.TestFile10KB + ".key"
 	encrypted := test_files.TestFile10KB + ".aes"
 	defer removeTestFile(t, key)
 	defer removeTestFile(t, encrypted)
-	mockExecute("-vv", "-mode", mode, key, f.Name(), encrypted)
-	// Decrypt file
+	if err := mockExecute(append(append([]string{"-vv", "-mode", mode}, flags...), key, f.Name(), encrypted)...); err != nil {
+		t.Fatalf("Encrypt failed with %v", err)
+	}
+	// Decrypt file, the mode is read from the header
 	out := test_files.TestOutputFile
 	defer removeTestFile(t, out)
-	mockExecute("-vv", "-d", "-mode", mode, key, encrypted, out)
+	if err := mockExecute(append(append([]string{"-vv", "-d"}, flags...), key, encrypted, out)...); err != nil {
+		t.Fatalf("Decrypt failed with %v", err)
+	}
 	// Inspect output
-	of := openFile(out)
+	of, err := openFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
 	defer closeFile(of)
-	outData := readFromFile(of)
-	if !bytes.Equal(outData, data) {
+	if outData, err := readFromFile(of); err != nil || !bytes.Equal(outData, data) {
 		t.Errorf("Encrypt the decrypt failed with %s", hex.EncodeToString(outData))
 	}
 }
@@ -61,3 +74,552 @@ func TestCTRMode(t *testing.T) {
 func TestCBCMode(t *testing.T) {
 	testModeEncryptDecrypt(t, "cbc")
 }
+
+func TestBitslicedEngine(t *testing.T) {
+	testModeEncryptDecrypt(t, "ctr", "-engine", "bitsliced")
+}
+
+func TestGCMMode(t *testing.T) {
+	testModeEncryptDecrypt(t, "gcm")
+}
+
+func TestCCMMode(t *testing.T) {
+	testModeEncryptDecrypt(t, "ccm")
+	testModeStdStreams(t, "ccm")
+}
+
+func TestSIVMode(t *testing.T) {
+	testModeEncryptDecrypt(t, "siv")
+	testModeEncryptDecrypt(t, "siv", "-size", "192")
+	testModeEncryptDecrypt(t, "siv", "-size", "256")
+	testModeStdStreams(t, "siv")
+}
+
+func TestChunkedMode(t *testing.T) {
+	testModeEncryptDecrypt(t, "chunked")
+}
+
+func TestCBCStealingModes(t *testing.T) {
+	for _, mode := range []string{"cbc-cs1", "cbc-cs2", "cbc-cs3"} {
+		testModeEncryptDecrypt(t, mode)
+		testModeStdStreams(t, mode)
+	}
+}
+
+func TestCFBMode(t *testing.T) {
+	testModeEncryptDecrypt(t, "cfb")
+}
+
+func TestCFB8Mode(t *testing.T) {
+	testModeEncryptDecrypt(t, "cfb8")
+}
+
+func TestOFBMode(t *testing.T) {
+	testModeEncryptDecrypt(t, "ofb")
+}
+
+func TestXTSMode(t *testing.T) {
+	testModeEncryptDecrypt(t, "xts")
+	testModeEncryptDecrypt(t, "xts", "-size", "256")
+}
+
+// TestPadding tests encrypt/decrypt cycles with each padding scheme, including through standard
+// input and output, that ctr is length preserving by default, and that invalid choices fail.
+func TestPadding(t *testing.T) {
+	for _, p := range []string{"pkcs7", "x923", "iso7816", "zero", "none"} {
+		testModeEncryptDecrypt(t, "cbc", "-padding", p)
+		testModeEncryptDecrypt(t, "ofb", "-padding", p)
+	}
+	testModeEncryptDecrypt(t, "ctr", "-padding", "pkcs7")
+	testModeStdStreams(t, "cbc", "-padding", "iso7816")
+	testModeStdStreams(t, "ctr", "-padding", "x923")
+	f, err := test_files.Open10KBTestFile()
+	if err != nil {
+		panic(err.Error())
+	}
+	defer closeFile(f)
+	key := test_files.TestFile10KB + ".key"
+	encrypted := test_files.TestFile10KB + ".aes"
+	defer removeTestFile(t, key)
+	defer removeTestFile(t, encrypted)
+	if err := mockExecute(key, f.Name(), encrypted); err != nil {
+		t.Fatalf("Encrypt failed with %v", err)
+	}
+	fsize, _ := getFileSize(f.Name())
+	esize, _ := getFileSize(encrypted)
+	if hsize := newHeader(ctrMode, 128, make([]byte, 8)).size(); uint64(esize) != uint64(fsize)+hsize {
+		t.Errorf("Encrypting with ctr should be length preserving, %d bytes encrypted to %d", fsize, esize)
+	}
+	if err := mockExecute("-mode", "gcm", "-padding", "pkcs7", key, f.Name(), encrypted); err == nil {
+		t.Errorf("Encrypting with padding in an authenticated mode should fail")
+	}
+	if err := mockExecute("-mode", "cbc", "-padding", "pkcs5", key, f.Name(), encrypted); err == nil {
+		t.Errorf("Encrypting with unknown padding should fail")
+	}
+}
+
+func TestProgress(t *testing.T) {
+	testModeEncryptDecrypt(t, "cbc", "-progress")
+	testModeEncryptDecrypt(t, "xts", "-progress")
+}
+
+func TestAuth(t *testing.T) {
+	testModeEncryptDecrypt(t, "ctr", "-auth", "hmac")
+	testModeEncryptDecrypt(t, "cbc", "-auth", "cmac", "-size", "256")
+}
+
+// TestAuthModified tests that decrypting an authenticated file fails without creating the output
+// file when a bit of the cipher text is flipped.
+func TestAuthModified(t *testing.T) {
+	f, err := test_files.Open10KBTestFile()
+	if err != nil {
+		panic(err.Error())
+	}
+	defer closeFile(f)
+	key := test_files.TestFile10KB + ".key"
+	encrypted := test_files.TestFile10KB + ".aes"
+	out := test_files.TestOutputFile
+	defer removeTestFile(t, key)
+	defer removeTestFile(t, encrypted)
+	for _, auth := range []string{"hmac", "cmac"} {
+		if err := mockExecute("-mode", "cbc", "-auth", auth, key, f.Name(), encrypted); err != nil {
+			t.Fatalf("Encrypt failed with %v", err)
+		}
+		ef, err := os.OpenFile(encrypted, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 1)
+		ef.ReadAt(b, 100)
+		b[0] ^= 0x01
+		ef.WriteAt(b, 100)
+		closeFile(ef)
+		if err := mockExecute("-d", key, encrypted, out); err != errAuthentication {
+			t.Errorf("Decrypting modified file authenticated with %s failed with %v", auth, err)
+		}
+		if _, err := os.Stat(out); !os.IsNotExist(err) {
+			t.Errorf("Failed authentication should not create the output file")
+		}
+	}
+	if err := mockExecute("-mode", "gcm", "-auth", "hmac", key, f.Name(), encrypted); err == nil {
+		t.Errorf("Encrypt with authentication of an authenticated mode should fail")
+	}
+	if err := mockExecute("-auth", "poly1305", key, f.Name(), encrypted); err == nil {
+		t.Errorf("Encrypt with unknown authentication should fail")
+	}
+}
+
+// TestAuthModeModified tests that decrypting a file encrypted with an authenticated mode fails
+// without leaving an output file when the last byte is flipped, including the chunked mode which
+// writes the chunks preceding the modified chunk before it fails.
+func TestAuthModeModified(t *testing.T) {
+	f, err := test_files.Open10KBTestFile()
+	if err != nil {
+		panic(err.Error())
+	}
+	defer closeFile(f)
+	key := test_files.TestFile10KB + ".key"
+	encrypted := test_files.TestFile10KB + ".aes"
+	out := test_files.TestOutputFile
+	defer removeTestFile(t, key)
+	defer removeTestFile(t, encrypted)
+	for _, mode := range []string{"gcm", "ccm", "siv", "chunked"} {
+		if err := mockExecute("-mode", mode, key, f.Name(), encrypted); err != nil {
+			t.Fatalf("Encrypt with %s mode failed with %v", mode, err)
+		}
+		size, err := getFileSize(encrypted)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ef, err := os.OpenFile(encrypted, os.O_RDWR, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b := make([]byte, 1)
+		ef.ReadAt(b, size-1)
+		b[0] ^= 0x01
+		ef.WriteAt(b, size-1)
+		closeFile(ef)
+		if err := mockExecute("-d", key, encrypted, out); err != modes.ErrAuthentication {
+			t.Errorf("Decrypting modified file encrypted with %s mode failed with %v", mode, err)
+		}
+		if _, err := os.Stat(out); !os.IsNotExist(err) {
+			t.Errorf("Failed authentication with %s mode should not leave the output file", mode)
+		}
+	}
+}
+
+// TestErrors tests that invalid command arguments are returned as errors, without creating the
+// cipher key or output files.
+func TestErrors(t *testing.T) {
+	f, err := test_files.Open10KBTestFile()
+	if err != nil {
+		panic(err.Error())
+	}
+	defer closeFile(f)
+	key := test_files.TestFile10KB + ".key"
+	out := test_files.TestOutputFile
+	if err := mockExecute(key, f.Name()); err == nil {
+		t.Errorf("Missing output path should fail")
+	}
+	if err := mockExecute("-size", "100", key, f.Name(), out); err == nil {
+		t.Errorf("Invalid key size should fail")
+	}
+	if err := mockExecute("-mode", "ecb", key, f.Name(), out); err == nil {
+		t.Errorf("Unknown mode should fail")
+	}
+	if err := mockExecute("-mode", "xts", "-size", "192", key, f.Name(), out); err == nil {
+		t.Errorf("XTS mode with 192 bit key size should fail")
+	}
+	if err := mockExecute("-engine", "fast", key, f.Name(), out); err == nil {
+		t.Errorf("Unknown engine should fail")
+	}
+	if _, err := os.Stat(key); !os.IsNotExist(err) {
+		t.Errorf("Failed encryption should not create the cipher key file")
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("Failed encryption should not create the output file")
+	}
+}
+
+// TestDecryptErrors tests that decrypting a foreign file or with a mismatched cipher key fails
+// without creating the output file.
+func TestDecryptErrors(t *testing.T) {
+	f, err := test_files.Open10KBTestFile()
+	if err != nil {
+		panic(err.Error())
+	}
+	defer closeFile(f)
+	key := test_files.TestFile10KB + ".key"
+	encrypted := test_files.TestFile10KB + ".aes"
+	out := test_files.TestOutputFile
+	defer removeTestFile(t, key)
+	defer removeTestFile(t, encrypted)
+	if err := mockExecute("-size", "256", key, f.Name(), encrypted); err != nil {
+		t.Fatalf("Encrypt failed with %v", err)
+	}
+	if err := mockExecute("-d", key, f.Name(), out); err != errNotEncrypted {
+		t.Errorf("Decrypting a foreign file failed with %v", err)
+	}
+	kf, err := createFile(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeToFile(kf, make([]byte, 16)...)
+	closeFile(kf)
+	if err := mockExecute("-d", key, encrypted, out); err == nil {
+		t.Errorf("Decrypting with a mismatched cipher key size should fail")
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("Failed decryption should not create the output file")
+	}
+}
+
+// TestEncryptRemovesOutput tests that an encryption failing after the header is written removes
+// the output file, with xts input ending in a sector shorter than a block.
+func TestEncryptRemovesOutput(t *testing.T) {
+	short := test_files.TestFile10KB + ".short"
+	key := test_files.TestFile10KB + ".key"
+	out := test_files.TestOutputFile
+	defer removeTestFile(t, short)
+	sf, err := createFile(short)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeToFile(sf, make([]byte, xts.DefaultSectorSize+5)...)
+	closeFile(sf)
+	if err := mockExecute("-mode", "xts", key, short, out); err != xts.ErrShortSector {
+		t.Errorf("Encrypting xts input with a short last sector failed with %v", err)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("Failed encryption should remove the output file")
+	}
+	if _, err := os.Stat(key); !os.IsNotExist(err) {
+		t.Errorf("Failed encryption should not create the cipher key file")
+	}
+}
+
+// testModeStdStreams runs an encrypt/decrypt cycle through standard input and output using the given
+// mode and any extra encryption flags, substituting files for them, checking that the decryption is
+// the inverse of encryption.
+func testModeStdStreams(t *testing.T, mode string, flags ...string) {
+	f, err := test_files.Open10KBTestFile()
+	if err != nil {
+		panic(err.Error())
+	}
+	defer closeFile(f)
+	data, err := readFromFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin, stdout := os.Stdin, os.Stdout
+	defer func() { os.Stdin, os.Stdout = stdin, stdout }()
+	key := test_files.TestFile10KB + ".key"
+	encrypted := test_files.TestFile10KB + ".aes"
+	out := test_files.TestOutputFile
+	defer removeTestFile(t, key)
+	defer removeTestFile(t, encrypted)
+	defer removeTestFile(t, out)
+	// Encrypt file to standard output
+	if os.Stdout, err = os.Create(encrypted); err != nil {
+		t.Fatal(err)
+	}
+	err = mockExecute(append(append([]string{"-v", "-mode", mode}, flags...), key, f.Name(), stdPath)...)
+	os.Stdout.Close()
+	if err != nil {
+		t.Fatalf("Encrypt to standard output failed with %v", err)
+	}
+	// Decrypt from standard input to standard output
+	if os.Stdin, err = os.Open(encrypted); err != nil {
+		t.Fatal(err)
+	}
+	if os.Stdout, err = os.Create(out); err != nil {
+		t.Fatal(err)
+	}
+	err = mockExecute("-v", "-d", key, stdPath, stdPath)
+	os.Stdin.Close()
+	os.Stdout.Close()
+	if err != nil {
+		t.Fatalf("Decrypt from standard input failed with %v", err)
+	}
+	of, err := openFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeFile(of)
+	if outData, err := readFromFile(of); err != nil || !bytes.Equal(outData, data) {
+		t.Errorf("Encrypt then decrypt through standard input and output with %s mode failed", mode)
+	}
+}
+
+func TestStdStreams(t *testing.T) {
+	for _, mode := range []string{"ctr", "cbc", "gcm", "chunked"} {
+		testModeStdStreams(t, mode)
+	}
+	testModeStdStreams(t, "ctr", "-auth", "hmac")
+	testModeStdStreams(t, "cbc", "-auth", "cmac")
+}
+
+// TestPassword tests an encrypt/decrypt cycle with a cipher key derived from a password, then
+// that decrypting with a key file or a wrong password fails.
+func TestPassword(t *testing.T) {
+	f, err := test_files.Open10KBTestFile()
+	if err != nil {
+		panic(err.Error())
+	}
+	defer closeFile(f)
+	data, err := readFromFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	passfile := test_files.TestFile10KB + ".pass"
+	encrypted := test_files.TestFile10KB + ".aes"
+	out := test_files.TestOutputFile
+	defer removeTestFile(t, passfile)
+	defer removeTestFile(t, encrypted)
+	pf, err := createFile(passfile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeToFile(pf, []byte("correct horse\n")...)
+	closeFile(pf)
+	if err := mockExecute("-mode", "gcm", "-size", "192", "-password", "correct horse", f.Name(), encrypted); err != nil {
+		t.Fatalf("Encrypt with password failed with %v", err)
+	}
+	if err := mockExecute("-d", "-passfile", passfile, encrypted, out); err != nil {
+		t.Fatalf("Decrypt with password file failed with %v", err)
+	}
+	of, err := openFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeFile(of)
+	if outData, err := readFromFile(of); err != nil || !bytes.Equal(outData, data) {
+		t.Errorf("Encrypt then decrypt with password failed")
+	}
+	if err := mockExecute("-d", "-password", "wrong horse", encrypted, out); err == nil {
+		t.Errorf("Decrypt with wrong password should fail")
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Errorf("Decrypt with wrong password should remove the output file")
+	}
+	if err := mockExecute("-d", passfile, encrypted, out); err == nil {
+		t.Errorf("Decrypt of password encrypted input without password should fail")
+	}
+	if err := mockExecute("-d", "-password", "a", "-passfile", passfile, encrypted, out); err == nil {
+		t.Errorf("Decrypt with both password and password file should fail")
+	}
+}
+
+// TestMAC tests that the mac command generates a cipher key and tags the input, and that the
+// verify-mac command accepts the tag but rejects a modified tag.
+func TestMAC(t *testing.T) {
+	f, err := test_files.Open10KBTestFile()
+	if err != nil {
+		panic(err.Error())
+	}
+	defer closeFile(f)
+	key := test_files.TestFile10KB + ".key"
+	tag := test_files.TestFile10KB + ".tag"
+	defer removeTestFile(t, key)
+	defer removeTestFile(t, tag)
+	if err := mockExecute("mac", "-size", "256", key, f.Name(), tag); err != nil {
+		t.Fatalf("Tag failed with %v", err)
+	}
+	if info, err := os.Stat(key); err != nil || info.Size() != 32 {
+		t.Errorf("Tag should generate a 256 bit cipher key")
+	}
+	if err := mockExecute("verify-mac", "-vv", key, f.Name(), tag); err != nil {
+		t.Errorf("Verify failed with %v", err)
+	}
+	tf, err := openFile(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stored, err := readFromFile(tf)
+	closeFile(tf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tagging again reuses the existing cipher key
+	if err := mockExecute("mac", key, f.Name(), tag); err != nil {
+		t.Fatalf("Tag with existing key failed with %v", err)
+	}
+	if tf, err = openFile(tag); err != nil {
+		t.Fatal(err)
+	}
+	defer closeFile(tf)
+	if again, _ := readFromFile(tf); !bytes.Equal(again, stored) {
+		t.Errorf("Tag with existing key should not change")
+	}
+	stored[0] ^= 0x01
+	tf, err = createFile(tag)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeToFile(tf, stored...)
+	closeFile(tf)
+	if err := mockExecute("verify-mac", key, f.Name(), tag); err != mac.ErrVerification {
+		t.Errorf("Verify of modified tag failed with %v", err)
+	}
+	if err := mockExecute("mac", "-password", "a", f.Name(), tag); err == nil {
+		t.Errorf("Tag with password should fail")
+	}
+}
+
+// TestWrap tests that a key file generated by encryption can be wrapped under a key encryption key,
+// and that the unwrapped key file decrypts the output.
+func TestWrap(t *testing.T) {
+	f, err := test_files.Open10KBTestFile()
+	if err != nil {
+		panic(err.Error())
+	}
+	defer closeFile(f)
+	data, err := readFromFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := test_files.TestFile10KB + ".key"
+	kek := test_files.TestFile10KB + ".kek"
+	wrapped := test_files.TestFile10KB + ".wrapped"
+	encrypted := test_files.TestFile10KB + ".aes"
+	out := test_files.TestOutputFile
+	defer removeTestFile(t, key)
+	defer removeTestFile(t, kek)
+	defer removeTestFile(t, wrapped)
+	defer removeTestFile(t, encrypted)
+	defer removeTestFile(t, out)
+	kf, err := createFile(kek)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeToFile(kf, make([]byte, 32)...)
+	closeFile(kf)
+	if err := mockExecute("-mode", "cbc", "-auth", "hmac", key, f.Name(), encrypted); err != nil {
+		t.Fatalf("Encrypt failed with %v", err)
+	}
+	if err := mockExecute("wrap", kek, key, wrapped); err != nil {
+		t.Fatalf("Wrap failed with %v", err)
+	}
+	if info, err := os.Stat(wrapped); err != nil || info.Size() != 16+32+8 {
+		t.Errorf("Wrapped key should be 8 bytes longer than the key file")
+	}
+	if err := os.Remove(key); err != nil {
+		t.Fatal(err)
+	}
+	if err := mockExecute("unwrap", "-v", kek, wrapped, key); err != nil {
+		t.Fatalf("Unwrap failed with %v", err)
+	}
+	if err := mockExecute("-d", key, encrypted, out); err != nil {
+		t.Fatalf("Decrypt with unwrapped key failed with %v", err)
+	}
+	of, err := openFile(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closeFile(of)
+	if outData, err := readFromFile(of); err != nil || !bytes.Equal(outData, data) {
+		t.Errorf("Decrypt with unwrapped key failed")
+	}
+	if kf, err = createFile(kek); err != nil {
+		t.Fatal(err)
+	}
+	writeToFile(kf, bytes.Repeat([]byte{0x01}, 32)...)
+	closeFile(kf)
+	if err := mockExecute("unwrap", kek, wrapped, out); err != keywrap.ErrIntegrity {
+		t.Errorf("Unwrap with wrong key encryption key failed with %v", err)
+	}
+}
+
+// TestRange tests decrypting byte ranges of a file encrypted with counter mode, and that other
+// modes are rejected.
+func TestRange(t *testing.T) {
+	f, err := test_files.Open10KBTestFile()
+	if err != nil {
+		panic(err.Error())
+	}
+	defer closeFile(f)
+	data, err := readFromFile(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key := test_files.TestFile10KB + ".key"
+	encrypted := test_files.TestFile10KB + ".aes"
+	out := test_files.TestOutputFile
+	defer removeTestFile(t, key)
+	defer removeTestFile(t, encrypted)
+	defer removeTestFile(t, out)
+	test := func(r string, expected []byte, flags ...string) {
+		if err := mockExecute(append([]string{"-d", "-range", r}, append(flags, key, encrypted, out)...)...); err != nil {
+			t.Errorf("Decrypting range %s failed with %v", r, err)
+			return
+		}
+		of, err := openFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer closeFile(of)
+		if outData, err := readFromFile(of); err != nil || !bytes.Equal(outData, expected) {
+			t.Errorf("Decrypting range %s failed with %d bytes", r, len(outData))
+		}
+	}
+	if err := mockExecute("-mode", "ctr", "-auth", "cmac", key, f.Name(), encrypted); err != nil {
+		t.Fatalf("Encrypt failed with %v", err)
+	}
+	test("1000:500", data[1000:1500])
+	test("17:1", data[17:18])
+	test("10000:", data[10000:])
+	test("0:", data)
+	if err := mockExecute("-d", "-range", "5", key, encrypted, out); err == nil {
+		t.Errorf("Decrypting a range without a length separator should fail")
+	}
+	if err := mockExecute("-d", "-range", "x:5", key, encrypted, out); err == nil {
+		t.Errorf("Decrypting a range with an invalid start should fail")
+	}
+	if err := mockExecute("-mode", "cbc", key, f.Name(), encrypted); err != nil {
+		t.Fatalf("Encrypt failed with %v", err)
+	}
+	if err := mockExecute("-d", "-range", "0:5", key, encrypted, out); err == nil {
+		t.Errorf("Decrypting a range of cbc mode should fail")
+	}
+}
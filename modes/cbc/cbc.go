@@ -5,13 +5,39 @@ import (
 	"github.com/emil2k/go-aes/modes"
 	"github.com/emil2k/go-aes/state"
 	"io"
+	"runtime"
 )
 
+const resultsBufferSize int = 30 // buffer size of channel receiving results
+const runBlocks uint64 = 1024    // number of consecutive blocks decrypted by each goroutine
+
+// Stealing is a ciphertext stealing variant, from the addendum to NIST SP 800-38A, which orders
+// the last two blocks of cipher text so it is the same length as the plaintext.
+type Stealing int
+
+// Ciphertext stealing variants, the second to last block of cipher text is truncated to the length
+// of the last block of plaintext.
+const (
+	CS1 Stealing = iota + 1 // second to last block followed by the last block
+	CS2                     // as CS1 when the last block of plaintext is whole, otherwise as CS3
+	CS3                     // last block followed by the second to last block, as in RFC 3962
+)
+
+// swapped returns whether the last block precedes the second to last block of cipher text, when
+// the last block of plaintext has d bytes.
+func (s Stealing) swapped(d uint64) bool {
+	return s == CS3 || (s == CS2 && d != modes.BlockSize)
+}
+
 // Chain represents the state of a cipher-block chaining process.
 type Chain struct {
 	modes.Mode
-	last   state.State    // last cipher text or initilization vector
-	cipher *cipher.Cipher // block cipher instance
+	last       state.State    // last cipher text or initilization vector
+	cipher     *cipher.Cipher // block cipher instance
+	sequential bool           // whether to decrypt one block at a time, instead of concurrently
+	stealing   Stealing       // ciphertext stealing variant, none if zero
+	prev       state.State    // second to last cipher text block, when encrypting with ciphertext stealing
+	stolen     []state.State  // last two cipher text blocks in chaining order, when decrypting with ciphertext stealing
 }
 
 // NewChain creates a new chain instance with the given CipherFactory instance.
@@ -21,27 +47,40 @@ func NewChain(cf cipher.CipherFactory) *Chain {
 	}
 }
 
+// NewChainCS creates a new chain instance with ciphertext stealing, the cipher text is the same
+// length as the plaintext, which must be at least a block.
+func NewChainCS(cf cipher.CipherFactory, s Stealing) *Chain {
+	c := &Chain{
+		Mode:     *modes.NewMode(cf),
+		stealing: s,
+	}
+	c.Partial = true
+	c.SetPadding(modes.NoPadding)
+	return c
+}
+
 // initChain initializes chain instance to run an encryption or decryption.
-func (c *Chain) initChain(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte, isDecrypt bool) {
-	c.InitMode(offset, size, in, out, ck, isDecrypt)
+// Returns modes.ErrShortBlock if the input is shorter than a block with ciphertext stealing.
+func (c *Chain) initChain(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte, isDecrypt bool) (err error) {
+	if c.stealing != 0 && size < modes.BlockSize {
+		return modes.ErrShortBlock
+	}
+	if err = c.InitMode(offset, size, in, out, ck, isDecrypt); err != nil {
+		return
+	}
 	c.last = *state.NewStateFromBytes(nonce)
-	c.cipher = c.Cf()
+	c.stolen = nil
+	if c.cipher, err = c.Cf(); err != nil {
+		return
+	}
+	return c.cipher.Expand(ck)
 }
 
-// processBlocks process all blocks, repeatedly flushing buffers as they fill up.
-func (c *Chain) processBlocks(process func(i uint64)) {
-	// Process one buffer block at a time
-	for j := uint64(0); j < c.NBuffers(); j++ {
-		c.FillInBuffer()
-		// Process each block in the buffer block
-		for k := uint64(0); k < modes.NBufferBlocks; k++ {
-			i := k + j*modes.NBufferBlocks
-			if i >= c.NBlocks() {
-				break
-			}
-			process(i) // process the buffer block
-		}
-		c.FlushOutBuffer()
+// restoreBlock replaces the ith block in the input buffer by the cipher text block in chaining
+// order, when it is one of the last two blocks when decrypting with ciphertext stealing.
+func (c *Chain) restoreBlock(i uint64) {
+	if k := len(c.stolen) - int(c.NBlocks()-i); k >= 0 {
+		c.InBuffer[i%c.BufferBlocks()] = c.stolen[k]
 	}
 }
 
@@ -56,20 +95,244 @@ func (c *Chain) encryptBlock(i uint64) {
 // decryptBlock decrypts the ith block, getting it from the input buffer then putting it
 // into the output buffer after decryption. Should be called iteratively on each block.
 func (c *Chain) decryptBlock(i uint64) {
+	c.restoreBlock(i)
 	b := c.GetBlock(i)
 	c.last.Xor(c.cipher.Decrypt(b, c.Ck))
 	c.PutBlock(i, c.last)
 	c.last = b
 }
 
-// Encrypt runs the encryption process.
-func (c *Chain) Encrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) {
-	c.initChain(offset, size, in, out, ck, nonce, false)
-	c.processBlocks(c.encryptBlock)
+// decryptBuffers decrypts all blocks, one buffer block at a time.
+func (c *Chain) decryptBuffers() error {
+	for j := uint64(0); j < c.NBuffers(); j++ {
+		if err := c.decryptBuffer(j); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decryptBuffer decrypts the jth buffer block, when done it flushes the buffer to output.
+// Each plaintext block only depends on its cipher text block and the previous one, so runs of blocks
+// inside the buffer block are decrypted asynchronously on separate goroutines, as in counter mode.
+// When the context is done dispatching stops, the dispatched runs are waited for, then the context
+// error is returned. With ciphertext stealing the last two blocks are restored to chaining order.
+func (c *Chain) decryptBuffer(j uint64) error {
+	if err := c.FillInBuffer(); err != nil {
+		return err
+	}
+	first := j * c.BufferBlocks() // index of the first block in the buffer
+	n := uint64(len(c.InBuffer))  // number of blocks in the buffer
+	if rem := c.NBlocks() - first; n > rem {
+		n = rem
+	}
+	for i := c.NBlocks() - uint64(len(c.stolen)); i < c.NBlocks(); i++ {
+		if i >= first && i < first+n {
+			c.restoreBlock(i)
+		}
+	}
+	sem := make(chan int, runtime.NumCPU())              // controls goroutine allocation
+	results := make(chan *runPayload, resultsBufferSize) // collects individual completed results
+	var dcount uint64 = 0                                // keep track of dispatched blocks
+	var druns uint64 = 0                                 // keep track of dispatched runs
+	var rcount uint64 = 0                                // count of blocks received
+	var rruns uint64 = 0                                 // count of runs received
+	done := c.Done()                                     // closed when the context is done
+	for rcount < n {
+		select {
+		case sem <- 1:
+			if dcount < n {
+				end := dcount + runBlocks
+				if end > n {
+					end = n
+				}
+				prev := c.last // last cipher text of the previous buffer or initialization vector
+				if dcount > 0 {
+					prev = c.InBuffer[dcount-1]
+				}
+				go func(r *runPayload) {
+					r.process()
+					results <- r
+					<-sem
+				}(newRunPayload(c.cipher.Copy(), first+dcount, c.InBuffer[dcount:end], prev, c.Ck))
+				dcount = end
+				druns++
+			}
+		case r := <-results:
+			for k, b := range r.out {
+				c.PutBlock(r.i+uint64(k), b)
+			}
+			rcount += uint64(len(r.out))
+			rruns++
+		case <-done:
+			for ; rruns < druns; rruns++ {
+				<-results
+			}
+			return c.CheckContext()
+		}
+	}
+	c.last = c.InBuffer[n-1]
+	return c.FlushOutBuffer()
+}
+
+// runPayload keeps the state of a run of consecutive blocks while it is being decrypted
+// in a goroutine and is then sent back as the result over a channel
+type runPayload struct {
+	cipher *cipher.Cipher // block cipher used
+	i      uint64         // block number of the first block
+	in     []state.State  // input cipher text blocks
+	prev   state.State    // cipher text block preceding the run or initialization vector
+	out    []state.State  // output plaintext blocks
+	ck     []byte         // cipher key
+}
+
+// newRunPayload creates a new instance of a run payload
+func newRunPayload(c *cipher.Cipher, i uint64, in []state.State, prev state.State, ck []byte) *runPayload {
+	return &runPayload{
+		cipher: c,
+		i:      i,
+		in:     in,
+		prev:   prev,
+		ck:     ck,
+	}
+}
+
+// process decrypts the blocks of a run payload, xoring each with the preceding cipher text
+func (r *runPayload) process() {
+	r.out = r.cipher.DecryptBlocks(r.in, r.ck)
+	r.out[0].Xor(r.prev)
+	for k := 1; k < len(r.out); k++ {
+		r.out[k].Xor(r.in[k-1])
+	}
+}
+
+// Encrypt runs the encryption process. With ciphertext stealing the last block of plaintext is
+// filled with zeros and chained as usual, then the last two blocks of cipher text are rewritten.
+func (c *Chain) Encrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if err := c.initChain(offset, size, in, out, ck, nonce, false); err != nil {
+		return err
+	}
+	if c.stealing == 0 || c.NBlocks() < 2 {
+		return c.ProcessBlocks(c.encryptBlock)
+	}
+	last := c.NBlocks() - 1
+	if err := c.ProcessBlocks(func(i uint64) {
+		if i == last {
+			c.prev = c.last
+		}
+		c.encryptBlock(i)
+	}); err != nil {
+		return err
+	}
+	return c.writeStolen(c.Padding().Size(size))
+}
+
+// writeStolen rewrites the last two blocks at the end of the cipher text of size bytes, in the
+// order of the ciphertext stealing variant, truncating the second to last block.
+func (c *Chain) writeStolen(size uint64) error {
+	d := size - (c.NBlocks()-1)*modes.BlockSize // bytes in the last block of plaintext
+	first, second := c.prev.GetBytes()[:d], c.last.GetBytes()
+	if c.stealing.swapped(d) {
+		first, second = second, first
+	}
+	if _, err := c.Out.Seek(-int64(modes.BlockSize+d), 1); err != nil {
+		return &modes.IOError{Op: "seek output", Err: err}
+	}
+	if _, err := c.Out.Write(append(append([]byte{}, first...), second...)); err != nil {
+		return &modes.IOError{Op: "write output", Err: err}
+	}
+	c.DebugLog.Println("stole", modes.BlockSize-d, "bytes of cipher text")
+	return nil
 }
 
-// Decrypt runs the decryption process
-func (c *Chain) Decrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) {
-	c.initChain(offset, size, in, out, ck, nonce, true)
-	c.processBlocks(c.decryptBlock)
+// readStolen reads the last two blocks at the end of the cipher text of size bytes, restoring them
+// to chaining order, then seeks back to the start of the cipher text. The last block of plaintext
+// was filled with zeros, so decrypting the last block of cipher text recovers the truncated bytes
+// of the second to last block.
+func (c *Chain) readStolen(size uint64) error {
+	d := size - (c.NBlocks()-1)*modes.BlockSize // bytes in the last block of plaintext
+	b := make([]byte, modes.BlockSize+d)
+	if _, err := c.In.Seek(int64(size-modes.BlockSize-d), 1); err != nil {
+		return &modes.IOError{Op: "seek input", Err: err}
+	}
+	if _, err := io.ReadFull(c.In, b); err != nil {
+		return &modes.IOError{Op: "read input", Err: err}
+	}
+	if _, err := c.In.Seek(-int64(size), 1); err != nil {
+		return &modes.IOError{Op: "seek input", Err: err}
+	}
+	truncated, last := b[:d], b[d:]
+	if c.stealing.swapped(d) {
+		last, truncated = b[:modes.BlockSize], b[modes.BlockSize:]
+	}
+	cn := *state.NewStateFromBytes(last)
+	z := c.cipher.Decrypt(cn, c.Ck)
+	prev := z.GetBytes()
+	copy(prev, truncated)
+	c.stolen = []state.State{*state.NewStateFromBytes(prev), cn}
+	return nil
+}
+
+// Decrypt runs the decryption process, blocks are decrypted concurrently across the CPUs.
+// With ciphertext stealing the last two blocks of cipher text are restored to chaining order first.
+func (c *Chain) Decrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if err := c.initChain(offset, size, in, out, ck, nonce, true); err != nil {
+		return err
+	}
+	if c.stealing != 0 && c.NBlocks() > 1 {
+		if err := c.readStolen(size); err != nil {
+			return err
+		}
+	}
+	if c.sequential {
+		return c.ProcessBlocks(c.decryptBlock)
+	}
+	return c.decryptBuffers()
+}
+
+// NewEncryptingWriter returns a writer that encrypts everything written to it using CBC mode,
+// writing the cipher text to w. Must be closed to write the last padded block, closing does not
+// close w. The output is the same as Encrypt on the whole input.
+func NewEncryptingWriter(w io.Writer, cf cipher.CipherFactory, ck []byte, nonce []byte) (*modes.StreamWriter, error) {
+	c, err := newStreamCipher(cf, ck)
+	if err != nil {
+		return nil, err
+	}
+	last := *state.NewStateFromBytes(nonce)
+	return modes.NewStreamWriter(w, func(blocks []state.State) {
+		for j := range blocks {
+			last.Xor(blocks[j])
+			last = c.Encrypt(last, ck)
+			blocks[j] = last
+		}
+	}), nil
+}
+
+// NewDecryptingReader returns a reader that decrypts the cipher text read from r using CBC mode.
+// The last block is unpadded once the end of r is reached.
+func NewDecryptingReader(r io.Reader, cf cipher.CipherFactory, ck []byte, nonce []byte) (*modes.StreamReader, error) {
+	c, err := newStreamCipher(cf, ck)
+	if err != nil {
+		return nil, err
+	}
+	last := *state.NewStateFromBytes(nonce)
+	return modes.NewStreamReader(r, func(blocks []state.State) {
+		for j, b := range c.DecryptBlocks(blocks, ck) { // decryption of each block is independent
+			b.Xor(last)
+			last = blocks[j]
+			blocks[j] = b
+		}
+	}), nil
+}
+
+// newStreamCipher creates a block cipher with the cipher key expanded, for processing a stream.
+func newStreamCipher(cf cipher.CipherFactory, ck []byte) (*cipher.Cipher, error) {
+	c, err := cf()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Expand(ck); err != nil {
+		return nil, err
+	}
+	return c, nil
 }
@@ -10,9 +10,51 @@ import (
 func BenchmarkEncrypt(b *testing.B) {
 	ck := rand.GetRand(16) // random 128 bit cipher key
 	nonce := rand.GetRand(16)
-	cf := func() *cipher.Cipher {
-		return cipher.NewCipher(cipher.CK128)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.StepEngine)
 	}
 	chain := NewChain(cf)
 	modes.EncryptBenchmark(b, chain, ck, nonce)
 }
+
+func BenchmarkEncryptTable(b *testing.B) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	chain := NewChain(cf)
+	modes.EncryptBenchmark(b, chain, ck, nonce)
+}
+
+func BenchmarkDecryptTable(b *testing.B) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	chain := NewChain(cf)
+	modes.DecryptBenchmark(b, chain, ck, nonce)
+}
+
+// BenchmarkDecryptTableSequential decrypts one block at a time, for comparison with the concurrent decryption.
+func BenchmarkDecryptTableSequential(b *testing.B) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	chain := NewChain(cf)
+	chain.sequential = true
+	modes.DecryptBenchmark(b, chain, ck, nonce)
+}
+
+func BenchmarkEncryptTableCS3(b *testing.B) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	chain := NewChainCS(cf, CS3)
+	modes.EncryptBenchmark(b, chain, ck, nonce)
+}
@@ -1,8 +1,10 @@
 package cbc
 
 import (
+	"encoding/hex"
 	"github.com/emil2k/go-aes/cipher"
 	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/util/bytes"
 	"github.com/emil2k/go-aes/util/rand"
 	"testing"
 )
@@ -10,9 +12,195 @@ import (
 func TestEncryptDecrypt(t *testing.T) {
 	ck := rand.GetRand(16) // random 128 bit cipher key
 	nonce := rand.GetRand(16)
-	cf := func() *cipher.Cipher {
-		return cipher.NewCipher(cipher.CK128)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.StepEngine)
 	}
 	chain := NewChain(cf)
 	modes.EncryptDecryptTest(t, chain, ck, nonce)
 }
+
+// TestDecryptConcurrent tests that concurrent decryption across more than one buffer block matches
+// sequential decryption and the original input.
+func TestDecryptConcurrent(t *testing.T) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	data := rand.GetRand(int(modes.NBufferBlocks*modes.BlockSize) + 40)
+	encrypted := bytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := NewChain(cf).Encrypt(0, uint64(len(data)), bytes.NewReadWriteSeeker(data), encrypted, ck, nonce); err != nil {
+		t.Fatalf("Encrypt failed with %v", err)
+	}
+	decrypt := func(sequential bool) []byte {
+		chain := NewChain(cf)
+		chain.sequential = sequential
+		out := bytes.NewReadWriteSeeker(make([]byte, 0))
+		ct := encrypted.Bytes()
+		if err := chain.Decrypt(0, uint64(len(ct)), bytes.NewReadWriteSeeker(ct), out, ck, nonce); err != nil {
+			t.Fatalf("Decrypt failed with %v", err)
+		}
+		return out.Bytes()
+	}
+	if x := decrypt(false); string(x) != string(data) {
+		t.Errorf("Concurrent decryption failed to match the input")
+	} else if y := decrypt(true); string(x) != string(y) {
+		t.Errorf("Concurrent decryption failed to match sequential decryption")
+	}
+}
+
+// TestContext tests stopping the concurrent decryption when the context is done.
+func TestContext(t *testing.T) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	modes.ContextTest(t, NewChain(cf), ck, rand.GetRand(16))
+}
+
+// TestErrors tests that invalid cipher keys and inputs are returned as errors.
+func TestErrors(t *testing.T) {
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.StepEngine)
+	}
+	chain := NewChain(cf)
+	in := bytes.NewReadWriteSeeker(rand.GetRand(20))
+	out := bytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := chain.Encrypt(0, 20, in, out, rand.GetRand(24), nonce); err != cipher.ErrKeySize {
+		t.Errorf("Encrypt with mismatched cipher key size failed with %v", err)
+	}
+	if err := chain.Decrypt(0, 20, in, out, rand.GetRand(16), nonce); err != modes.ErrShortInput {
+		t.Errorf("Decrypt of partial block failed with %v", err)
+	}
+	cf = func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CipherKeySize(100), cipher.StepEngine)
+	}
+	if err := NewChain(cf).Encrypt(0, 20, in, out, rand.GetRand(16), nonce); err != cipher.ErrKeySize {
+		t.Errorf("Encrypt with invalid cipher factory failed with %v", err)
+	}
+}
+
+// TestStream tests that the streaming writer matches encryption of the whole input, and that the
+// streaming reader reverses it.
+func TestStream(t *testing.T) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	modes.StreamTest(t, NewChain(cf), cf, NewEncryptingWriter, NewDecryptingReader, ck, nonce)
+}
+
+// Example vectors from RFC 3962, appendix B, for AES-128 with ciphertext stealing as CS3 and a zero
+// initialization vector. The plaintexts are prefixes of vectorPlaintext.
+const (
+	vectorKey       = "636869636b656e207465726979616b69"
+	vectorPlaintext = "4920776f756c64206c696b65207468652047656e6572616c20476175277320" +
+		"436869636b656e2c20706c656173652c20616e6420776f6e746f6e20736f75702e"
+)
+
+var vectorsCS3 = []string{
+	"c6353568f2bf8cb4d8a580362da7ff7f97",
+	"fc00783e0efdb2c1d445d4c8eff7ed2297687268d6ecccc0c07b25e25ecfe5",
+	"39312523a78662d5be7fcbcc98ebf5a897687268d6ecccc0c07b25e25ecfe584",
+	"97687268d6ecccc0c07b25e25ecfe584b3fffd940c16a18c1b5549d2f838029e39312523a78662d5be7fcbcc98ebf5",
+	"97687268d6ecccc0c07b25e25ecfe5849dad8bbb96c4cdc03bc103e1a194bbd839312523a78662d5be7fcbcc98ebf5a8",
+	"97687268d6ecccc0c07b25e25ecfe58439312523a78662d5be7fcbcc98ebf5a84807efe836ee89a526730dbc2f7bc840" +
+		"9dad8bbb96c4cdc03bc103e1a194bbd8",
+}
+
+// TestVectorCS3 encrypts the prefixes of the plaintext of the vectors, offset by a header, and
+// checks that the cipher text matches, then decrypts it back to the plaintext.
+func TestVectorCS3(t *testing.T) {
+	ck, _ := hex.DecodeString(vectorKey)
+	pt, _ := hex.DecodeString(vectorPlaintext)
+	iv := make([]byte, 16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	for _, expected := range vectorsCS3 {
+		data := pt[:len(expected)/2]
+		out := bytes.NewReadWriteSeeker(make([]byte, 0))
+		if err := NewChainCS(cf, CS3).Encrypt(3, uint64(len(data)), bytes.NewReadWriteSeeker(data), out, ck, iv); err != nil {
+			t.Fatalf("Encryption of %d bytes failed with %v", len(data), err)
+		}
+		ct := out.Bytes()
+		if x := hex.EncodeToString(ct[3:]); x != expected {
+			t.Errorf("Encryption of %d bytes failed with %s, expected %s", len(data), x, expected)
+		}
+		dOut := bytes.NewReadWriteSeeker(make([]byte, 0))
+		if err := NewChainCS(cf, CS3).Decrypt(3, uint64(len(data)), bytes.NewReadWriteSeeker(ct), dOut, ck, iv); err != nil {
+			t.Fatalf("Decryption of %d bytes failed with %v", len(data), err)
+		}
+		if x := dOut.Bytes(); string(x) != string(data) {
+			t.Errorf("Decryption of %d bytes failed with %s", len(data), hex.EncodeToString(x))
+		}
+	}
+}
+
+// TestStealingVariants tests that the variants only differ in the order of the last two blocks,
+// for inputs with the last two blocks in the same and in separate buffer blocks, and that each
+// decrypts back to the input both sequentially and concurrently.
+func TestStealingVariants(t *testing.T) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	bb := int(modes.NBufferBlocks * modes.BlockSize)
+	for _, n := range []int{16, 17, 31, 32, 33, 100, bb, bb + 5, bb + 16, bb + 21} {
+		data := rand.GetRand(n)
+		encrypt := func(s Stealing) []byte {
+			out := bytes.NewReadWriteSeeker(make([]byte, 0))
+			if err := NewChainCS(cf, s).Encrypt(0, uint64(n), bytes.NewReadWriteSeeker(data), out, ck, nonce); err != nil {
+				t.Fatalf("Encryption of %d bytes with CS%d failed with %v", n, s, err)
+			}
+			if len(out.Bytes()) != n {
+				t.Errorf("Encryption of %d bytes with CS%d output %d bytes", n, s, len(out.Bytes()))
+			}
+			return out.Bytes()
+		}
+		cs1, cs2, cs3 := encrypt(CS1), encrypt(CS2), encrypt(CS3)
+		d := n - (n-1)/16*16 // bytes in the last block
+		if n > 16 {
+			base := n - 16 - d
+			swapped := string(cs3[:base]) + string(cs3[base+16:]) + string(cs3[base:base+16])
+			if string(cs1) != swapped {
+				t.Errorf("Encryption of %d bytes with CS1 should swap the last two blocks of CS3", n)
+			}
+		} else if string(cs1) != string(cs3) {
+			t.Errorf("Encryption of a single block should not depend on the variant")
+		}
+		if expected := map[bool][]byte{true: cs1, false: cs3}[d == 16]; string(cs2) != string(expected) {
+			t.Errorf("Encryption of %d bytes with CS2 failed to match CS1 when whole otherwise CS3", n)
+		}
+		for s, ct := range map[Stealing][]byte{CS1: cs1, CS2: cs2, CS3: cs3} {
+			for _, sequential := range []bool{false, true} {
+				chain := NewChainCS(cf, s)
+				chain.sequential = sequential
+				out := bytes.NewReadWriteSeeker(make([]byte, 0))
+				if err := chain.Decrypt(0, uint64(n), bytes.NewReadWriteSeeker(ct), out, ck, nonce); err != nil {
+					t.Fatalf("Decryption of %d bytes with CS%d failed with %v", n, s, err)
+				} else if string(out.Bytes()) != string(data) {
+					t.Errorf("Decryption of %d bytes with CS%d (sequential? %t) failed to match the input", n, s, sequential)
+				}
+			}
+		}
+	}
+}
+
+// TestStealingShortInput tests that ciphertext stealing requires at least a block.
+func TestStealingShortInput(t *testing.T) {
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	in := bytes.NewReadWriteSeeker(rand.GetRand(15))
+	out := bytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := NewChainCS(cf, CS3).Encrypt(0, 15, in, out, rand.GetRand(16), rand.GetRand(16)); err != modes.ErrShortBlock {
+		t.Errorf("Encrypt of partial block with ciphertext stealing failed with %v", err)
+	}
+	if err := NewChainCS(cf, CS1).Decrypt(0, 15, in, out, rand.GetRand(16), rand.GetRand(16)); err != modes.ErrShortBlock {
+		t.Errorf("Decrypt of partial block with ciphertext stealing failed with %v", err)
+	}
+}
@@ -0,0 +1,260 @@
+package ccm
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/state"
+)
+
+const DefaultTagSize uint64 = 16 // default size of the authentication tag in bytes
+const NonceSize int = 13         // largest nonce size in bytes, leaving 2 bytes to encode the message length
+const MinNonceSize int = 7       // smallest nonce size in bytes, leaving 8 bytes to encode the message length
+
+// ErrTagSize is returned when the tag size is not an even number of bytes from 4 to 16.
+var ErrTagSize = errors.New("ccm : tag size must be an even number of bytes from 4 to 16")
+
+// ErrNonceSize is returned when the nonce is not from 7 to 13 bytes.
+var ErrNonceSize = errors.New("ccm : nonce size must be from 7 to 13 bytes")
+
+// ErrTooLong is returned when the length of the message does not fit in the bytes left by the nonce.
+var ErrTooLong = errors.New("ccm : message too long for the nonce size")
+
+// CCM keeps the state of a counter with CBC-MAC process, as specified by RFC 3610 and NIST SP
+// 800-38C, used for authenticated encryption or decryption. The CBC-MAC of the additional data and
+// the plaintext is encrypted with the first counter block, the plaintext with the following ones.
+// The cipher text is the same length as the plaintext, followed by the tag.
+type CCM struct {
+	modes.Mode
+	TagSize uint64         // size of the authentication tag in bytes
+	cipher  *cipher.Cipher // block cipher instance
+	a0      []byte         // first counter block, the flags and nonce followed by a zero counter
+	x       state.State    // chaining value of the CBC-MAC
+	aad     []byte         // additional authenticated data
+}
+
+// NewCCM constructs a new counter with CBC-MAC instance with the default tag size and logs that
+// discard output.
+func NewCCM(cf cipher.CipherFactory) *CCM {
+	c := &CCM{
+		Mode:    *modes.NewMode(cf),
+		TagSize: DefaultTagSize,
+	}
+	c.Partial = true
+	c.SetPadding(modes.NoPadding)
+	return c
+}
+
+// SetAdditionalData sets the additional data authenticated, but not encrypted, by Encrypt and Decrypt.
+func (c *CCM) SetAdditionalData(aad []byte) {
+	c.aad = aad
+}
+
+// initCCM initializes a counter with CBC-MAC instance either for encryption or decryption of size
+// bytes of plaintext.
+func (c *CCM) initCCM(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte, isDecrypt bool) error {
+	if err := c.InitMode(offset, size, in, out, ck, isDecrypt); err != nil {
+		return err
+	}
+	return c.initMAC(ck, nonce, c.aad, size)
+}
+
+// initMAC checks the sizes and derives the first counter block from the nonce, then starts the
+// CBC-MAC with the first block, which encodes the flags, the nonce, and the length of the size
+// bytes of plaintext, followed by the additional data. The length uses the bytes left by the nonce.
+func (c *CCM) initMAC(ck []byte, nonce []byte, aad []byte, size uint64) (err error) {
+	if c.TagSize < 4 || c.TagSize > 16 || c.TagSize%2 != 0 {
+		return ErrTagSize
+	}
+	if len(nonce) < MinNonceSize || len(nonce) > NonceSize {
+		return ErrNonceSize
+	}
+	l := 15 - len(nonce) // size of the length field in bytes
+	if l < 8 && size>>(8*uint(l)) != 0 {
+		return ErrTooLong
+	}
+	c.Ck = ck
+	if c.cipher, err = c.Cf(); err != nil {
+		return
+	}
+	if err = c.cipher.Expand(ck); err != nil {
+		return
+	}
+	c.a0 = make([]byte, modes.BlockSize)
+	c.a0[0] = byte(l - 1)
+	copy(c.a0[1:], nonce)
+	b0 := make([]byte, modes.BlockSize)
+	if len(aad) > 0 {
+		b0[0] = 0x40
+	}
+	b0[0] |= byte((c.TagSize-2)/2)<<3 | byte(l-1)
+	copy(b0[1:], nonce)
+	putUint(b0[1+len(nonce):], size)
+	c.x = c.cipher.Encrypt(*state.NewStateFromBytes(b0), ck)
+	if len(aad) > 0 {
+		c.mac(append(encodeLength(uint64(len(aad))), aad...), ck)
+	}
+	return
+}
+
+// encodeLength encodes the length of the additional data, in 2 bytes when shorter than 2^16-2^8,
+// otherwise in 4 or 8 bytes following the 0xfffe or 0xffff markers.
+func encodeLength(n uint64) []byte {
+	switch {
+	case n < 0xff00:
+		return []byte{byte(n >> 8), byte(n)}
+	case n <= 0xffffffff:
+		b := []byte{0xff, 0xfe, 0, 0, 0, 0}
+		binary.BigEndian.PutUint32(b[2:], uint32(n))
+		return b
+	default:
+		b := []byte{0xff, 0xff, 0, 0, 0, 0, 0, 0, 0, 0}
+		binary.BigEndian.PutUint64(b[2:], n)
+		return b
+	}
+}
+
+// putUint encodes n as a big endian integer filling the bytes of b, higher bytes are dropped.
+func putUint(b []byte, n uint64) {
+	for i := len(b) - 1; i >= 0; i-- {
+		b[i] = byte(n)
+		n >>= 8
+	}
+}
+
+// mac adds the data to the CBC-MAC, a partial last block is filled with zeros.
+func (c *CCM) mac(data []byte, ck []byte) {
+	for i := 0; i < len(data); i += int(modes.BlockSize) {
+		b := make([]byte, modes.BlockSize)
+		copy(b, data[i:])
+		c.macBlock(*state.NewStateFromBytes(b), ck)
+	}
+}
+
+// macBlock adds the block to the CBC-MAC, xoring it into the chaining value and encrypting it.
+func (c *CCM) macBlock(b state.State, ck []byte) {
+	c.x.Xor(b)
+	c.x = c.cipher.Encrypt(c.x, ck)
+}
+
+// tag returns the authentication tag, the CBC-MAC encrypted with the first counter block then
+// truncated to the tag size.
+func (c *CCM) tag(ck []byte) []byte {
+	t := c.x
+	t.Xor(c.keyStream(0))
+	return t.GetBytes()[:c.TagSize]
+}
+
+// keyStream returns the ith block of the key stream, the encryption of the ith counter block.
+func (c *CCM) keyStream(i uint64) state.State {
+	return c.cipher.Encrypt(getCounterBlock(c.a0, i), c.Ck)
+}
+
+// Seal encrypts and authenticates the plaintext, also authenticating the additional data.
+// Returns the cipher text followed by the authentication tag, the cipher text has the same length
+// as the plaintext.
+func (c *CCM) Seal(ck []byte, nonce []byte, plaintext []byte, aad []byte) ([]byte, error) {
+	if err := c.initMAC(ck, nonce, aad, uint64(len(plaintext))); err != nil {
+		return nil, err
+	}
+	c.mac(plaintext, ck)
+	out := make([]byte, len(plaintext), len(plaintext)+int(c.TagSize))
+	modes.XorKeyStream(out, plaintext, 1, c.keyStream)
+	return append(out, c.tag(ck)...), nil
+}
+
+// Open decrypts the cipher text then verifies the authentication tag at the end of the sealed
+// input. Returns modes.ErrAuthentication without any plaintext if the tag does not verify.
+func (c *CCM) Open(ck []byte, nonce []byte, sealed []byte, aad []byte) ([]byte, error) {
+	if uint64(len(sealed)) < c.TagSize {
+		return nil, modes.ErrShortTag
+	}
+	ct, t := sealed[:uint64(len(sealed))-c.TagSize], sealed[uint64(len(sealed))-c.TagSize:]
+	if err := c.initMAC(ck, nonce, aad, uint64(len(ct))); err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(ct))
+	modes.XorKeyStream(out, ct, 1, c.keyStream)
+	c.mac(out, ck)
+	if subtle.ConstantTimeCompare(c.tag(ck), t) != 1 {
+		return nil, modes.ErrAuthentication
+	}
+	return out, nil
+}
+
+// encryptBlock adds the ith block of plaintext to the CBC-MAC then encrypts it. A partial last
+// block is filled with zeros when read, as the CBC-MAC requires, and trimmed when written.
+func (c *CCM) encryptBlock(i uint64) {
+	b := c.GetBlock(i)
+	c.macBlock(b, c.Ck)
+	b.Xor(c.keyStream(i + 1))
+	c.PutBlock(i, b)
+}
+
+// decryptBlock decrypts the ith block, the cipher text must have already been verified.
+func (c *CCM) decryptBlock(i uint64) {
+	b := c.GetBlock(i)
+	b.Xor(c.keyStream(i + 1))
+	c.PutBlock(i, b)
+}
+
+// verify reads through and decrypts the size bytes of cipher text, adding the plaintext to the
+// CBC-MAC, then reads the tag that follows it, returns modes.ErrAuthentication if the tag does not
+// verify. Nothing is written to the output. Seeks the input back to the offset when done.
+func (c *CCM) verify(size uint64) error {
+	t := make([]byte, c.TagSize)
+	if err := c.ReadChunks(size, t, func(i uint64, chunk []byte) {
+		modes.XorKeyStream(chunk, chunk, i+1, c.keyStream)
+		c.mac(chunk, c.Ck)
+	}); err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(c.tag(c.Ck), t) != 1 {
+		return modes.ErrAuthentication
+	}
+	return nil
+}
+
+// Encrypt encrypts the input using CCM mode, appending the authentication tag to the output.
+// The nonce must be from 7 to 13 bytes, shorter nonces allow longer inputs.
+func (c *CCM) Encrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if err := c.initCCM(offset, size, in, out, ck, nonce, false); err != nil {
+		return err
+	}
+	if err := c.ProcessBlocks(c.encryptBlock); err != nil {
+		return err
+	}
+	if _, err := c.Out.Write(c.tag(ck)); err != nil {
+		return &modes.IOError{Op: "write tag", Err: err}
+	}
+	return nil
+}
+
+// Decrypt verifies the authentication tag at the end of the input, then decrypts the input using
+// CCM mode. The size includes the tag. As the tag authenticates the plaintext the input is
+// decrypted twice, nothing is written to the output if the tag does not verify, returns
+// modes.ErrAuthentication instead.
+func (c *CCM) Decrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if size < c.TagSize {
+		return modes.ErrShortTag
+	}
+	if err := c.initCCM(offset, size-c.TagSize, in, out, ck, nonce, true); err != nil {
+		return err
+	}
+	if err := c.verify(size - c.TagSize); err != nil {
+		return err
+	}
+	return c.ProcessBlocks(c.decryptBlock)
+}
+
+// getCounterBlock gets the ith counter block, the first counter block with the count encoded in
+// the bytes left by the nonce.
+func getCounterBlock(a0 []byte, i uint64) state.State {
+	cb := append([]byte{}, a0...)
+	putUint(cb[modes.BlockSize-uint64(a0[0])-1:], i)
+	return *state.NewStateFromBytes(cb)
+}
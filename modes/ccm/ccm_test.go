@@ -0,0 +1,246 @@
+package ccm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	mbytes "github.com/emil2k/go-aes/util/bytes"
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+// ccmTest is a test case from RFC 3610 or NIST SP 800-38C.
+type ccmTest struct {
+	tagSize                    uint64
+	ck, nonce, pt, aad, sealed string // hex encoded
+}
+
+var ccmTests = []ccmTest{
+	{ // RFC 3610 packet vector 1
+		tagSize: 8,
+		ck:      "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf",
+		nonce:   "00000003020100a0a1a2a3a4a5",
+		pt:      "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e",
+		aad:     "0001020304050607",
+		sealed:  "588c979a61c663d2f066d0c2c0f989806d5f6b61dac38417e8d12cfdf926e0",
+	},
+	{ // RFC 3610 packet vector 2
+		tagSize: 8,
+		ck:      "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf",
+		nonce:   "00000004030201a0a1a2a3a4a5",
+		pt:      "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f",
+		aad:     "0001020304050607",
+		sealed:  "72c91a36e135f8cf291ca894085c87e3cc15c439c9e43a3ba091d56e10400916",
+	},
+	{ // RFC 3610 packet vector 3
+		tagSize: 8,
+		ck:      "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf",
+		nonce:   "00000005040302a0a1a2a3a4a5",
+		pt:      "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f20",
+		aad:     "0001020304050607",
+		sealed:  "51b1e5f44a197d1da46b0f8e2d282ae871e838bb64da8596574adaa76fbd9fb0c5",
+	},
+	{ // RFC 3610 packet vector 4
+		tagSize: 8,
+		ck:      "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf",
+		nonce:   "00000006050403a0a1a2a3a4a5",
+		pt:      "0c0d0e0f101112131415161718191a1b1c1d1e",
+		aad:     "000102030405060708090a0b",
+		sealed:  "a28c6865939a9a79faaa5c4c2a9d4a91cdac8c96c861b9c9e61ef1",
+	},
+	{ // RFC 3610 packet vector 7, 10 byte tag
+		tagSize: 10,
+		ck:      "c0c1c2c3c4c5c6c7c8c9cacbcccdcecf",
+		nonce:   "00000009080706a0a1a2a3a4a5",
+		pt:      "08090a0b0c0d0e0f101112131415161718191a1b1c1d1e",
+		aad:     "0001020304050607",
+		sealed:  "0135d1b2c95f41d5d1d4fec185d166b8094e999dfed96c048c56602c97acbb7490",
+	},
+	{ // RFC 3610 packet vector 13
+		tagSize: 8,
+		ck:      "d7828d13b2b0bdc325a76236df93cc6b",
+		nonce:   "00412b4ea9cdbe3c9696766cfa",
+		pt:      "08e8cf97d820ea258460e96ad9cf5289054d895ceac47c",
+		aad:     "0be1a88bace018b1",
+		sealed:  "4cb97f86a2a4689a877947ab8091ef5386a6ffbdd080f8e78cf7cb0cddd7b3",
+	},
+	{ // NIST SP 800-38C example 1, 7 byte nonce and 4 byte tag
+		tagSize: 4,
+		ck:      "404142434445464748494a4b4c4d4e4f",
+		nonce:   "10111213141516",
+		pt:      "20212223",
+		aad:     "0001020304050607",
+		sealed:  "7162015b4dac255d",
+	},
+	{ // NIST SP 800-38C example 2, 8 byte nonce and 6 byte tag
+		tagSize: 6,
+		ck:      "404142434445464748494a4b4c4d4e4f",
+		nonce:   "1011121314151617",
+		pt:      "202122232425262728292a2b2c2d2e2f",
+		aad:     "000102030405060708090a0b0c0d0e0f",
+		sealed:  "d2a1f0e051ea5f62081a7792073d593d1fc64fbfaccd",
+	},
+	{ // NIST SP 800-38C example 3, 12 byte nonce and 8 byte tag
+		tagSize: 8,
+		ck:      "404142434445464748494a4b4c4d4e4f",
+		nonce:   "101112131415161718191a1b",
+		pt:      "202122232425262728292a2b2c2d2e2f3031323334353637",
+		aad:     "000102030405060708090a0b0c0d0e0f10111213",
+		sealed:  "e3b201a9f5b71a7a9b1ceaeccd97e70b6176aad9a4428aa5484392fbc1b09951",
+	},
+}
+
+// decodeHex decodes a hex string, panics if invalid.
+func decodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err.Error())
+	}
+	return b
+}
+
+// newTestCCM creates a CCM instance for the cipher key size in bytes.
+func newTestCCM(ckLen int) *CCM {
+	return NewCCM(func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CipherKeySize(ckLen*8), cipher.TableEngine)
+	})
+}
+
+func TestSeal(t *testing.T) {
+	for i, tt := range ccmTests {
+		ck := decodeHex(tt.ck)
+		c := newTestCCM(len(ck))
+		c.TagSize = tt.tagSize
+		if x, err := c.Seal(ck, decodeHex(tt.nonce), decodeHex(tt.pt), decodeHex(tt.aad)); err != nil || !bytes.Equal(x, decodeHex(tt.sealed)) {
+			t.Errorf("Seal failed for test %d with %s", i, hex.EncodeToString(x))
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	for i, tt := range ccmTests {
+		ck := decodeHex(tt.ck)
+		c := newTestCCM(len(ck))
+		c.TagSize = tt.tagSize
+		if x, err := c.Open(ck, decodeHex(tt.nonce), decodeHex(tt.sealed), decodeHex(tt.aad)); err != nil {
+			t.Errorf("Open failed for test %d with error : %s", i, err.Error())
+		} else if !bytes.Equal(x, decodeHex(tt.pt)) {
+			t.Errorf("Open failed for test %d with %s", i, hex.EncodeToString(x))
+		}
+	}
+}
+
+// TestEncryptVectors tests that encrypting and decrypting the test vectors as files matches sealing.
+func TestEncryptVectors(t *testing.T) {
+	for i, tt := range ccmTests {
+		ck, nonce, pt, sealed := decodeHex(tt.ck), decodeHex(tt.nonce), decodeHex(tt.pt), decodeHex(tt.sealed)
+		c := newTestCCM(len(ck))
+		c.TagSize = tt.tagSize
+		c.SetAdditionalData(decodeHex(tt.aad))
+		out := mbytes.NewReadWriteSeeker(make([]byte, 0))
+		if err := c.Encrypt(0, uint64(len(pt)), bytes.NewReader(pt), out, ck, nonce); err != nil || !bytes.Equal(out.Bytes(), sealed) {
+			t.Errorf("Encrypt failed for test %d with %s and %v", i, hex.EncodeToString(out.Bytes()), err)
+		}
+		dOut := mbytes.NewReadWriteSeeker(make([]byte, 0))
+		if err := c.Decrypt(0, uint64(len(sealed)), bytes.NewReader(sealed), dOut, ck, nonce); err != nil || !bytes.Equal(dOut.Bytes(), pt) {
+			t.Errorf("Decrypt failed for test %d with %s and %v", i, hex.EncodeToString(dOut.Bytes()), err)
+		}
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	tt := ccmTests[0]
+	ck := decodeHex(tt.ck)
+	c := newTestCCM(len(ck))
+	c.TagSize = tt.tagSize
+	sealed := decodeHex(tt.sealed)
+	sealed[3] ^= 0x01
+	if x, err := c.Open(ck, decodeHex(tt.nonce), sealed, decodeHex(tt.aad)); err != modes.ErrAuthentication {
+		t.Errorf("Open tampered cipher text should fail authentication")
+	} else if x != nil {
+		t.Errorf("Open tampered cipher text should not return plaintext")
+	}
+	if _, err := c.Open(ck, decodeHex(tt.nonce), decodeHex(tt.sealed), nil); err != modes.ErrAuthentication {
+		t.Errorf("Open with missing additional data should fail authentication")
+	}
+	if _, err := c.Open(ck, decodeHex(tt.nonce), sealed[:tt.tagSize-1], nil); err != modes.ErrShortTag {
+		t.Errorf("Open input shorter than tag should fail")
+	}
+}
+
+// TestSizes tests the checks of the tag size, the nonce size, and the length of the message
+// allowed by the nonce size.
+func TestSizes(t *testing.T) {
+	ck := rand.GetRand(16)
+	c := newTestCCM(len(ck))
+	for _, n := range []uint64{0, 2, 5, 18} {
+		c.TagSize = n
+		if _, err := c.Seal(ck, rand.GetRand(NonceSize), nil, nil); err != ErrTagSize {
+			t.Errorf("Seal with %d byte tag should fail with tag size error, got %v", n, err)
+		}
+	}
+	c.TagSize = DefaultTagSize
+	for _, n := range []int{0, MinNonceSize - 1, NonceSize + 1} {
+		if _, err := c.Seal(ck, rand.GetRand(n), nil, nil); err != ErrNonceSize {
+			t.Errorf("Seal with %d byte nonce should fail with nonce size error, got %v", n, err)
+		}
+	}
+	if err := c.initMAC(ck, rand.GetRand(NonceSize), nil, 1<<16); err != ErrTooLong {
+		t.Errorf("Initializing with a message too long for a 13 byte nonce should fail, got %v", err)
+	}
+	if err := c.initMAC(ck, rand.GetRand(NonceSize), nil, 1<<16-1); err != nil {
+		t.Errorf("Initializing with the longest message for a 13 byte nonce failed with %v", err)
+	}
+	if err := c.initMAC(ck, rand.GetRand(MinNonceSize), nil, 1<<40); err != nil {
+		t.Errorf("Initializing with a long message for a 7 byte nonce failed with %v", err)
+	}
+}
+
+func TestEncodeLength(t *testing.T) {
+	test := func(n uint64, out string) {
+		if x := encodeLength(n); !bytes.Equal(x, decodeHex(out)) {
+			t.Errorf("Encoding length %d failed with %s", n, hex.EncodeToString(x))
+		}
+	}
+	test(1, "0001")
+	test(0xfeff, "feff")
+	test(0xff00, "fffe0000ff00")
+	test(0xffffffff, "fffeffffffff")
+	test(1<<32, "ffff0000000100000000")
+}
+
+func TestGetCounterBlock(t *testing.T) {
+	a0 := decodeHex("06101112131415160000000000000000") // 7 byte length field
+	out := decodeHex("06101112131415160000000001020304")
+	cb := getCounterBlock(a0, 0x01020304)
+	if x := cb.GetBytes(); !bytes.Equal(x, out) {
+		t.Errorf("Getting counter block failed with %s", hex.EncodeToString(x))
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(NonceSize)
+	c := newTestCCM(len(ck))
+	c.SetAdditionalData(rand.GetRand(20))
+	modes.EncryptDecryptTest(t, c, ck, nonce)
+}
+
+// TestContext tests stopping when the context is done, including while verifying the tag.
+func TestContext(t *testing.T) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	modes.ContextTest(t, newTestCCM(len(ck)), ck, rand.GetRand(NonceSize))
+}
+
+// TestAuth tests that encrypting matches sealing, and that modified input fails to decrypt.
+// The shortest nonce leaves room for the length of input spanning several buffers.
+func TestAuth(t *testing.T) {
+	ck := rand.GetRand(16)
+	c := newTestCCM(len(ck))
+	nonce := rand.GetRand(MinNonceSize)
+	modes.AuthTest(t, c, ck, nonce, DefaultTagSize, func(plaintext []byte, aad []byte) ([]byte, error) {
+		return c.Seal(ck, nonce, plaintext, aad)
+	})
+}
@@ -0,0 +1,101 @@
+package cfb
+
+import (
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/state"
+	"io"
+)
+
+// CFB keeps the state of a cipher feedback process, used for encryption or decryption.
+// The input is processed in segments, each segment is xored with the encryption of the shift
+// register, then the cipher text segment is shifted into the register.
+type CFB struct {
+	modes.Mode
+	segment  int            // segment size in bytes, divides the block size
+	register []byte         // shift register, starts as the initialization vector
+	cipher   *cipher.Cipher // block cipher instance
+}
+
+// NewCFB creates a new CFB-128 instance, processing a whole block per segment.
+// Pads the input by default, can be length preserving without padding.
+func NewCFB(cf cipher.CipherFactory) *CFB {
+	c := &CFB{
+		Mode:    *modes.NewMode(cf),
+		segment: int(modes.BlockSize),
+	}
+	c.Partial = true
+	return c
+}
+
+// NewCFB8 creates a new CFB-8 instance, processing one byte per segment.
+// Requires an encryption of the block cipher for every byte.
+func NewCFB8(cf cipher.CipherFactory) *CFB {
+	c := &CFB{
+		Mode:    *modes.NewMode(cf),
+		segment: 1,
+	}
+	c.Partial = true
+	return c
+}
+
+// initCFB initializes the instance to run an encryption or decryption.
+func (c *CFB) initCFB(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte, isDecrypt bool) (err error) {
+	if err = c.InitMode(offset, size, in, out, ck, isDecrypt); err != nil {
+		return
+	}
+	c.register = state.NewStateFromBytes(nonce).GetBytes()
+	if c.cipher, err = c.Cf(); err != nil {
+		return
+	}
+	return c.cipher.Expand(ck)
+}
+
+// encryptBlock encrypts the ith block, getting it from the input buffer then putting it
+// into the output buffer after encryption. Should be called iteratively on each block.
+func (c *CFB) encryptBlock(i uint64) {
+	b := c.GetBlock(i)
+	c.PutBlock(i, *state.NewStateFromBytes(c.xorSegments(b.GetBytes(), false)))
+}
+
+// decryptBlock decrypts the ith block, getting it from the input buffer then putting it
+// into the output buffer after decryption. Should be called iteratively on each block.
+func (c *CFB) decryptBlock(i uint64) {
+	b := c.GetBlock(i)
+	c.PutBlock(i, *state.NewStateFromBytes(c.xorSegments(b.GetBytes(), true)))
+}
+
+// xorSegments xors each segment of the input with the encryption of the register, shifting
+// the cipher text segment into the register, which is the input when decrypting.
+func (c *CFB) xorSegments(in []byte, isDecrypt bool) []byte {
+	out := make([]byte, len(in))
+	for s := 0; s < len(in); s += c.segment {
+		ks := c.cipher.Encrypt(*state.NewStateFromBytes(c.register), c.Ck)
+		kb := ks.GetBytes()
+		for j := 0; j < c.segment; j++ {
+			out[s+j] = in[s+j] ^ kb[j]
+		}
+		ct := out[s : s+c.segment]
+		if isDecrypt {
+			ct = in[s : s+c.segment]
+		}
+		c.register = append(c.register[c.segment:], ct...)
+	}
+	return out
+}
+
+// Encrypt encrypts the input using CFB mode.
+func (c *CFB) Encrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if err := c.initCFB(offset, size, in, out, ck, nonce, false); err != nil {
+		return err
+	}
+	return c.ProcessBlocks(c.encryptBlock)
+}
+
+// Decrypt decrypts the input using CFB mode.
+func (c *CFB) Decrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if err := c.initCFB(offset, size, in, out, ck, nonce, true); err != nil {
+		return err
+	}
+	return c.ProcessBlocks(c.decryptBlock)
+}
@@ -0,0 +1,26 @@
+package cfb
+
+import (
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/util/rand"
+	"testing"
+)
+
+func BenchmarkEncrypt(b *testing.B) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	modes.EncryptBenchmark(b, NewCFB(cf), ck, nonce)
+}
+
+func BenchmarkEncryptCFB8(b *testing.B) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	modes.EncryptBenchmark(b, NewCFB8(cf), ck, nonce)
+}
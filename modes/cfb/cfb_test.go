@@ -0,0 +1,98 @@
+package cfb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	mbytes "github.com/emil2k/go-aes/util/bytes"
+	"github.com/emil2k/go-aes/util/rand"
+	"testing"
+)
+
+// Example vectors from NIST SP 800-38A, appendix F.3, for AES-128.
+const (
+	vectorKey       = "2b7e151628aed2a6abf7158809cf4f3c"
+	vectorIV        = "000102030405060708090a0b0c0d0e0f"
+	vectorPlaintext = "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51" +
+		"30c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710"
+	vectorCFB128 = "3b3fd92eb72dad20333449f8e83cfb4ac8a64537a0b3a93fcde3cdad9f1ce58b" +
+		"26751f67a3cbb140b1808cf187a4f4dfc04b05357c5d1c0eeac4c66f9ff7f2e6"
+	vectorCFB8 = "3b79424c9c0dd436bace9e0ed4586a4f32b9" // first 18 bytes of the plaintext
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.StepEngine)
+	}
+	modes.EncryptDecryptTest(t, NewCFB(cf), ck, nonce)
+	modes.EncryptDecryptTest(t, NewCFB8(cf), ck, nonce)
+}
+
+// TestNoPadding tests encryption and decryption of a partial last block without padding.
+func TestNoPadding(t *testing.T) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	for _, c := range []*CFB{NewCFB(cf), NewCFB8(cf)} {
+		c.SetPadding(modes.NoPadding)
+		modes.EncryptDecryptTest(t, c, ck, nonce)
+	}
+}
+
+// vectorTest encrypts the plaintext of the vector and checks that the cipher text, without the
+// padding appended by the mode, matches. Then decrypts the cipher text back to the plaintext.
+func vectorTest(t *testing.T, mode modes.ModeInterface, plaintext, expected string) {
+	ck, _ := hex.DecodeString(vectorKey)
+	iv, _ := hex.DecodeString(vectorIV)
+	data, _ := hex.DecodeString(plaintext)
+	out := mbytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := mode.Encrypt(0, uint64(len(data)), bytes.NewReader(data), out, ck, iv); err != nil {
+		t.Fatalf("Encryption failed with %v", err)
+	}
+	ct := out.Bytes()
+	if x := hex.EncodeToString(ct[:len(data)]); x != expected {
+		t.Errorf("Encryption failed with %s, expected %s", x, expected)
+	}
+	dOut := mbytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := mode.Decrypt(0, uint64(len(ct)), bytes.NewReader(ct), dOut, ck, iv); err != nil {
+		t.Fatalf("Decryption failed with %v", err)
+	}
+	if x := dOut.Bytes(); !bytes.Equal(x, data) {
+		t.Errorf("Decryption failed with %s", hex.EncodeToString(x))
+	}
+}
+
+func TestVectorCFB128(t *testing.T) {
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	vectorTest(t, NewCFB(cf), vectorPlaintext, vectorCFB128)
+}
+
+func TestVectorCFB8(t *testing.T) {
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	vectorTest(t, NewCFB8(cf), vectorPlaintext[:36], vectorCFB8)
+}
+
+// TestErrors tests that invalid cipher keys and inputs are returned as errors.
+func TestErrors(t *testing.T) {
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.StepEngine)
+	}
+	in := mbytes.NewReadWriteSeeker(rand.GetRand(20))
+	out := mbytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := NewCFB(cf).Encrypt(0, 20, in, out, rand.GetRand(24), nonce); err != cipher.ErrKeySize {
+		t.Errorf("Encrypt with mismatched cipher key size failed with %v", err)
+	}
+	if err := NewCFB8(cf).Decrypt(0, 20, in, out, rand.GetRand(16), nonce); err != modes.ErrShortInput {
+		t.Errorf("Decrypt of partial block failed with %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package chunked
+
+import (
+	"encoding/binary"
+	"errors"
+	"io"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/modes/gcm"
+	"github.com/emil2k/go-aes/state"
+)
+
+const DefaultChunkBlocks uint64 = 4096 // default number of plaintext blocks in each chunk, 64 KiB
+const NonceSize int = 7                // size of the nonce prefix in bytes, followed by the chunk counter and flag
+
+// ErrTooManyChunks is returned when the input has more chunks than the chunk counter can number.
+var ErrTooManyChunks = errors.New("chunked : too many chunks for the chunk counter")
+
+// Chunked keeps the state of a chunked authenticated encryption process, following the STREAM
+// construction. The padded plaintext is split into chunks, each sealed with GCM under a nonce made
+// of the nonce prefix, a 4 byte big endian chunk counter, and a 1 byte flag set only for the last
+// chunk. Each chunk of cipher text is followed by its authentication tag, so chunks are verified
+// one at a time without holding the whole input, and truncated, reordered, or modified chunks fail.
+// When decrypting, the chunks before a chunk that fails verification have already been written.
+type Chunked struct {
+	modes.Mode
+	ChunkBlocks uint64   // number of plaintext blocks in each chunk
+	aead        *gcm.GCM // seals and opens each chunk
+	prefix      []byte   // nonce prefix
+	aad         []byte   // additional authenticated data, authenticated with every chunk
+}
+
+// NewChunked creates a new chunked instance with the given CipherFactory instance.
+func NewChunked(cf cipher.CipherFactory) *Chunked {
+	return &Chunked{
+		Mode:        *modes.NewMode(cf),
+		ChunkBlocks: DefaultChunkBlocks,
+		aead:        gcm.NewGCM(cf),
+	}
+}
+
+// SetAdditionalData sets the additional data authenticated, but not encrypted, with every chunk.
+func (c *Chunked) SetAdditionalData(aad []byte) {
+	c.aad = aad
+}
+
+// chunkNonce returns the nonce of the ith chunk, flagging the last chunk.
+func (c *Chunked) chunkNonce(i uint64, last bool) []byte {
+	n := make([]byte, gcm.NonceSize)
+	copy(n, c.prefix)
+	binary.BigEndian.PutUint32(n[NonceSize:], uint32(i))
+	if last {
+		n[gcm.NonceSize-1] = 1
+	}
+	return n
+}
+
+// initChunked initializes the instance to run an encryption or decryption, with each buffer holding
+// the blocks of a chunk, along with its tag when decrypting.
+func (c *Chunked) initChunked(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte, isDecrypt bool) error {
+	if err := c.InitMode(offset, size, in, out, ck, isDecrypt); err != nil {
+		return err
+	}
+	c.prefix = nonce
+	if isDecrypt {
+		c.SetBufferBlocks(c.ChunkBlocks + 1)
+		c.SetOutBlocks(c.NBlocks() - c.NBuffers())
+	} else {
+		c.SetBufferBlocks(c.ChunkBlocks)
+	}
+	if c.NBuffers() > 1<<32 {
+		return ErrTooManyChunks
+	}
+	return nil
+}
+
+// chunkBytes returns the bytes of the blocks of the jth buffer, the chunk, ignoring any blocks
+// read beyond the input.
+func (c *Chunked) chunkBytes(j uint64) []byte {
+	out := make([]byte, 0, uint64(len(c.InBuffer))*modes.BlockSize)
+	for k := range c.InBuffer {
+		i := j*c.BufferBlocks() + uint64(k)
+		if i >= c.NBlocks() {
+			break
+		}
+		b := c.GetBlock(i)
+		out = append(out, b.GetBytes()...)
+	}
+	return out
+}
+
+// putChunk puts the bytes of a processed chunk into the output buffer, as the blocks of the jth buffer.
+func (c *Chunked) putChunk(j uint64, data []byte) {
+	for k := uint64(0); k*modes.BlockSize < uint64(len(data)); k++ {
+		c.PutBlock(j*c.BufferBlocks()+k, *state.NewStateFromBytes(data[k*modes.BlockSize : (k+1)*modes.BlockSize]))
+	}
+}
+
+// Encrypt encrypts the input one chunk at a time, writing the tag of each chunk after its cipher text.
+// The nonce is the nonce prefix, which must be unique for each encryption under a cipher key.
+func (c *Chunked) Encrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if err := c.initChunked(offset, size, in, out, ck, nonce, false); err != nil {
+		return err
+	}
+	for j := uint64(0); j < c.NBuffers(); j++ {
+		if err := c.FillInBuffer(); err != nil {
+			return err
+		}
+		pt := c.chunkBytes(j)
+		sealed, err := c.aead.Seal(ck, c.chunkNonce(j, j == c.NBuffers()-1), pt, c.aad)
+		if err != nil {
+			return err
+		}
+		c.putChunk(j, sealed[:len(pt)])
+		if err := c.FlushOutBuffer(); err != nil {
+			return err
+		}
+		if _, err := c.Out.Write(sealed[len(pt):]); err != nil {
+			return &modes.IOError{Op: "write tag", Err: err}
+		}
+	}
+	c.DebugLog.Println("sealed", c.NBuffers(), "chunks")
+	return nil
+}
+
+// Decrypt verifies and decrypts the input one chunk at a time, the size includes the tags.
+// Returns modes.ErrAuthentication when a chunk fails verification, including when chunks were
+// truncated or reordered, without writing that chunk or any following chunks.
+func (c *Chunked) Decrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if err := c.initChunked(offset, size, in, out, ck, nonce, true); err != nil {
+		return err
+	}
+	for j := uint64(0); j < c.NBuffers(); j++ {
+		if err := c.FillInBuffer(); err != nil {
+			return err
+		}
+		pt, err := c.aead.Open(ck, c.chunkNonce(j, j == c.NBuffers()-1), c.chunkBytes(j), c.aad)
+		if err != nil {
+			return err
+		}
+		if len(pt) == 0 { // only a tag, never sealed
+			return modes.ErrAuthentication
+		}
+		c.putChunk(j, pt)
+		if err := c.FlushOutBuffer(); err != nil {
+			return err
+		}
+	}
+	c.DebugLog.Println("opened", c.NBuffers(), "chunks")
+	return nil
+}
@@ -0,0 +1,15 @@
+package chunked
+
+import (
+	"testing"
+
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+func BenchmarkEncrypt(b *testing.B) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(NonceSize)
+	c := newTestChunked(len(ck), DefaultChunkBlocks)
+	modes.EncryptBenchmark(b, c, ck, nonce)
+}
@@ -0,0 +1,112 @@
+package chunked
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/modes/gcm"
+	mbytes "github.com/emil2k/go-aes/util/bytes"
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+// newTestChunked creates a chunked instance for the cipher key size in bytes, with small chunks.
+func newTestChunked(ckLen int, chunkBlocks uint64) *Chunked {
+	c := NewChunked(func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CipherKeySize(ckLen*8), cipher.TableEngine)
+	})
+	c.ChunkBlocks = chunkBlocks
+	return c
+}
+
+// encrypt encrypts the data and returns the output, failing the test on error.
+func encrypt(t *testing.T, c *Chunked, ck, nonce, data []byte) []byte {
+	out := mbytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := c.Encrypt(0, uint64(len(data)), bytes.NewReader(data), out, ck, nonce); err != nil {
+		t.Fatalf("Encrypt failed with %v", err)
+	}
+	return out.Bytes()
+}
+
+// decrypt decrypts the sealed input and returns the output and error.
+func decrypt(c *Chunked, ck, nonce, sealed []byte) ([]byte, error) {
+	out := mbytes.NewReadWriteSeeker(make([]byte, 0))
+	err := c.Decrypt(0, uint64(len(sealed)), bytes.NewReader(sealed), out, ck, nonce)
+	return out.Bytes(), err
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	for _, cb := range []uint64{1, 3, DefaultChunkBlocks} {
+		ck := rand.GetRand(16) // random 128 bit cipher key
+		nonce := rand.GetRand(NonceSize)
+		c := newTestChunked(len(ck), cb)
+		c.SetAdditionalData(rand.GetRand(20))
+		modes.EncryptDecryptTest(t, c, ck, nonce)
+	}
+}
+
+// TestEncryptSeal tests that each chunk is sealed with GCM under the chunk nonce, the last chunk
+// flagged and holding the padding.
+func TestEncryptSeal(t *testing.T) {
+	ck := rand.GetRand(16)
+	nonce := rand.GetRand(NonceSize)
+	data := rand.GetRand(int(modes.BlockSize)*3 + 5)
+	c := newTestChunked(len(ck), 2)
+	x := encrypt(t, c, ck, nonce, data)
+	g := gcm.NewGCM(c.Cf)
+	first, _ := g.Seal(ck, append(append([]byte{}, nonce...), 0, 0, 0, 0, 0), data[:2*modes.BlockSize], nil)
+	padded := append(append([]byte{}, data[2*modes.BlockSize:]...), bytes.Repeat([]byte{11}, 11)...)
+	last, _ := g.Seal(ck, append(append([]byte{}, nonce...), 0, 0, 0, 1, 1), padded, nil)
+	if expected := append(first, last...); !bytes.Equal(x, expected) {
+		t.Errorf("Encrypt failed with %s, expected %s", hex.EncodeToString(x), hex.EncodeToString(expected))
+	}
+}
+
+// TestDecryptTampered tests that truncated, reordered, and modified chunks fail verification.
+func TestDecryptTampered(t *testing.T) {
+	ck := rand.GetRand(16)
+	nonce := rand.GetRand(NonceSize)
+	data := rand.GetRand(int(modes.BlockSize) * 5) // three chunks of two blocks, with padding
+	c := newTestChunked(len(ck), 2)
+	sealed := encrypt(t, c, ck, nonce, data)
+	n := int(3 * modes.BlockSize) // size of a sealed chunk
+	test := func(b []byte, desc string) {
+		if _, err := decrypt(c, ck, nonce, b); err != modes.ErrAuthentication {
+			t.Errorf("Decrypting %s should return authentication error, got %v", desc, err)
+		}
+	}
+	if x, err := decrypt(c, ck, nonce, sealed); err != nil || !bytes.Equal(x, data) {
+		t.Errorf("Decrypt failed with %v", err)
+	}
+	test(sealed[:2*n], "truncated at a chunk boundary")
+	test(sealed[:len(sealed)-int(modes.BlockSize)], "truncated within a chunk")
+	swapped := append(append(append([]byte{}, sealed[n:2*n]...), sealed[:n]...), sealed[2*n:]...)
+	test(swapped, "reordered chunks")
+	test(append(append([]byte{}, sealed[:n]...), sealed[2*n:]...), "dropped chunk")
+	modified := append([]byte{}, sealed...)
+	modified[n+1] ^= 0x01
+	test(modified, "modified chunk")
+	if x, _ := decrypt(c, ck, nonce, modified); !bytes.Equal(x, data[:2*modes.BlockSize]) {
+		t.Errorf("Decrypting modified chunk should only write the preceding chunks")
+	}
+	c.SetAdditionalData([]byte{0x01})
+	test(sealed, "different additional data")
+}
+
+func TestErrors(t *testing.T) {
+	ck := rand.GetRand(16)
+	nonce := rand.GetRand(NonceSize)
+	c := newTestChunked(len(ck), 2)
+	sealed := encrypt(t, c, ck, nonce, rand.GetRand(10))
+	if _, err := decrypt(c, ck, nonce, sealed[:len(sealed)-1]); err != modes.ErrShortInput {
+		t.Errorf("Decrypting partial block should return short input error, got %v", err)
+	}
+	if _, err := decrypt(c, ck, nonce, sealed[len(sealed)-int(gcm.TagSize):]); err != modes.ErrAuthentication {
+		t.Errorf("Decrypting only a tag should return authentication error, got %v", err)
+	}
+	if err := c.Encrypt(0, 1, bytes.NewReader([]byte{0}), mbytes.NewReadWriteSeeker(nil), rand.GetRand(5), nonce); err != cipher.ErrKeySize {
+		t.Errorf("Encrypting with invalid cipher key should return key size error, got %v", err)
+	}
+}
@@ -0,0 +1,45 @@
+package modes
+
+import (
+	"context"
+	"io"
+)
+
+// SetContext sets the context checked between buffer blocks, when it is canceled or its deadline
+// passes the process stops and returns the context error. A nil context is never done.
+func (m *Mode) SetContext(ctx context.Context) {
+	m.ctx = ctx
+}
+
+// Done returns a channel that is closed when the context is done, for modes that dispatch the
+// blocks of a buffer block to goroutines. Returns nil if there is no context, which is never closed.
+func (m *Mode) Done() <-chan struct{} {
+	if m.ctx == nil {
+		return nil
+	}
+	return m.ctx.Done()
+}
+
+// CheckContext returns the context error if the context is done, otherwise nil.
+func (m *Mode) CheckContext() error {
+	if m.ctx == nil {
+		return nil
+	}
+	return m.ctx.Err()
+}
+
+// EncryptContext runs the encryption of the mode, stopping between buffer blocks when the context
+// is done and returning the context error. The output is incomplete when stopped.
+func EncryptContext(ctx context.Context, mode ModeInterface, offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	mode.SetContext(ctx)
+	defer mode.SetContext(nil)
+	return mode.Encrypt(offset, size, in, out, ck, nonce)
+}
+
+// DecryptContext runs the decryption of the mode, stopping between buffer blocks when the context
+// is done and returning the context error. The output is incomplete when stopped.
+func DecryptContext(ctx context.Context, mode ModeInterface, offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	mode.SetContext(ctx)
+	defer mode.SetContext(nil)
+	return mode.Decrypt(offset, size, in, out, ck, nonce)
+}
@@ -1,6 +1,7 @@
 package ctr
 
 import (
+	"errors"
 	"github.com/emil2k/go-aes/cipher"
 	"github.com/emil2k/go-aes/modes"
 	"github.com/emil2k/go-aes/state"
@@ -10,110 +11,240 @@ import (
 )
 
 const resultsBufferSize int = 30 // buffer size of channel receiving results
+const runBlocks uint64 = 1024    // number of consecutive blocks processed by each goroutine
+
+// ErrRange is returned when the start of a range to decrypt is beyond the end of the plaintext.
+var ErrRange = errors.New("ctr : range starts beyond the end of the plaintext")
 
 // Counter keeps track of the state of a counter cipher mode
 // used for encryption or decryption
 type Counter struct {
 	modes.Mode
-	i     uint64 // keeps track of the counter
-	nonce uint64 // initialization vector
+	i      uint64         // keeps track of the counter
+	nonce  uint64         // initialization vector
+	cipher *cipher.Cipher // block cipher instance with an expanded key, copied for each block
 }
 
-// NewCounter constructs a new counter instance with logs that discard output
+// NewCounter constructs a new counter instance with logs that discard output, without padding so
+// the cipher text is the same length as the plaintext.
 func NewCounter(cf cipher.CipherFactory) *Counter {
-	return &Counter{
+	c := &Counter{
 		Mode: *modes.NewMode(cf),
 	}
+	c.Partial = true
+	c.SetPadding(modes.NoPadding)
+	return c
 }
 
 // initCounter initializes a counter either for encryption or decryption
-func (c *Counter) initCounter(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte, isDecrypt bool) {
-	c.InitMode(offset, size, in, out, ck, isDecrypt)
+func (c *Counter) initCounter(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte, isDecrypt bool) (err error) {
+	if err = c.InitMode(offset, size, in, out, ck, isDecrypt); err != nil {
+		return
+	}
 	c.i = 0
 	c.nonce = bytes.DecodeIntFromBytes(nonce)
+	if c.cipher, err = c.Cf(); err != nil {
+		return
+	}
+	return c.cipher.Expand(ck) // expand once, shared by the copies
 }
 
 // processCore synchronously process buffer blocks.
-func (c *Counter) processCore() {
+func (c *Counter) processCore() error {
 	for i := uint64(0); i < c.NBuffers(); i++ {
-		c.processBuffer()
+		if err := c.processBuffer(); err != nil {
+			return err
+		}
 	}
+	return nil
 }
 
 // processBuffer runs the counter mode on a buffer block, when done it flushes the buffer to output.
-// Blocks inside the buffer block are processed asynchronously on separate goroutines but processing
-// of each buffer block must be done in synchronous fashion.
-func (c *Counter) processBuffer() {
+// Runs of consecutive blocks inside the buffer block are processed asynchronously on separate
+// goroutines, each encrypting the counter blocks of its run together so the bitsliced engine fills
+// its parallel states, but processing of each buffer block must be done in synchronous fashion.
+// When the context is done dispatching stops, the dispatched runs are waited for, then the context
+// error is returned.
+func (c *Counter) processBuffer() error {
 	cpus := runtime.NumCPU()
 	c.DebugLog.Println(cpus, "number of CPUs")
 	c.DebugLog.Println(runtime.GOMAXPROCS(cpus), "previous max procs")
-	sem := make(chan int, runtime.NumCPU())                // controls goroutine allocation
-	results := make(chan *blockPayload, resultsBufferSize) // collects individual completed results
-	var dcount uint64 = 0                                  // keep track of dispatched block processing jobs
-	var rcount uint64 = 0                                  // count of results received
-	c.FillInBuffer()
-Loop:
-	for {
+	if err := c.FillInBuffer(); err != nil {
+		return err
+	}
+	n := uint64(len(c.InBuffer))                         // number of blocks in the buffer
+	sem := make(chan int, runtime.NumCPU())              // controls goroutine allocation
+	results := make(chan *runPayload, resultsBufferSize) // collects individual completed results
+	var dcount uint64 = 0                                // keep track of dispatched blocks
+	var druns uint64 = 0                                 // keep track of dispatched runs
+	var rcount uint64 = 0                                // count of blocks received
+	var rruns uint64 = 0                                 // count of runs received
+	done := c.Done()                                     // closed when the context is done
+	for rcount < n {
 		select {
 		case sem <- 1:
-			if i := c.i + dcount; dcount < modes.NBufferBlocks && i < c.NBlocks() {
-				go func(b *blockPayload) {
-					b.process()
-					results <- b
+			if dcount < n {
+				end := dcount + runBlocks
+				if end > n {
+					end = n
+				}
+				go func(r *runPayload) {
+					r.process()
+					results <- r
 					<-sem
-				}(newBlockPayload(c.Cf(), i, c.GetBlock(i), getCounterBlock(c.nonce, i), c.Ck))
-				dcount++
+				}(newRunPayload(c.cipher.Copy(), c.i+dcount, c.InBuffer[dcount:end], c.nonce, c.Ck))
+				dcount = end
+				druns++
+			}
+		case r := <-results:
+			for k, b := range r.out {
+				c.PutBlock(r.i+uint64(k), b)
 			}
-		case b := <-results:
-			c.PutBlock(b.i, b.out)
-			rcount++
-			if i := c.i + rcount; rcount == modes.NBufferBlocks || i == c.NBlocks() {
-				break Loop
+			rcount += uint64(len(r.out))
+			rruns++
+		case <-done:
+			for ; rruns < druns; rruns++ {
+				<-results
 			}
+			return c.CheckContext()
 		}
 	}
-	c.i += rcount // iterate index by number processed
-	c.FlushOutBuffer()
+	c.i += n // iterate index by number processed
+	return c.FlushOutBuffer()
 }
 
-// blockPayload keeps the state of a block while it is being processed
+// runPayload keeps the state of a run of consecutive blocks while it is being processed
 // in a goroutine and is then sent back as the result over a channel
-type blockPayload struct {
+type runPayload struct {
 	cipher *cipher.Cipher // block cipher used
-	i      uint64         // block number
-	in     state.State    // input block
-	out    state.State    // output of block
+	i      uint64         // block number of the first block
+	in     []state.State  // input blocks
+	nonce  uint64         // initialization vector
+	out    []state.State  // output blocks
 	ck     []byte         // cipher key
-	cb     state.State    // counter block
 }
 
-// newBlockPayload creates a new instance of a block payload
-func newBlockPayload(c *cipher.Cipher, i uint64, in state.State, cb state.State, ck []byte) *blockPayload {
-	return &blockPayload{
-		i:      i,
+// newRunPayload creates a new instance of a run payload starting at the ith block
+func newRunPayload(c *cipher.Cipher, i uint64, in []state.State, nonce uint64, ck []byte) *runPayload {
+	return &runPayload{
 		cipher: c,
+		i:      i,
 		in:     in,
+		nonce:  nonce,
 		ck:     ck,
-		cb:     cb,
 	}
 }
 
-// processBlock processes an individual block payload
-func (b *blockPayload) process() {
-	b.out = b.cipher.Encrypt(b.cb, b.ck) // cipher text from encrypting cipher block
-	b.out.Xor(b.in)
+// process encrypts the counter blocks of the run together, then xors the key stream with the input
+func (r *runPayload) process() {
+	cbs := make([]state.State, len(r.in))
+	for k := range cbs {
+		cbs[k] = getCounterBlock(r.nonce, r.i+uint64(k))
+	}
+	r.out = r.cipher.EncryptBlocks(cbs, r.ck)
+	for k := range r.out {
+		r.out[k].Xor(r.in[k])
+	}
 }
 
 // Encrypt encrypts the input using CTR mode
-func (c *Counter) Encrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) {
-	c.initCounter(offset, size, in, out, ck, nonce, false)
-	c.processCore()
+func (c *Counter) Encrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if err := c.initCounter(offset, size, in, out, ck, nonce, false); err != nil {
+		return err
+	}
+	return c.processCore()
 }
 
 // Decrypt decrypts the input using CTR mode
-func (c *Counter) Decrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) {
-	c.initCounter(offset, size, in, out, ck, nonce, true)
-	c.processCore()
+func (c *Counter) Decrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if err := c.initCounter(offset, size, in, out, ck, nonce, true); err != nil {
+		return err
+	}
+	return c.processCore()
+}
+
+// DecryptRange decrypts length bytes of plaintext starting at byte start, reading only the blocks
+// covering the range from the cipher text of size bytes at offset in the input. Each counter block
+// only depends on its block index, so the range is decrypted without processing the preceding blocks.
+// With padding the last block is also decrypted to find the length of the plaintext, a range
+// extending beyond the end is cut short. Returns ErrRange if start is beyond the end of the
+// plaintext, modes.ErrShortInput if the cipher text is not a whole number of blocks when padded, or
+// modes.ErrBadPadding if the last block has invalid padding.
+func (c *Counter) DecryptRange(offset uint64, size uint64, in io.ReadSeeker, ck []byte, nonce []byte, start uint64, length uint64) ([]byte, error) {
+	p := c.Padding()
+	if size < p.Size(0) || (size%modes.BlockSize != 0 && p != modes.NoPadding) {
+		return nil, modes.ErrShortInput
+	}
+	if size == 0 { // nothing to decrypt, as zero padding adds no block to empty input
+		if start > 0 {
+			return nil, ErrRange
+		}
+		return []byte{}, nil
+	}
+	var err error
+	if c.cipher, err = c.Cf(); err != nil {
+		return nil, err
+	}
+	if err = c.cipher.Expand(ck); err != nil {
+		return nil, err
+	}
+	c.nonce = bytes.DecodeIntFromBytes(nonce)
+	ptLen := size
+	if p != modes.NoPadding { // find the length of the plaintext from the padding of the last block
+		nblocks := size / modes.BlockSize
+		last, err := c.readBlocks(offset, size, in, nblocks-1, nblocks-1, ck)
+		if err != nil {
+			return nil, err
+		}
+		if last, err = p.Unpad(last); err != nil {
+			return nil, err
+		}
+		ptLen = size - modes.BlockSize + uint64(len(last))
+	}
+	if start > ptLen {
+		return nil, ErrRange
+	}
+	if length > ptLen-start {
+		length = ptLen - start
+	}
+	if length == 0 {
+		return []byte{}, nil
+	}
+	first := start / modes.BlockSize
+	out, err := c.readBlocks(offset, size, in, first, (start+length-1)/modes.BlockSize, ck)
+	if err != nil {
+		return nil, err
+	}
+	c.DebugLog.Println("decrypted range of", length, "bytes from byte", start)
+	skip := start - first*modes.BlockSize
+	return out[skip : skip+length], nil
+}
+
+// readBlocks reads and decrypts the blocks from the first to the last index inclusive, seeking
+// directly to the first block of the cipher text of size bytes at offset in the input. A partial
+// last block of the cipher text is filled with zeros.
+func (c *Counter) readBlocks(offset uint64, size uint64, in io.ReadSeeker, first uint64, last uint64, ck []byte) ([]byte, error) {
+	if _, err := in.Seek(int64(offset+first*modes.BlockSize), 0); err != nil {
+		return nil, &modes.IOError{Op: "seek input", Err: err}
+	}
+	b := make([]byte, (last-first+1)*modes.BlockSize)
+	n := uint64(len(b))
+	if end := size - first*modes.BlockSize; end < n {
+		n = end
+	}
+	if _, err := io.ReadFull(in, b[:n]); err != nil {
+		return nil, &modes.IOError{Op: "read input", Err: err}
+	}
+	cbs := make([]state.State, last-first+1)
+	for j := range cbs {
+		cbs[j] = getCounterBlock(c.nonce, first+uint64(j))
+	}
+	for j, ks := range c.cipher.EncryptBlocks(cbs, ck) {
+		s := *state.NewStateFromBytes(b[uint64(j)*modes.BlockSize : uint64(j+1)*modes.BlockSize])
+		s.Xor(ks)
+		copy(b[uint64(j)*modes.BlockSize:], s.GetBytes())
+	}
+	return b, nil
 }
 
 // getCounterBlock gets the ith counter block, the first 8 bytes of the block are the nonce the last 8 bytes
@@ -121,3 +252,54 @@ func (c *Counter) Decrypt(offset uint64, size uint64, in io.ReadSeeker, out io.W
 func getCounterBlock(nonce uint64, i uint64) state.State {
 	return state.State{High: i, Low: nonce}
 }
+
+// NewEncryptingWriter returns a writer that encrypts everything written to it using CTR mode,
+// writing the cipher text to w, without padding. Must be closed to write the last partial block,
+// closing does not close w. The output is the same as Encrypt on the whole input.
+func NewEncryptingWriter(w io.Writer, cf cipher.CipherFactory, ck []byte, nonce []byte) (*modes.StreamWriter, error) {
+	process, err := newStreamFunc(cf, ck, nonce)
+	if err != nil {
+		return nil, err
+	}
+	s := modes.NewStreamWriter(w, process)
+	s.Partial = true
+	s.SetPadding(modes.NoPadding)
+	return s, nil
+}
+
+// NewDecryptingReader returns a reader that decrypts the cipher text read from r using CTR mode.
+// The cipher text is not padded, so the last block can be partial.
+func NewDecryptingReader(r io.Reader, cf cipher.CipherFactory, ck []byte, nonce []byte) (*modes.StreamReader, error) {
+	process, err := newStreamFunc(cf, ck, nonce)
+	if err != nil {
+		return nil, err
+	}
+	s := modes.NewStreamReader(r, process)
+	s.Partial = true
+	s.SetPadding(modes.NoPadding)
+	return s, nil
+}
+
+// newStreamFunc returns a function that xors the key stream into consecutive blocks, starting
+// with the first counter block. The same function encrypts and decrypts.
+func newStreamFunc(cf cipher.CipherFactory, ck []byte, nonce []byte) (modes.StreamFunc, error) {
+	c, err := cf()
+	if err != nil {
+		return nil, err
+	}
+	if err := c.Expand(ck); err != nil {
+		return nil, err
+	}
+	n := bytes.DecodeIntFromBytes(nonce)
+	var i uint64 // counter of the next block
+	return func(blocks []state.State) {
+		cbs := make([]state.State, len(blocks))
+		for j := range cbs {
+			cbs[j] = getCounterBlock(n, i+uint64(j))
+		}
+		for j, ks := range c.EncryptBlocks(cbs, ck) {
+			blocks[j].Xor(ks)
+		}
+		i += uint64(len(blocks))
+	}, nil
+}
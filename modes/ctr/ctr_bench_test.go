@@ -12,21 +12,46 @@ import (
 func BenchmarkEncrypt(b *testing.B) {
 	ck := rand.GetRand(16) // random 128 bit cipher key
 	nonce := rand.GetRand(8)
-	cf := func() *cipher.Cipher {
-		return cipher.NewCipher(cipher.CK128)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.StepEngine)
 	}
 	counter := NewCounter(cf)
 	modes.EncryptBenchmark(b, counter, ck, nonce)
 }
 
-func BenchmarkProcessBlockPayload(b *testing.B) {
+func BenchmarkEncryptTable(b *testing.B) {
 	ck := rand.GetRand(16) // random 128 bit cipher key
-	in := *state.NewStateFromBytes(rand.GetRand(16))
+	nonce := rand.GetRand(8)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	counter := NewCounter(cf)
+	modes.EncryptBenchmark(b, counter, ck, nonce)
+}
+
+func BenchmarkEncryptBitsliced(b *testing.B) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(8)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.BitslicedEngine)
+	}
+	counter := NewCounter(cf)
+	modes.EncryptBenchmark(b, counter, ck, nonce)
+}
+
+func BenchmarkProcessRunPayload(b *testing.B) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	in := make([]state.State, runBlocks)
+	for k := range in {
+		in[k] = *state.NewStateFromBytes(rand.GetRand(16))
+	}
 	nonce := bytes.DecodeIntFromBytes(rand.GetRand(8))
-	block := newBlockPayload(cipher.NewCipher(cipher.CK128), 100000, in, getCounterBlock(nonce, 100000), ck)
+	c, _ := cipher.NewCipher(cipher.CK128, cipher.BitslicedEngine)
+	c.Expand(ck)
+	run := newRunPayload(c, 100000, in, nonce, ck)
 	b.ResetTimer()
 	for i := 0; i < b.N; i++ {
-		block.process()
+		run.process()
 	}
 }
 
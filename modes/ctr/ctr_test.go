@@ -12,13 +12,22 @@ import (
 func TestEncryptDecrypt(t *testing.T) {
 	ck := rand.GetRand(16) // random 128 bit cipher key
 	nonce := rand.GetRand(8)
-	cf := func() *cipher.Cipher {
-		return cipher.NewCipher(cipher.CK128)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.StepEngine)
 	}
 	counter := NewCounter(cf)
 	modes.EncryptDecryptTest(t, counter, ck, nonce)
 }
 
+// TestContext tests stopping the dispatch of blocks when the context is done.
+func TestContext(t *testing.T) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	modes.ContextTest(t, NewCounter(cf), ck, rand.GetRand(8))
+}
+
 func TestGetCounterBlock(t *testing.T) {
 	var nonce, counter uint64 = bytes.DecodeIntFromBytes(rand.GetRand(8)), 255
 	cb := state.State{High: counter, Low: nonce}
@@ -26,3 +35,104 @@ func TestGetCounterBlock(t *testing.T) {
 		t.Errorf("Getting counter block failed %s", x)
 	}
 }
+
+// TestStream tests that the streaming writer matches encryption of the whole input, and that the
+// streaming reader reverses it.
+func TestStream(t *testing.T) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(8)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.BitslicedEngine)
+	}
+	modes.StreamTest(t, NewCounter(cf), cf, NewEncryptingWriter, NewDecryptingReader, ck, nonce)
+}
+
+// TestLengthPreserving tests that without padding, the default, the cipher text is the same length
+// as the plaintext, for inputs ending with partial and whole blocks.
+func TestLengthPreserving(t *testing.T) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(8)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	for _, n := range []int{1, 15, 16, 17, 100, 4096} {
+		data := rand.GetRand(n)
+		enc := bytes.NewReadWriteSeeker(make([]byte, 0))
+		if err := NewCounter(cf).Encrypt(0, uint64(n), bytes.NewReadWriteSeeker(data), enc, ck, nonce); err != nil {
+			t.Fatalf("Encrypting %d bytes failed with error : %v", n, err)
+		} else if len(enc.Bytes()) != n {
+			t.Errorf("Encrypting %d bytes output %d bytes", n, len(enc.Bytes()))
+		}
+		dec := bytes.NewReadWriteSeeker(make([]byte, 0))
+		if err := NewCounter(cf).Decrypt(0, uint64(n), bytes.NewReadWriteSeeker(enc.Bytes()), dec, ck, nonce); err != nil {
+			t.Fatalf("Decrypting %d bytes failed with error : %v", n, err)
+		} else if string(dec.Bytes()) != string(data) {
+			t.Errorf("Decrypting %d bytes failed with %x", n, dec.Bytes())
+		}
+	}
+}
+
+// TestDecryptRange tests that decrypting ranges matches the same bytes of the plaintext, including
+// ranges starting and ending within blocks, and ranges extending beyond the end, with and without
+// padding.
+func TestDecryptRange(t *testing.T) {
+	testDecryptRange(t, modes.NoPadding)
+	testDecryptRange(t, modes.PKCS7Padding)
+}
+
+// TestDecryptRangeEmpty tests decrypting a range of empty cipher text, which zero padding allows,
+// following a header that must not be read as the last block.
+func TestDecryptRangeEmpty(t *testing.T) {
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.BitslicedEngine)
+	}
+	in := bytes.NewReadWriteSeeker(rand.GetRand(int(modes.BlockSize) + 3)) // header only
+	for _, p := range []modes.Padding{modes.ZeroPadding, modes.NoPadding} {
+		counter := NewCounter(cf)
+		counter.SetPadding(p)
+		if x, err := counter.DecryptRange(modes.BlockSize+3, 0, in, rand.GetRand(16), rand.GetRand(8), 0, 10); err != nil || len(x) != 0 {
+			t.Errorf("Decrypting range of empty cipher text failed with %x and %v", x, err)
+		}
+		if _, err := counter.DecryptRange(modes.BlockSize+3, 0, in, rand.GetRand(16), rand.GetRand(8), 1, 10); err != ErrRange {
+			t.Errorf("Decrypting range beyond the end of empty cipher text should return range error, got %v", err)
+		}
+	}
+}
+
+func testDecryptRange(t *testing.T, p modes.Padding) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(8)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.BitslicedEngine)
+	}
+	counter := NewCounter(cf)
+	counter.SetPadding(p)
+	data := rand.GetRand(100)
+	out := bytes.NewReadWriteSeeker(make([]byte, 0))
+	counter.Encrypt(3, uint64(len(data)), bytes.NewReadWriteSeeker(data), out, ck, nonce) // offset by a header
+	in := bytes.NewReadWriteSeeker(out.Bytes())
+	size := uint64(len(out.Bytes())) - 3
+	for _, r := range [][2]uint64{{0, 100}, {0, 1}, {5, 10}, {16, 16}, {15, 2}, {31, 50}, {99, 1}, {90, 50}, {100, 5}} {
+		end := r[0] + r[1]
+		if end > uint64(len(data)) {
+			end = uint64(len(data))
+		}
+		if x, err := counter.DecryptRange(3, size, in, ck, nonce, r[0], r[1]); err != nil {
+			t.Errorf("Decrypting range %v failed with error : %v", r, err)
+		} else if string(x) != string(data[r[0]:end]) {
+			t.Errorf("Decrypting range %v failed with %x", r, x)
+		}
+	}
+	if _, err := counter.DecryptRange(3, size, in, ck, nonce, 101, 1); err != ErrRange {
+		t.Errorf("Decrypting range beyond the end should return range error, got %v", err)
+	}
+	if p == modes.NoPadding {
+		return
+	}
+	if _, err := counter.DecryptRange(3, size-1, in, ck, nonce, 0, 1); err != modes.ErrShortInput {
+		t.Errorf("Decrypting range of partial block should return short input error, got %v", err)
+	}
+	if _, err := counter.DecryptRange(3, size, in, rand.GetRand(16), nonce, 0, 1); err != modes.ErrBadPadding && err != nil {
+		t.Errorf("Decrypting range with wrong cipher key failed with %v", err)
+	}
+}
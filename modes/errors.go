@@ -0,0 +1,51 @@
+package modes
+
+import (
+	"errors"
+)
+
+// ErrShortInput is returned when the input to decrypt is empty or not a whole number of blocks.
+var ErrShortInput = errors.New("modes : input not a whole number of blocks")
+
+// ErrShortBlock is returned by modes with ciphertext stealing when the input is shorter than a block,
+// any longer input being allowed.
+var ErrShortBlock = errors.New("modes : input shorter than a block")
+
+// ErrAuthentication is returned by authenticated modes when the authentication tag does not verify,
+// usually because the input or the additional data were modified.
+var ErrAuthentication = errors.New("modes : message authentication failed")
+
+// ErrShortTag is returned by authenticated modes when the sealed input is shorter than the
+// authentication tag.
+var ErrShortTag = errors.New("modes : input shorter than authentication tag")
+
+// ErrBadPadding is returned when the padding of the last decrypted block is invalid, usually
+// because of a wrong cipher key or corrupted input.
+var ErrBadPadding = errors.New("modes : invalid padding")
+
+// ErrClosed is returned when writing to a stream that has already been closed.
+var ErrClosed = errors.New("modes : write to closed stream")
+
+// ErrIO is matched by every IOError, check for it with errors.Is.
+var ErrIO = errors.New("modes : input output failure")
+
+// IOError records a failure to seek, read, or write the input or output of a mode.
+type IOError struct {
+	Op  string // operation that failed
+	Err error  // underlying error
+}
+
+// Error returns the operation followed by the underlying error.
+func (e *IOError) Error() string {
+	return "modes : " + e.Op + " : " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *IOError) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether the target is ErrIO, so any IOError matches it.
+func (e *IOError) Is(target error) bool {
+	return target == ErrIO
+}
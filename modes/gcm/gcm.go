@@ -0,0 +1,209 @@
+package gcm
+
+import (
+	"crypto/subtle"
+	"errors"
+	"io"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/state"
+)
+
+const TagSize uint64 = 16          // size of the authentication tag in bytes
+const NonceSize int = 12           // recommended nonce size in bytes, other sizes are hashed
+const MaxBlocks uint64 = 1<<32 - 2 // maximum number of blocks of plaintext, as the counter wraps after 2^32 blocks
+
+// ErrTooLong is returned when the plaintext is longer than MaxBlocks blocks, so the counter would
+// wrap around and reuse the key stream.
+var ErrTooLong = errors.New("gcm : input longer than 2^32-2 blocks")
+
+// GCM keeps the state of a galois/counter mode process, used for authenticated encryption
+// or decryption.
+type GCM struct {
+	modes.Mode
+	cipher *cipher.Cipher // block cipher instance
+	hash   *ghash         // authenticates the additional data and cipher text
+	j0     element        // pre-counter block, derived from the nonce
+	aad    []byte         // additional authenticated data
+	size   uint64         // size of the plaintext in bytes
+}
+
+// NewGCM constructs a new galois/counter mode instance with logs that discard output.
+func NewGCM(cf cipher.CipherFactory) *GCM {
+	g := &GCM{
+		Mode: *modes.NewMode(cf),
+	}
+	g.Partial = true
+	g.SetPadding(modes.NoPadding)
+	return g
+}
+
+// SetAdditionalData sets the additional data authenticated, but not encrypted, by Encrypt and Decrypt.
+func (g *GCM) SetAdditionalData(aad []byte) {
+	g.aad = aad
+}
+
+// initGCM initializes a galois/counter mode instance either for encryption or decryption.
+func (g *GCM) initGCM(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte, isDecrypt bool) error {
+	if err := g.InitMode(offset, size, in, out, ck, isDecrypt); err != nil {
+		return err
+	}
+	if g.NBlocks() > MaxBlocks {
+		return ErrTooLong
+	}
+	g.size = size
+	return g.initHash(ck, nonce, g.aad)
+}
+
+// initHash derives the hash subkey and the pre-counter block, then hashes the additional data.
+// The pre-counter block is the nonce followed by a counter of 1 for 12 byte nonces, otherwise it
+// is the GHASH of the nonce.
+func (g *GCM) initHash(ck []byte, nonce []byte, aad []byte) (err error) {
+	g.Ck = ck
+	if g.cipher, err = g.Cf(); err != nil {
+		return
+	}
+	if err = g.cipher.Expand(ck); err != nil {
+		return
+	}
+	hs := g.cipher.Encrypt(state.State{}, ck)
+	h := newElement(hs.GetBytes())
+	if len(nonce) == NonceSize {
+		g.j0 = newElement(append(nonce[:NonceSize:NonceSize], 0x00, 0x00, 0x00, 0x01))
+	} else {
+		jh := newGhash(h)
+		jh.update(nonce)
+		jh.updateLengths(0, uint64(len(nonce)))
+		g.j0 = jh.sum()
+	}
+	g.hash = newGhash(h)
+	g.hash.update(aad)
+	return
+}
+
+// tag finalizes the hash with the length of the additional data and cipher text, in bytes,
+// and returns the authentication tag.
+func (g *GCM) tag(aadLen, ctLen uint64, ck []byte) []byte {
+	g.hash.updateLengths(aadLen, ctLen)
+	ek := g.cipher.Encrypt(getCounterBlock(g.j0, 0), ck)
+	t := newElement(ek.GetBytes())
+	t.xor(g.hash.sum())
+	return t.bytes()
+}
+
+// keyStream returns the ith block of the key stream, the encryption of the ith counter block.
+func (g *GCM) keyStream(i uint64) state.State {
+	return g.cipher.Encrypt(getCounterBlock(g.j0, i), g.Ck)
+}
+
+// Seal encrypts and authenticates the plaintext, also authenticating the additional data.
+// Returns the cipher text followed by the authentication tag, the cipher text has the same length
+// as the plaintext.
+func (g *GCM) Seal(ck []byte, nonce []byte, plaintext []byte, aad []byte) ([]byte, error) {
+	if uint64(len(plaintext)) > MaxBlocks*modes.BlockSize {
+		return nil, ErrTooLong
+	}
+	if err := g.initHash(ck, nonce, aad); err != nil {
+		return nil, err
+	}
+	out := make([]byte, len(plaintext), len(plaintext)+int(TagSize))
+	modes.XorKeyStream(out, plaintext, 1, g.keyStream)
+	g.hash.update(out)
+	return append(out, g.tag(uint64(len(aad)), uint64(len(out)), ck)...), nil
+}
+
+// Open verifies the authentication tag at the end of the sealed input, then decrypts the cipher text.
+// Returns modes.ErrAuthentication without any plaintext if the tag does not verify.
+func (g *GCM) Open(ck []byte, nonce []byte, sealed []byte, aad []byte) ([]byte, error) {
+	if uint64(len(sealed)) < TagSize {
+		return nil, modes.ErrShortTag
+	}
+	ct, t := sealed[:uint64(len(sealed))-TagSize], sealed[uint64(len(sealed))-TagSize:]
+	if uint64(len(ct)) > MaxBlocks*modes.BlockSize {
+		return nil, ErrTooLong
+	}
+	if err := g.initHash(ck, nonce, aad); err != nil {
+		return nil, err
+	}
+	g.hash.update(ct)
+	if subtle.ConstantTimeCompare(g.tag(uint64(len(aad)), uint64(len(ct)), ck), t) != 1 {
+		return nil, modes.ErrAuthentication
+	}
+	out := make([]byte, len(ct))
+	modes.XorKeyStream(out, ct, 1, g.keyStream)
+	return out, nil
+}
+
+// encryptBlock encrypts the ith block and adds the resulting cipher text to the hash. Only the
+// cipher text of a partial last block is hashed, as it is trimmed on output.
+func (g *GCM) encryptBlock(i uint64) {
+	b := g.GetBlock(i)
+	b.Xor(g.keyStream(i + 1))
+	if n := g.size - i*modes.BlockSize; n < modes.BlockSize {
+		g.hash.update(b.GetBytes()[:n])
+	} else {
+		g.hash.updateBlock(newElement(b.GetBytes()))
+	}
+	g.PutBlock(i, b)
+}
+
+// decryptBlock decrypts the ith block, the cipher text must have already been verified.
+func (g *GCM) decryptBlock(i uint64) {
+	b := g.GetBlock(i)
+	b.Xor(g.keyStream(i + 1))
+	g.PutBlock(i, b)
+}
+
+// verify reads through the size bytes of cipher text and the tag that follows it, returns
+// modes.ErrAuthentication if the tag does not verify. Seeks the input back to the offset when done.
+func (g *GCM) verify(size uint64) error {
+	t := make([]byte, TagSize)
+	if err := g.ReadChunks(size, t, func(i uint64, chunk []byte) {
+		g.hash.update(chunk)
+	}); err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(g.tag(uint64(len(g.aad)), size, g.Ck), t) != 1 {
+		return modes.ErrAuthentication
+	}
+	return nil
+}
+
+// Encrypt encrypts the input using GCM mode, appending the authentication tag to the output.
+func (g *GCM) Encrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if err := g.initGCM(offset, size, in, out, ck, nonce, false); err != nil {
+		return err
+	}
+	if err := g.ProcessBlocks(g.encryptBlock); err != nil {
+		return err
+	}
+	if _, err := g.Out.Write(g.tag(uint64(len(g.aad)), size, ck)); err != nil {
+		return &modes.IOError{Op: "write tag", Err: err}
+	}
+	return nil
+}
+
+// Decrypt verifies the authentication tag at the end of the input, then decrypts the input using GCM mode.
+// The size includes the tag. Nothing is written to the output if the tag does not verify, returns
+// modes.ErrAuthentication instead.
+func (g *GCM) Decrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if size < TagSize {
+		return modes.ErrShortTag
+	}
+	if err := g.initGCM(offset, size-TagSize, in, out, ck, nonce, true); err != nil {
+		return err
+	}
+	if err := g.verify(size - TagSize); err != nil {
+		return err
+	}
+	return g.ProcessBlocks(g.decryptBlock)
+}
+
+// getCounterBlock gets the ith counter block, incrementing the last 4 bytes of the pre-counter
+// block as a big endian integer modulo 2^32.
+func getCounterBlock(j0 element, i uint64) state.State {
+	cb := j0
+	cb.low = cb.low&^0xFFFFFFFF + uint64(uint32(cb.low)+uint32(i))
+	return *state.NewStateFromBytes(cb.bytes())
+}
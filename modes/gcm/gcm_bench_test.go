@@ -0,0 +1,24 @@
+package gcm
+
+import (
+	"testing"
+
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+func BenchmarkEncrypt(b *testing.B) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(NonceSize)
+	g := newTestGCM(len(ck))
+	modes.EncryptBenchmark(b, g, ck, nonce)
+}
+
+func BenchmarkMul(b *testing.B) {
+	x := newElement(rand.GetRand(16))
+	y := newElement(rand.GetRand(16))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		mul(x, y)
+	}
+}
@@ -0,0 +1,160 @@
+package gcm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	mbytes "github.com/emil2k/go-aes/util/bytes"
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+// gcmTest is a test case from the GCM specification.
+type gcmTest struct {
+	ck, nonce, pt, aad, sealed string // hex encoded
+}
+
+var gcmTests = []gcmTest{
+	{ // test case 1
+		ck:     "00000000000000000000000000000000",
+		nonce:  "000000000000000000000000",
+		sealed: "58e2fccefa7e3061367f1d57a4e7455a",
+	},
+	{ // test case 2
+		ck:     "00000000000000000000000000000000",
+		nonce:  "000000000000000000000000",
+		pt:     "00000000000000000000000000000000",
+		sealed: "0388dace60b6a392f328c2b971b2fe78ab6e47d42cec13bdf53a67b21257bddf",
+	},
+	{ // test case 4
+		ck:     "feffe9928665731c6d6a8f9467308308",
+		nonce:  "cafebabefacedbaddecaf888",
+		pt:     "d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b39",
+		aad:    "feedfacedeadbeeffeedfacedeadbeefabaddad2",
+		sealed: "42831ec2217774244b7221b784d0d49ce3aa212f2c02a4e035c17e2329aca12e21d514b25466931c7d8f6a5aac84aa051ba30b396a0aac973d58e0915bc94fbc3221a5db94fae95ae7121a47",
+	},
+	{ // test case 6, nonce is not 12 bytes
+		ck:     "feffe9928665731c6d6a8f9467308308",
+		nonce:  "9313225df88406e555909c5aff5269aa6a7a9538534f7da1e4c303d2a318a728c3c0c95156809539fcf0e2429a6b525416aedbf5a0de6a57a637b39b",
+		pt:     "d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b39",
+		aad:    "feedfacedeadbeeffeedfacedeadbeefabaddad2",
+		sealed: "8ce24998625615b603a033aca13fb894be9112a5c3a211a8ba262a3cca7e2ca701e4a9a4fba43c90ccdcb281d48c7c6fd62875d2aca417034c34aee5619cc5aefffe0bfa462af43c1699d050",
+	},
+	{ // test case 16
+		ck:     "feffe9928665731c6d6a8f9467308308feffe9928665731c6d6a8f9467308308",
+		nonce:  "cafebabefacedbaddecaf888",
+		pt:     "d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b39",
+		aad:    "feedfacedeadbeeffeedfacedeadbeefabaddad2",
+		sealed: "522dc1f099567d07f47f37a32a84427d643a8cdcbfe5c0c97598a2bd2555d1aa8cb08e48590dbb3da7b08b1056828838c5f61e6393ba7a0abcc9f66276fc6ece0f4e1768cddf8853bb2d551b",
+	},
+}
+
+// decodeHex decodes a hex string, panics if invalid.
+func decodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err.Error())
+	}
+	return b
+}
+
+// newTestGCM creates a GCM instance for the cipher key size in bytes.
+func newTestGCM(ckLen int) *GCM {
+	return NewGCM(func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CipherKeySize(ckLen*8), cipher.TableEngine)
+	})
+}
+
+func TestSeal(t *testing.T) {
+	for i, tt := range gcmTests {
+		ck := decodeHex(tt.ck)
+		g := newTestGCM(len(ck))
+		if x, err := g.Seal(ck, decodeHex(tt.nonce), decodeHex(tt.pt), decodeHex(tt.aad)); err != nil || !bytes.Equal(x, decodeHex(tt.sealed)) {
+			t.Errorf("Seal failed for test %d with %s", i, hex.EncodeToString(x))
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	for i, tt := range gcmTests {
+		ck := decodeHex(tt.ck)
+		g := newTestGCM(len(ck))
+		if x, err := g.Open(ck, decodeHex(tt.nonce), decodeHex(tt.sealed), decodeHex(tt.aad)); err != nil {
+			t.Errorf("Open failed for test %d with error : %s", i, err.Error())
+		} else if !bytes.Equal(x, decodeHex(tt.pt)) {
+			t.Errorf("Open failed for test %d with %s", i, hex.EncodeToString(x))
+		}
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	tt := gcmTests[2]
+	ck := decodeHex(tt.ck)
+	g := newTestGCM(len(ck))
+	sealed := decodeHex(tt.sealed)
+	sealed[3] ^= 0x01
+	if x, err := g.Open(ck, decodeHex(tt.nonce), sealed, decodeHex(tt.aad)); err != modes.ErrAuthentication {
+		t.Errorf("Open tampered cipher text should fail authentication")
+	} else if x != nil {
+		t.Errorf("Open tampered cipher text should not return plaintext")
+	}
+	if _, err := g.Open(ck, decodeHex(tt.nonce), decodeHex(tt.sealed), nil); err != modes.ErrAuthentication {
+		t.Errorf("Open with missing additional data should fail authentication")
+	}
+	if _, err := g.Open(ck, decodeHex(tt.nonce), sealed[:TagSize-1], nil); err != modes.ErrShortTag {
+		t.Errorf("Open input shorter than tag should fail")
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(NonceSize)
+	g := newTestGCM(len(ck))
+	g.SetAdditionalData(rand.GetRand(20))
+	modes.EncryptDecryptTest(t, g, ck, nonce)
+}
+
+// TestContext tests stopping when the context is done, including while verifying the tag.
+func TestContext(t *testing.T) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	modes.ContextTest(t, newTestGCM(len(ck)), ck, rand.GetRand(NonceSize))
+}
+
+// TestAuth tests that encrypting matches sealing, and that modified input fails to decrypt.
+func TestAuth(t *testing.T) {
+	ck := rand.GetRand(16)
+	g := newTestGCM(len(ck))
+	nonce := rand.GetRand(NonceSize)
+	modes.AuthTest(t, g, ck, nonce, TagSize, func(plaintext []byte, aad []byte) ([]byte, error) {
+		return g.Seal(ck, nonce, plaintext, aad)
+	})
+}
+
+func TestGetCounterBlock(t *testing.T) {
+	j0 := newElement([]byte{0xca, 0xfe, 0xba, 0xbe, 0xfa, 0xce, 0xdb, 0xad, 0xde, 0xca, 0xf8, 0x88, 0xff, 0xff, 0xff, 0xff})
+	out := []byte{0xca, 0xfe, 0xba, 0xbe, 0xfa, 0xce, 0xdb, 0xad, 0xde, 0xca, 0xf8, 0x88, 0x00, 0x00, 0x00, 0x01}
+	cb := getCounterBlock(j0, 2) // wraps around modulo 2^32
+	if x := cb.GetBytes(); !bytes.Equal(x, out) {
+		t.Errorf("Getting counter block failed with %s", hex.EncodeToString(x))
+	}
+}
+
+// TestTooLong tests that inputs longer than 2^32-2 blocks are rejected before anything is read,
+// as the counter would wrap around to the block masking the tag.
+func TestTooLong(t *testing.T) {
+	ck := rand.GetRand(16)
+	nonce := rand.GetRand(NonceSize)
+	g := newTestGCM(len(ck))
+	in, out := bytes.NewReader(nil), mbytes.NewReadWriteSeeker(nil)
+	if err := g.Encrypt(0, (MaxBlocks+1)*modes.BlockSize, in, out, ck, nonce); err != ErrTooLong {
+		t.Errorf("Encrypt of more than the maximum blocks should fail, got %v", err)
+	}
+	if err := g.Decrypt(0, MaxBlocks*modes.BlockSize+1+TagSize, in, out, ck, nonce); err != ErrTooLong {
+		t.Errorf("Decrypt of more than the maximum blocks should fail, got %v", err)
+	}
+	if err := g.initGCM(0, MaxBlocks*modes.BlockSize, in, out, ck, nonce, false); err != nil {
+		t.Errorf("Initializing with the maximum blocks failed with %v", err)
+	}
+}
@@ -0,0 +1,98 @@
+package gcm
+
+// element represents an element of GF(2^128) as used by GHASH.
+// Bytes are stored in big endian order, the most significant bit of the first byte
+// being the coefficient of x^0.
+type element struct {
+	high uint64 // bytes 0-7
+	low  uint64 // bytes 8-15
+}
+
+// r is the reduction constant for GF(2^128), from the polynomial x^128 + x^7 + x^2 + x + 1.
+const r uint64 = 0xe1 << 56
+
+// newElement returns an element from passed byte slice, zero fills if less than 16 bytes.
+func newElement(in []byte) element {
+	b := make([]byte, 16)
+	copy(b, in)
+	var e element
+	for i := 0; i < 8; i++ {
+		e.high = e.high<<8 + uint64(b[i])
+		e.low = e.low<<8 + uint64(b[i+8])
+	}
+	return e
+}
+
+// bytes returns a 16 byte slice representing the element.
+func (e element) bytes() []byte {
+	out := make([]byte, 16)
+	for i := 0; i < 8; i++ {
+		out[7-i] = byte(e.high >> uint(i*8))
+		out[15-i] = byte(e.low >> uint(i*8))
+	}
+	return out
+}
+
+// xor xors the input with the element.
+func (e *element) xor(in element) {
+	e.high ^= in.high
+	e.low ^= in.low
+}
+
+// mul multiplies two elements in GF(2^128), following algorithm 1 of NIST SP 800-38D.
+// Runs in constant time, bits of the elements select masks instead of branches.
+func mul(x, y element) element {
+	var z element
+	v := y
+	for _, w := range [2]uint64{x.high, x.low} {
+		for i := uint(0); i < 64; i++ {
+			mask := -(w >> (63 - i) & 1) // all ones if the bit is set
+			z.high ^= v.high & mask
+			z.low ^= v.low & mask
+			lsb := v.low & 1
+			v.low = v.low>>1 | v.high<<63
+			v.high = v.high>>1 ^ r&-lsb
+		}
+	}
+	return z
+}
+
+// ghash keeps the state of a GHASH computation under a hash subkey.
+type ghash struct {
+	h element // hash subkey
+	y element // current hash value
+}
+
+// newGhash creates a new GHASH instance with the given hash subkey.
+func newGhash(h element) *ghash {
+	return &ghash{h: h}
+}
+
+// updateBlock incorporates a single block into the hash.
+func (g *ghash) updateBlock(b element) {
+	g.y.xor(b)
+	g.y = mul(g.y, g.h)
+}
+
+// update incorporates the data into the hash, zero padding the last partial block.
+func (g *ghash) update(data []byte) {
+	for len(data) > 0 {
+		n := 16
+		if len(data) < n {
+			n = len(data)
+		}
+		g.updateBlock(newElement(data[:n]))
+		data = data[n:]
+	}
+}
+
+// updateLengths incorporates the bit lengths of the additional data and the cipher text, passed
+// in bytes, as the final block of the hash.
+func (g *ghash) updateLengths(aadLen, ctLen uint64) {
+	g.updateBlock(element{high: aadLen * 8, low: ctLen * 8})
+}
+
+// sum returns the current hash value.
+func (g *ghash) sum() element {
+	return g.y
+}
@@ -0,0 +1,49 @@
+package gcm
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+)
+
+func TestElementBytes(t *testing.T) {
+	b := []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	e := newElement(b)
+	if e.high != 0x0011223344556677 || e.low != 0x8899aabbccddeeff {
+		t.Errorf("New element failed with %016x%016x", e.high, e.low)
+	}
+	if x := e.bytes(); !bytes.Equal(x, b) {
+		t.Errorf("Element bytes failed with %s", hex.EncodeToString(x))
+	}
+}
+
+func TestNewElementPartial(t *testing.T) {
+	e := newElement([]byte{0xff})
+	if e.high != 0xff<<56 || e.low != 0 {
+		t.Errorf("New element from partial block failed with %016x%016x", e.high, e.low)
+	}
+}
+
+func TestMulIdentity(t *testing.T) {
+	one := element{high: 1 << 63} // x^0
+	x := newElement([]byte{0x66, 0xe9, 0x4b, 0xd4, 0xef, 0x8a, 0x2c, 0x3b, 0x88, 0x4c, 0xfa, 0x59, 0xca, 0x34, 0x2b, 0x2e})
+	if y := mul(x, one); y != x {
+		t.Errorf("Multiplication by one failed with %016x%016x", y.high, y.low)
+	}
+	if y := mul(one, x); y != x {
+		t.Errorf("Multiplication by one failed with %016x%016x", y.high, y.low)
+	}
+}
+
+// TestGhash uses test case 2 from the GCM specification.
+func TestGhash(t *testing.T) {
+	h := newElement([]byte{0x66, 0xe9, 0x4b, 0xd4, 0xef, 0x8a, 0x2c, 0x3b, 0x88, 0x4c, 0xfa, 0x59, 0xca, 0x34, 0x2b, 0x2e})
+	ct := []byte{0x03, 0x88, 0xda, 0xce, 0x60, 0xb6, 0xa3, 0x92, 0xf3, 0x28, 0xc2, 0xb9, 0x71, 0xb2, 0xfe, 0x78}
+	out := []byte{0xf3, 0x8c, 0xbb, 0x1a, 0xd6, 0x92, 0x23, 0xdc, 0xc3, 0x45, 0x7a, 0xe5, 0xb6, 0xb0, 0xf8, 0x85}
+	g := newGhash(h)
+	g.update(ct)
+	g.updateLengths(0, uint64(len(ct)))
+	if x := g.sum().bytes(); !bytes.Equal(x, out) {
+		t.Errorf("GHASH failed with %s", hex.EncodeToString(x))
+	}
+}
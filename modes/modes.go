@@ -1,6 +1,8 @@
 package modes
 
 import (
+	"context"
+	"crypto/subtle"
 	"github.com/emil2k/go-aes/cipher"
 	"github.com/emil2k/go-aes/state"
 	mlog "github.com/emil2k/go-aes/util/log"
@@ -11,15 +13,27 @@ import (
 
 const BlockSize uint64 = 16             // size of processing blocks in bytes
 const NBufferBlocks uint64 = 100 * 1000 // number of blocks to store in the buffer
+const readBlocks uint64 = 256           // number of blocks to read at a time when reading ahead of processing
 
 // ModeInterface defines the common methods that need to be implemented to operate
 // as a block cipher mode.
 type ModeInterface interface {
-	Encrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte)
-	Decrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte)
+	Encrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error
+	Decrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error
+	SetContext(ctx context.Context)
+	SetProgress(f ProgressFunc)
+	SetPadding(p Padding)
+	Padding() Padding
 	mlog.LeveledLogger
 }
 
+// AuthModeInterface extends ModeInterface for authenticated encryption modes, which also
+// authenticate additional data that is not encrypted.
+type AuthModeInterface interface {
+	ModeInterface
+	SetAdditionalData(aad []byte)
+}
+
 // Mode contains common components for representing the state of block cipher modes
 type Mode struct {
 	Cf        cipher.CipherFactory // creates an instance of the block cipher
@@ -30,14 +44,21 @@ type Mode struct {
 	size      uint64               // size of original input in bytes
 	blocks    uint64               // number of blocks to process
 	buffers   uint64               // number of buffer blocks to process
+	bufBlocks uint64               // number of blocks in each buffer, NBufferBlocks if zero
+	outBlocks uint64               // number of blocks to output, same as the blocks to process if zero
 	Out       io.WriteSeeker       // ouput data stream
 	OutBuffer []state.State        // output buffer
 	putMax    uint64               // tracks maximum put index for trimming output buffer
-	flushed   uint64               // number of flushed output buffers
+	flushed   uint64               // number of flushed output blocks
+	nflushed  uint64               // number of flushed output buffers
 	IsDecrypt bool                 // whether running decryption
+	Partial   bool                 // whether the last block can be partial without padding, as for modes xoring a key stream
+	pad       Padding              // padding scheme, PKCS7Padding if nil
 	ErrorLog  *log.Logger          // log for errors
 	InfoLog   *log.Logger          // log for non-verbose output
 	DebugLog  *log.Logger          // log for verbose output
+	ctx       context.Context      // checked between buffer blocks to stop the process, never done if nil
+	progress  ProgressFunc         // called after each output buffer is flushed, if not nil
 }
 
 // NewMode creates a new instance of a block cipher mode
@@ -52,7 +73,17 @@ func NewMode(cf cipher.CipherFactory) *Mode {
 
 // InitMode initiates the mode for an encryption or decryption process.
 // Requires size and offset of input in bytes as uint64.
-func (m *Mode) InitMode(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, isDecrypt bool) {
+// Returns ErrShortInput if decrypting an input that is not a whole number of blocks or shorter than
+// the padding, or if the input is not a whole number of blocks without padding, unless the mode
+// allows a partial last block. Returns an IOError if the offset can not be seeked.
+func (m *Mode) InitMode(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, isDecrypt bool) error {
+	p := m.Padding()
+	partial := p == NoPadding && m.Partial // whether the last block can be partial
+	if isDecrypt && (size < p.Size(0) || (size%BlockSize != 0 && !partial)) {
+		return ErrShortInput
+	} else if !isDecrypt && p.Size(size)%BlockSize != 0 && !partial {
+		return ErrShortInput
+	}
 	m.IsDecrypt = isDecrypt
 	m.In = in
 	m.Out = out
@@ -61,41 +92,50 @@ func (m *Mode) InitMode(offset uint64, size uint64, in io.ReadSeeker, out io.Wri
 	// Seek the offset in the input file if decrypting or the output file if encrypting.
 	if m.IsDecrypt {
 		if _, seekErr := m.In.Seek(int64(m.offset), 0); seekErr != nil {
-			m.ErrorLog.Panicln("Init mode seek input error : ", seekErr.Error())
+			return &IOError{"seek input", seekErr}
 		}
 	} else {
 		if _, seekErr := m.Out.Seek(int64(m.offset), 0); seekErr != nil {
-			m.ErrorLog.Panicln("Init mode seek output error : ", seekErr.Error())
+			return &IOError{"seek output", seekErr}
 		}
 	}
 	m.size = size
-	m.blocks = calculateBlocks(size, isDecrypt)
+	m.bufBlocks, m.outBlocks = 0, 0
+	m.blocks = calculateBlocks(size, isDecrypt, p)
 	m.buffers = calculateBuffers(m.blocks)
 	m.InBuffer = make([]state.State, 0, calculateBufferSize(m.blocks)) // grows to capacity
 	m.OutBuffer = make([]state.State, calculateBufferSize(m.blocks))   // filled asynchronously
-	m.flushed = 0
+	m.flushed, m.nflushed = 0, 0
 	m.putMax = 0
+	return nil
 }
 
 // GetBlock gets the ith input block, a State instance, from the input buffer.
 func (m *Mode) GetBlock(i uint64) state.State {
-	bi := i % NBufferBlocks // in the current buffer block
+	bi := i % m.BufferBlocks() // in the current buffer block
 	return m.InBuffer[bi]
 }
 
 // FillInBuffer reads in bytes from the main input converts them into State instances and stores
 // them in the input buffer, reset the buffer before starting. Buffering is meant reduce the number
-// of times the procesee seeks and reads from disk.
-func (m *Mode) FillInBuffer() {
+// of times the procesee seeks and reads from disk. Returns an IOError if reading the input fails,
+// or the context error if the context is done, before reading anything.
+func (m *Mode) FillInBuffer() error {
+	if err := m.CheckContext(); err != nil {
+		return err
+	}
 	m.InBuffer = m.InBuffer[0:0]           // resets the input buffer
 	for i := 0; i < cap(m.InBuffer); i++ { // read in bytes for each state
 		t := make([]byte, BlockSize)
-		if n, err := m.In.Read(t); err != nil && err != io.EOF {
-			m.ErrorLog.Println("Filling in buffer error when reading from input : ", err.Error())
+		if n, err := io.ReadFull(m.In, t); err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return &IOError{"read input", err}
 		} else if uint64(n) < BlockSize {
+			t = t[:n] // trim block
 			if !m.IsDecrypt {
-				t = t[:n] // trim block
-				t = padBlock(t)
+				t = m.Padding().Pad(t)
+			}
+			if len(t) > 0 { // partial block without padding is filled with zeros, trimmed on output
+				t = append(t, make([]byte, BlockSize-uint64(len(t)))...)
 				m.InBuffer = append(m.InBuffer, *state.NewStateFromBytes(t))
 			}
 			break // no more to read for this buffer
@@ -103,6 +143,7 @@ func (m *Mode) FillInBuffer() {
 			m.InBuffer = append(m.InBuffer, *state.NewStateFromBytes(t))
 		}
 	}
+	return nil
 }
 
 // padBlock pads an incomplete block with bytes to reach the block size.
@@ -125,42 +166,157 @@ func calculateBufferSize(blocks uint64) uint64 {
 	}
 }
 
+// ProcessBlocks processes all blocks in order with the passed function, one buffer block at a time,
+// filling the input buffer before and flushing the output buffer after each buffer block. The
+// function gets the ith block with GetBlock and puts its output with PutBlock. Returns the first
+// error from filling or flushing the buffers.
+func (m *Mode) ProcessBlocks(process func(i uint64)) error {
+	for j := uint64(0); j < m.NBuffers(); j++ {
+		if err := m.FillInBuffer(); err != nil {
+			return err
+		}
+		for k := uint64(0); k < m.BufferBlocks(); k++ {
+			i := k + j*m.BufferBlocks()
+			if i >= m.NBlocks() {
+				break
+			}
+			process(i)
+		}
+		if err := m.FlushOutBuffer(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadChunks reads the size bytes of input from the current position a few blocks at a time, passing
+// each chunk to the passed function along with the index of its first block, then fills the trailer
+// with the bytes that follow, such as an authentication tag, and seeks the input back to where it
+// started. Lets authenticated modes read through the input before processing it. Returns an
+// IOError if reading or seeking fails, or the context error if the context is done.
+func (m *Mode) ReadChunks(size uint64, trailer []byte, process func(i uint64, chunk []byte)) error {
+	start, err := m.In.Seek(0, 1)
+	if err != nil {
+		return &IOError{Op: "seek input", Err: err}
+	}
+	buf := make([]byte, readBlocks*BlockSize)
+	for i, remain := uint64(0), size; remain > 0; i += readBlocks {
+		if err := m.CheckContext(); err != nil {
+			return err
+		}
+		n := uint64(len(buf))
+		if remain < n {
+			n = remain
+		}
+		if _, err := io.ReadFull(m.In, buf[:n]); err != nil {
+			return &IOError{Op: "read input", Err: err}
+		}
+		process(i, buf[:n])
+		remain -= n
+	}
+	if _, err := io.ReadFull(m.In, trailer); err != nil {
+		return &IOError{Op: "read input", Err: err}
+	}
+	if _, err := m.In.Seek(start, 0); err != nil {
+		return &IOError{Op: "seek input", Err: err}
+	}
+	return nil
+}
+
+// XorKeyStream xors src into dst with the key stream of a counter based mode, the first block using
+// the ith key stream block returned by the passed function. A partial last block uses the start of
+// its key stream block. The dst may be the same slice as src.
+func XorKeyStream(dst, src []byte, i uint64, keyStream func(i uint64) state.State) {
+	for j := 0; j < len(src); j += int(BlockSize) {
+		ks := keyStream(i + uint64(j)/BlockSize)
+		for k, b := range ks.GetBytes() {
+			if j+k >= len(src) {
+				break
+			}
+			dst[j+k] = src[j+k] ^ b
+		}
+	}
+}
+
 // FlusOutBuffer flushes the output buffer to the out writer, then truncates the buffer.
 // Buffering and flushing is meant to reduce the number of times need to write to disk.
-func (m *Mode) FlushOutBuffer() {
-	for _, s := range m.OutBuffer[:m.putMax%NBufferBlocks+1] { // trim based on maximum put index
+// Returns ErrBadPadding if the last decrypted block has invalid padding, or an IOError if
+// writing the output fails. Reports the progress once flushed.
+func (m *Mode) FlushOutBuffer() error {
+	for _, s := range m.OutBuffer[:m.putMax%m.BufferBlocks()+1] { // trim based on maximum put index
 		m.flushed++
 		b := s.GetBytes()
-		if m.IsDecrypt && m.flushed == m.blocks { // last block to flush
-			b = unpadBlock(b)
+		if m.flushed == m.NOutBlocks() { // last block to flush
+			var err error
+			if b, err = m.lastBlock(b); err != nil {
+				return err
+			}
 		}
 		if _, err := m.Out.Write(b); err != nil {
-			m.ErrorLog.Println("Flushing output buffer write error : ", err.Error())
+			return &IOError{"write output", err}
 		}
 	}
-	m.OutBuffer = make([]state.State, calculateBufferSize(m.blocks)) // resets the buffer
+	m.OutBuffer = make([]state.State, m.bufferSize()) // resets the buffer
+	m.nflushed++
+	m.ReportProgress(Progress{Blocks: m.flushed, Total: m.NOutBlocks(), Buffers: m.nflushed})
+	return nil
+}
+
+// lastBlock trims the last block to output when it is a partial block without padding, then
+// removes its padding when decrypting.
+func (m *Mode) lastBlock(b []byte) ([]byte, error) {
+	size := m.size
+	if !m.IsDecrypt {
+		size = m.Padding().Size(size)
+	}
+	if rem := size % BlockSize; rem != 0 {
+		b = b[:rem]
+	}
+	if m.IsDecrypt {
+		return m.Padding().Unpad(b)
+	}
+	return b, nil
 }
 
 // PutBlock sets the ith output block, removing padding of the last block.
 // If the last block is all padding won't write anything.
 func (m *Mode) PutBlock(i uint64, b state.State) {
-	bi := i % NBufferBlocks // in the current buffer
+	bi := i % m.BufferBlocks() // in the current buffer
 	m.OutBuffer[bi] = b
 	if i > m.putMax {
 		m.putMax = i
 	}
 }
 
-// unpadBlock removes the padding of the last block.
-func unpadBlock(b []byte) []byte {
-	pad := int(b[len(b)-1])
-	return b[:len(b)-pad]
+// unpadBlock removes the PKCS#7 padding of the last block.
+// Returns ErrBadPadding if the padding byte is not between 1 and the block size, or any of the
+// padding bytes differ from it. Every byte of the block is checked whatever the padding, so the
+// time taken does not reveal where the padding is invalid.
+func unpadBlock(b []byte) ([]byte, error) {
+	n := len(b)
+	if n == 0 {
+		return nil, ErrBadPadding
+	}
+	pad := int(b[n-1])
+	good := subtle.ConstantTimeLessOrEq(1, pad) & subtle.ConstantTimeLessOrEq(pad, n)
+	for i := 0; i < n; i++ {
+		inPad := subtle.ConstantTimeLessOrEq(n-i, pad) // within the last pad bytes
+		good &= subtle.ConstantTimeByteEq(b[i], byte(pad)) | (inPad ^ 1)
+	}
+	if good != 1 {
+		return nil, ErrBadPadding
+	}
+	return b[:n-pad], nil
 }
 
-// calculateBlocks calculates the number of blocks that need to be processed, based on input size.
-func calculateBlocks(size uint64, isDecrypt bool) (blocks uint64) {
-	blocks = size / BlockSize
+// calculateBlocks calculates the number of blocks that need to be processed, based on input size
+// once padded when encrypting, a partial last block counting as a block.
+func calculateBlocks(size uint64, isDecrypt bool, p Padding) (blocks uint64) {
 	if !isDecrypt {
+		size = p.Size(size)
+	}
+	blocks = size / BlockSize
+	if size%BlockSize != 0 {
 		blocks++
 	}
 	return
@@ -181,6 +337,52 @@ func calculateBuffers(blocks uint64) (buffers uint64) {
 	return
 }
 
+// SetBufferBlocks sets the number of blocks in each buffer, instead of NBufferBlocks, resizing the
+// buffers. Must be called after InitMode, the ith block is then in the buffer i / n.
+// Used by modes that process the input in chunks, each buffer holding a chunk.
+func (m *Mode) SetBufferBlocks(n uint64) {
+	m.bufBlocks = n
+	m.buffers = m.blocks / n
+	if m.blocks%n != 0 {
+		m.buffers++
+	}
+	m.InBuffer = make([]state.State, 0, m.bufferSize())
+	m.OutBuffer = make([]state.State, m.bufferSize())
+}
+
+// bufferSize returns the size of the buffers in number of blocks.
+func (m *Mode) bufferSize() uint64 {
+	if m.bufBlocks == 0 {
+		return calculateBufferSize(m.blocks)
+	}
+	if m.blocks < m.bufBlocks {
+		return m.blocks
+	}
+	return m.bufBlocks
+}
+
+// BufferBlocks returns the number of blocks in each buffer.
+func (m *Mode) BufferBlocks() uint64 {
+	if m.bufBlocks == 0 {
+		return NBufferBlocks
+	}
+	return m.bufBlocks
+}
+
+// SetOutBlocks sets the number of blocks output, when the mode outputs fewer blocks than it processes.
+// Must be called after InitMode, the last block output is unpadded when decrypting.
+func (m *Mode) SetOutBlocks(n uint64) {
+	m.outBlocks = n
+}
+
+// NOutBlocks returns the number of blocks that will be output.
+func (m *Mode) NOutBlocks() uint64 {
+	if m.outBlocks == 0 {
+		return m.blocks
+	}
+	return m.outBlocks
+}
+
 // NBuffers returns the number of buffers that will need to be processed.
 func (m *Mode) NBuffers() uint64 {
 	return m.buffers
@@ -35,7 +35,7 @@ func TestPutBlock(t *testing.T) {
 
 func TestCalculateBlocks(t *testing.T) {
 	test := func(size uint64, isDecrypt bool, blocks uint64) {
-		if x := calculateBlocks(size, isDecrypt); x != blocks {
+		if x := calculateBlocks(size, isDecrypt, PKCS7Padding); x != blocks {
 			t.Errorf("Calculate blocks failed for %d (decrypting? %s) should be %d was %d", size, isDecrypt, blocks, x)
 		}
 	}
@@ -68,7 +68,71 @@ func TestUnpadBlock(t *testing.T) {
 	block := make([]byte, BlockSize/2)
 	copy(block, out)
 	block = padBlock(block)
-	if b := unpadBlock(block); !bytes.Equal(b, out) {
+	if b, err := unpadBlock(block); err != nil || !bytes.Equal(b, out) {
 		t.Errorf("Block unpadding failed with %s", hex.EncodeToString(b))
 	}
 }
+
+func TestUnpadBlockBadPadding(t *testing.T) {
+	test := func(pad byte) {
+		block := make([]byte, BlockSize)
+		block[BlockSize-1] = pad
+		if _, err := unpadBlock(block); err != ErrBadPadding {
+			t.Errorf("Block unpadding with padding byte %d failed with %v, expected bad padding error", pad, err)
+		}
+	}
+	test(0)
+	test(byte(BlockSize + 1))
+	test(0xff)
+}
+
+// TestUnpadBlockMalformed tests every malformed tail of a block, for each padding length a single
+// padding byte differing from the padding length must be rejected.
+func TestUnpadBlockMalformed(t *testing.T) {
+	for pad := 1; pad <= int(BlockSize); pad++ {
+		valid := padBlock(rand.GetRand(int(BlockSize) - pad))
+		if b, err := unpadBlock(append([]byte{}, valid...)); err != nil || !bytes.Equal(b, valid[:int(BlockSize)-pad]) {
+			t.Errorf("Block unpadding with %d bytes of padding failed with %v", pad, err)
+		}
+		for i := int(BlockSize) - pad; i < int(BlockSize)-1; i++ { // the last byte sets the padding length
+			for _, v := range []byte{0, byte(pad - 1), byte(pad + 1), 0xff} {
+				if v == byte(pad) {
+					continue
+				}
+				block := append([]byte{}, valid...)
+				block[i] = v
+				if _, err := unpadBlock(block); err != ErrBadPadding {
+					t.Errorf("Block unpadding with %d bytes of padding and byte %d set to %d failed with %v", pad, i, v, err)
+				}
+			}
+		}
+	}
+	if _, err := unpadBlock(nil); err != ErrBadPadding {
+		t.Errorf("Unpadding empty block failed with %v", err)
+	}
+}
+
+// FuzzUnpadBlock checks that unpadding any block either returns the bad padding error or removes
+// valid padding, matching a straightforward validation of the padding.
+func FuzzUnpadBlock(f *testing.F) {
+	f.Add(padBlock(rand.GetRand(5)))
+	f.Add(padBlock(nil))
+	f.Add(make([]byte, BlockSize))
+	f.Add(bytes.Repeat([]byte{0x11}, int(BlockSize)))
+	f.Add(append(bytes.Repeat([]byte{0x04}, int(BlockSize)-3), 0x03, 0x04, 0x04))
+	f.Fuzz(func(t *testing.T, block []byte) {
+		in := append([]byte{}, block...)
+		b, err := unpadBlock(block)
+		valid := len(in) > 0 && in[len(in)-1] >= 1 && int(in[len(in)-1]) <= len(in)
+		if valid {
+			pad := int(in[len(in)-1])
+			valid = bytes.Equal(in[len(in)-pad:], bytes.Repeat([]byte{byte(pad)}, pad))
+		}
+		switch {
+		case !valid && err != ErrBadPadding:
+			t.Errorf("Unpadding %x should fail with bad padding, got %x and %v", in, b, err)
+		case valid && (err != nil || !bytes.Equal(b, in[:len(in)-int(in[len(in)-1])])):
+			t.Errorf("Unpadding %x failed with %x and %v", in, b, err)
+		}
+	})
+}
@@ -106,7 +106,7 @@ func TestFlushOutBuffer(t *testing.T) {
 		Out:       out,
 		OutBuffer: make([]state.State, bc), // just as in init mode
 		IsDecrypt: false,                   // no unpadding during encryption
-		blocks:    calculateBlocks(uint64(len(data)), false),
+		blocks:    calculateBlocks(uint64(len(data)), false, PKCS7Padding),
 		buffers:   1,
 	}
 	for i := uint64(0); i < uint64(bc); i++ { // fill in output buffer with blocks
@@ -134,7 +134,7 @@ func TestFlushOutBufferPartialUnpadding(t *testing.T) {
 		Out:       out,
 		OutBuffer: make([]state.State, bc), // just as in init mode
 		IsDecrypt: true,                    // unpadding during decryption
-		blocks:    calculateBlocks(uint64(len(data)), true),
+		blocks:    calculateBlocks(uint64(len(data)), true, PKCS7Padding),
 		buffers:   1,
 	}
 	m.OutBuffer[0] = *state.NewStateFromBytes(data) // fill in output buffer
@@ -154,7 +154,7 @@ func TestFlushOutBufferWholeUnpadding(t *testing.T) {
 		Out:       out,
 		OutBuffer: make([]state.State, bc), // just as in init mode
 		IsDecrypt: true,                    // unpadding during decryption
-		blocks:    calculateBlocks(uint64(len(data)), true),
+		blocks:    calculateBlocks(uint64(len(data)), true, PKCS7Padding),
 		buffers:   1,
 	}
 	m.OutBuffer[0] = *state.NewStateFromBytes(data) // fill in output buffer
@@ -174,7 +174,7 @@ func TestFlushOutBufferNoUnpadding(t *testing.T) {
 		Out:       out,
 		OutBuffer: make([]state.State, bc), // just as in init mode
 		IsDecrypt: false,                   // no unpadding during encryption
-		blocks:    calculateBlocks(uint64(len(data)), false),
+		blocks:    calculateBlocks(uint64(len(data)), false, PKCS7Padding),
 		buffers:   1,
 	}
 	m.OutBuffer[0] = *state.NewStateFromBytes(data) // fill in output buffer
@@ -196,7 +196,7 @@ func TestFlushOutBufferUnderCapacity(t *testing.T) {
 		Out:       out,
 		OutBuffer: make([]state.State, bc), // just as in init mode
 		IsDecrypt: false,                   // no unpadding during encryption
-		blocks:    calculateBlocks(uint64(len(data)), true),
+		blocks:    calculateBlocks(uint64(len(data)), true, PKCS7Padding),
 		buffers:   2,
 	}
 	for i := uint64(0); i < m.blocks; i++ { // fill in output buffer with blocks
@@ -213,6 +213,26 @@ func TestFlushOutBufferUnderCapacity(t *testing.T) {
 	}
 }
 
+// TestFlushOutBufferBadPadding tests that invalid padding on the last block is returned as an error
+// without writing the block.
+func TestFlushOutBufferBadPadding(t *testing.T) {
+	data := make([]byte, BlockSize) // padding byte of zero is invalid
+	out := mbytes.NewReadWriteSeeker(make([]byte, 0, len(data)))
+	m := &Mode{
+		Out:       out,
+		OutBuffer: make([]state.State, 1), // just as in init mode
+		IsDecrypt: true,                   // unpadding during decryption
+		blocks:    calculateBlocks(uint64(len(data)), true, PKCS7Padding),
+		buffers:   1,
+	}
+	m.OutBuffer[0] = *state.NewStateFromBytes(data) // fill in output buffer
+	if err := m.FlushOutBuffer(); err != ErrBadPadding {
+		t.Errorf("Flushing output buffer with bad padding failed with %v, expected bad padding error", err)
+	} else if len(out.Bytes()) != 0 {
+		t.Errorf("Flushing output buffer with bad padding should not write the block")
+	}
+}
+
 func TestCalculateBufferSize(t *testing.T) {
 	test := func(blocks, expectedBufferSize uint64) {
 		if x := calculateBufferSize(blocks); x != expectedBufferSize {
@@ -242,3 +262,88 @@ func TestNBuffers(t *testing.T) {
 		t.Errorf("NBuffers failed")
 	}
 }
+
+// TestFlushOutBufferProgress tests that the progress is reported after each flush of the output buffer.
+func TestFlushOutBufferProgress(t *testing.T) {
+	data := append(rand.GetRand(int(BlockSize)*2), padBlock(rand.GetRand(5))...) // last block holds valid padding
+	m := NewMode(nil)
+	m.InitMode(0, uint64(len(data)), mbytes.NewReadWriteSeeker(data), mbytes.NewReadWriteSeeker(nil), nil, true)
+	var reported []Progress
+	m.SetProgress(func(p Progress) {
+		reported = append(reported, p)
+	})
+	m.SetBufferBlocks(2)
+	for j := uint64(0); j < m.NBuffers(); j++ {
+		m.FillInBuffer()
+		for k := uint64(0); k < uint64(len(m.InBuffer)); k++ {
+			m.PutBlock(j*2+k, m.GetBlock(j*2+k))
+		}
+		m.FlushOutBuffer()
+	}
+	expected := []Progress{{Blocks: 2, Total: 3, Buffers: 1}, {Blocks: 3, Total: 3, Buffers: 2}}
+	if len(reported) != len(expected) || reported[0] != expected[0] || reported[1] != expected[1] {
+		t.Errorf("Reporting progress failed with %+v, expected %+v", reported, expected)
+	} else if reported[1].Bytes() != uint64(len(data)) {
+		t.Errorf("Reporting progress failed with %d bytes", reported[1].Bytes())
+	}
+}
+
+// TestProcessBlocks tests that every block is processed once and in order across buffer blocks,
+// the output being flushed after each buffer block, a partial last block trimmed.
+func TestProcessBlocks(t *testing.T) {
+	data := rand.GetRand(int(BlockSize)*4 + 5)
+	out := mbytes.NewReadWriteSeeker(nil)
+	m := NewMode(nil)
+	m.Partial = true
+	m.SetPadding(NoPadding)
+	m.InitMode(0, uint64(len(data)), mbytes.NewReadWriteSeeker(data), out, nil, false)
+	m.SetBufferBlocks(2)
+	var processed []uint64
+	if err := m.ProcessBlocks(func(i uint64) {
+		processed = append(processed, i)
+		m.PutBlock(i, m.GetBlock(i))
+	}); err != nil {
+		t.Fatalf("Processing blocks failed with %v", err)
+	}
+	for k, i := range processed {
+		if i != uint64(k) {
+			t.Errorf("Processing blocks failed with %v", processed)
+			break
+		}
+	}
+	if len(processed) != 5 {
+		t.Errorf("Processing blocks failed with %d blocks processed", len(processed))
+	}
+	if !bytes.Equal(out.Bytes(), data) {
+		t.Errorf("Processing blocks failed with output %s", hex.EncodeToString(out.Bytes()))
+	}
+}
+
+// TestReadChunks tests that the input is read in chunks from the current position, each with the
+// index of its first block, followed by the trailer, then seeked back to where it started.
+func TestReadChunks(t *testing.T) {
+	data := rand.GetRand(int(readBlocks*BlockSize)*2 + 5 + 3) // three chunks then a 3 byte trailer
+	in := mbytes.NewReadWriteSeeker(append(rand.GetRand(7), data...))
+	m := NewMode(nil)
+	m.Partial = true
+	m.SetPadding(NoPadding)
+	m.InitMode(7, uint64(len(data)-3), in, mbytes.NewReadWriteSeeker(nil), nil, true)
+	var read []byte
+	var first []uint64
+	trailer := make([]byte, 3)
+	if err := m.ReadChunks(uint64(len(data)-3), trailer, func(i uint64, chunk []byte) {
+		first = append(first, i)
+		read = append(read, chunk...)
+	}); err != nil {
+		t.Fatalf("Reading chunks failed with %v", err)
+	}
+	if !bytes.Equal(read, data[:len(data)-3]) || !bytes.Equal(trailer, data[len(data)-3:]) {
+		t.Errorf("Reading chunks failed with %s", hex.EncodeToString(read))
+	}
+	if len(first) != 3 || first[0] != 0 || first[1] != readBlocks || first[2] != 2*readBlocks {
+		t.Errorf("Reading chunks failed with first blocks %v", first)
+	}
+	if pos, _ := in.Seek(0, 1); pos != 7 {
+		t.Errorf("Reading chunks should seek back to the start, at %d", pos)
+	}
+}
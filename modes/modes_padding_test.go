@@ -0,0 +1,117 @@
+package modes
+
+import (
+	"bytes"
+	"encoding/hex"
+	mbytes "github.com/emil2k/go-aes/util/bytes"
+	"github.com/emil2k/go-aes/util/rand"
+	"testing"
+)
+
+// TestPaddingRoundTrip tests that unpadding reverses padding for every partial block length, for
+// each padding scheme. The data ends with a non zero byte, so zero padding is reversible.
+func TestPaddingRoundTrip(t *testing.T) {
+	for name, p := range map[string]Padding{"pkcs7": PKCS7Padding, "x923": ANSIX923Padding,
+		"iso7816": ISO7816Padding, "zero": ZeroPadding, "none": NoPadding} {
+		for n := 0; n < int(BlockSize); n++ {
+			data := rand.GetRand(n)
+			if n > 0 {
+				data[n-1] |= 1
+			}
+			padded := p.Pad(append([]byte{}, data...))
+			if l := uint64(len(padded)); l != p.Size(uint64(n)) {
+				t.Errorf("Padding %d bytes with %s padding output %d bytes, expected %d", n, name, l, p.Size(uint64(n)))
+			}
+			if b, err := p.Unpad(padded); err != nil || !bytes.Equal(b, data) {
+				t.Errorf("Unpadding %d bytes with %s padding failed with %s and %v", n, name, hex.EncodeToString(b), err)
+			}
+		}
+	}
+}
+
+func TestPaddingVectors(t *testing.T) {
+	test := func(name string, p Padding, in string, out string) {
+		b, _ := hex.DecodeString(in)
+		if x := hex.EncodeToString(p.Pad(b)); x != out {
+			t.Errorf("Padding %s with %s padding failed with %s, expected %s", in, name, x, out)
+		}
+	}
+	test("pkcs7", PKCS7Padding, "dddddddddddddddddddddd", "dddddddddddddddddddddd0505050505")
+	test("x923", ANSIX923Padding, "dddddddddddddddddddddd", "dddddddddddddddddddddd0000000005")
+	test("iso7816", ISO7816Padding, "dddddddddddddddddddddd", "dddddddddddddddddddddd8000000000")
+	test("zero", ZeroPadding, "dddddddddddddddddddddd", "dddddddddddddddddddddd0000000000")
+	test("zero", ZeroPadding, "", "")
+	test("none", NoPadding, "dddddddddddddddddddddd", "dddddddddddddddddddddd")
+}
+
+func TestPaddingSize(t *testing.T) {
+	test := func(name string, p Padding, n uint64, size uint64) {
+		if x := p.Size(n); x != size {
+			t.Errorf("Size of %d bytes with %s padding failed with %d, expected %d", n, name, x, size)
+		}
+	}
+	test("pkcs7", PKCS7Padding, 0, 16)
+	test("pkcs7", PKCS7Padding, 16, 32)
+	test("x923", ANSIX923Padding, 17, 32)
+	test("iso7816", ISO7816Padding, 15, 16)
+	test("zero", ZeroPadding, 0, 0)
+	test("zero", ZeroPadding, 16, 16)
+	test("zero", ZeroPadding, 17, 32)
+	test("none", NoPadding, 17, 17)
+}
+
+func TestUnpadBadPadding(t *testing.T) {
+	test := func(name string, p Padding, in string) {
+		b, _ := hex.DecodeString(in)
+		if _, err := p.Unpad(b); err != ErrBadPadding {
+			t.Errorf("Unpadding %s with %s padding should return bad padding error, got %v", in, name, err)
+		}
+	}
+	test("x923", ANSIX923Padding, "dddddddddddddddddddddd0000000000")
+	test("x923", ANSIX923Padding, "dddddddddddddddddddddd0000000011")
+	test("x923", ANSIX923Padding, "dddddddddddddddddddddd0000010005")
+	test("x923", ANSIX923Padding, "")
+	test("iso7816", ISO7816Padding, "dddddddddddddddddddddd0000000000")
+	test("iso7816", ISO7816Padding, "00000000000000000000000000000000")
+	test("iso7816", ISO7816Padding, "dddddddddddddddddddddd8000000001")
+	test("iso7816", ISO7816Padding, "")
+}
+
+func TestCalculateBlocksPadding(t *testing.T) {
+	test := func(name string, p Padding, size uint64, isDecrypt bool, blocks uint64) {
+		if x := calculateBlocks(size, isDecrypt, p); x != blocks {
+			t.Errorf("Calculate blocks with %s padding failed for %d (decrypting? %t) should be %d was %d", name, size, isDecrypt, blocks, x)
+		}
+	}
+	test("pkcs7", PKCS7Padding, 16, false, 2)
+	test("zero", ZeroPadding, 16, false, 1)
+	test("zero", ZeroPadding, 0, false, 0)
+	test("none", NoPadding, 17, false, 2)
+	test("none", NoPadding, 17, true, 2)
+}
+
+// TestInitModePadding tests that without padding only modes allowing a partial last block accept one.
+func TestInitModePadding(t *testing.T) {
+	m := NewMode(nil)
+	m.SetPadding(NoPadding)
+	in, out := mbytes.NewReadWriteSeeker(make([]byte, 0)), mbytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := m.InitMode(0, 17, in, out, nil, false); err != ErrShortInput {
+		t.Errorf("Init of encryption of a partial block without padding should return short input error, got %v", err)
+	}
+	if err := m.InitMode(0, 17, in, out, nil, true); err != ErrShortInput {
+		t.Errorf("Init of decryption of a partial block without padding should return short input error, got %v", err)
+	}
+	if err := m.InitMode(0, 32, in, out, nil, false); err != nil {
+		t.Errorf("Init of encryption of whole blocks without padding failed with %v", err)
+	}
+	m.Partial = true
+	if err := m.InitMode(0, 17, in, out, nil, true); err != nil {
+		t.Errorf("Init of decryption of a partial block allowed by the mode failed with %v", err)
+	} else if m.NBlocks() != 2 {
+		t.Errorf("Init of decryption of a partial block allowed by the mode has %d blocks, expected 2", m.NBlocks())
+	}
+	m.SetPadding(nil)
+	if m.Padding() != PKCS7Padding {
+		t.Errorf("Default padding should be PKCS#7")
+	}
+}
@@ -0,0 +1,140 @@
+package modes
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"github.com/emil2k/go-aes/state"
+	"github.com/emil2k/go-aes/util/rand"
+	"io"
+	"io/ioutil"
+	"testing"
+	"testing/iotest"
+)
+
+// countBlocks returns a stream function that xors the index of each block into its last byte,
+// so the output depends on the position of the block in the stream.
+func countBlocks() StreamFunc {
+	var i uint64
+	return func(blocks []state.State) {
+		for j := range blocks {
+			blocks[j].Xor(state.State{High: i << 56})
+			i++
+		}
+	}
+}
+
+// TestStreamWriter tests that writing in uneven pieces pads and processes the input as a whole.
+func TestStreamWriter(t *testing.T) {
+	data := rand.GetRand(int(BlockSize)*5 + 3)
+	out := new(bytes.Buffer)
+	sw := NewStreamWriter(out, countBlocks())
+	for _, p := range [][]byte{data[:1], data[1:20], data[20:32], data[32:]} {
+		if n, err := sw.Write(p); err != nil || n != len(p) {
+			t.Fatalf("Stream write failed with %d bytes written, error %v", n, err)
+		}
+	}
+	if uint64(out.Len()) != BlockSize*5 {
+		t.Errorf("Stream write should only output whole blocks before closing, output %d bytes", out.Len())
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatalf("Stream close failed with %v", err)
+	}
+	whole := BlockSize * 5
+	expected := bytesToBlocks(append(append([]byte{}, data[:whole]...), padBlock(append([]byte{}, data[whole:]...))...))
+	countBlocks()(expected)
+	if x := out.Bytes(); !bytes.Equal(x, blocksToBytes(expected)) {
+		t.Errorf("Stream write failed with %s", hex.EncodeToString(x))
+	}
+	if _, err := sw.Write(data); err != ErrClosed {
+		t.Errorf("Stream write after close failed with %v, expected closed error", err)
+	}
+}
+
+// TestStreamWriterWholePadding tests that a whole block of padding is added when the input is a
+// whole number of blocks, including empty input.
+func TestStreamWriterWholePadding(t *testing.T) {
+	test := func(size int) {
+		out := new(bytes.Buffer)
+		sw := NewStreamWriter(out, func([]state.State) {})
+		sw.Write(make([]byte, size))
+		sw.Close()
+		if uint64(out.Len()) != uint64(size)+BlockSize {
+			t.Errorf("Stream write of %d bytes should add a block of padding, output %d bytes", size, out.Len())
+		}
+	}
+	test(0)
+	test(int(BlockSize) * 2)
+}
+
+// TestStreamReader tests that reading one byte at a time processes and unpads the input as a whole.
+func TestStreamReader(t *testing.T) {
+	data := rand.GetRand(int(BlockSize)*5 + 3)
+	in := new(bytes.Buffer)
+	sw := NewStreamWriter(in, countBlocks())
+	sw.Write(data)
+	sw.Close()
+	sr := NewStreamReader(iotest.OneByteReader(in), countBlocks()) // xor is its own inverse
+	if x, err := ioutil.ReadAll(sr); err != nil {
+		t.Errorf("Stream read failed with %v", err)
+	} else if !bytes.Equal(x, data) {
+		t.Errorf("Stream read failed with %s, expected %s", hex.EncodeToString(x), hex.EncodeToString(data))
+	}
+}
+
+// TestStreamReaderErrors tests that invalid input and read failures are returned as errors.
+func TestStreamReaderErrors(t *testing.T) {
+	test := func(r io.Reader, expected error) {
+		sr := NewStreamReader(r, func([]state.State) {})
+		if _, err := ioutil.ReadAll(sr); !errors.Is(err, expected) {
+			t.Errorf("Stream read failed with %v, expected %v", err, expected)
+		}
+	}
+	test(bytes.NewReader(nil), ErrShortInput)
+	test(bytes.NewReader(make([]byte, BlockSize+1)), ErrShortInput)
+	test(bytes.NewReader(make([]byte, BlockSize)), ErrBadPadding)
+	test(iotest.TimeoutReader(bytes.NewReader(make([]byte, BlockSize))), ErrIO)
+}
+
+// TestStreamPadding tests that streams round trip with each padding scheme, and that without
+// padding the output is the same length as the input.
+func TestStreamPadding(t *testing.T) {
+	for name, p := range map[string]Padding{"x923": ANSIX923Padding, "iso7816": ISO7816Padding, "none": NoPadding} {
+		for _, size := range []int{0, 3, int(BlockSize), int(BlockSize)*5 + 3} {
+			data := rand.GetRand(size)
+			in := new(bytes.Buffer)
+			sw := NewStreamWriter(in, countBlocks())
+			sw.Partial = true
+			sw.SetPadding(p)
+			sw.Write(data)
+			sw.Close()
+			if l := uint64(in.Len()); l != p.Size(uint64(size)) {
+				t.Errorf("Stream write of %d bytes with %s padding output %d bytes, expected %d", size, name, l, p.Size(uint64(size)))
+			}
+			sr := NewStreamReader(iotest.OneByteReader(in), countBlocks())
+			sr.Partial = true
+			sr.SetPadding(p)
+			if x, err := ioutil.ReadAll(sr); err != nil {
+				t.Errorf("Stream read of %d bytes with %s padding failed with %v", size, name, err)
+			} else if !bytes.Equal(x, data) {
+				t.Errorf("Stream read of %d bytes with %s padding failed with %s", size, name, hex.EncodeToString(x))
+			}
+		}
+	}
+}
+
+// TestStreamNoPaddingPartial tests that without padding a partial last block is rejected, unless
+// a key stream mode.
+func TestStreamNoPaddingPartial(t *testing.T) {
+	sw := NewStreamWriter(new(bytes.Buffer), func([]state.State) {})
+	sw.SetPadding(NoPadding)
+	sw.Write(make([]byte, BlockSize+1))
+	if err := sw.Close(); err != ErrShortInput {
+		t.Errorf("Stream close with a partial block without padding failed with %v, expected short input error", err)
+	}
+	sr := NewStreamReader(bytes.NewReader(make([]byte, BlockSize+1)), func([]state.State) {})
+	sr.SetPadding(NoPadding)
+	if _, err := ioutil.ReadAll(sr); err != ErrShortInput {
+		t.Errorf("Stream read of a partial block without padding failed with %v, expected short input error", err)
+	}
+}
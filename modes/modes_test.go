@@ -1,7 +1,10 @@
 package modes
 
 import (
+	"context"
+	"errors"
 	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/state"
 	"github.com/emil2k/go-aes/util/bytes"
 	"github.com/emil2k/go-aes/util/rand"
 	"log"
@@ -10,7 +13,7 @@ import (
 )
 
 func TestNewMode(t *testing.T) {
-	m := NewMode(func() *cipher.Cipher { return cipher.NewCipher(cipher.CK128) })
+	m := NewMode(func() (*cipher.Cipher, error) { return cipher.NewCipher(cipher.CK128, cipher.StepEngine) })
 	switch {
 	case m.Cf == nil:
 		t.Errorf("New mode failed cipher factory not set")
@@ -20,17 +23,19 @@ func TestNewMode(t *testing.T) {
 }
 
 func TestInitMode(t *testing.T) {
-	m := NewMode(func() *cipher.Cipher { return cipher.NewCipher(cipher.CK128) })
+	m := NewMode(func() (*cipher.Cipher, error) { return cipher.NewCipher(cipher.CK128, cipher.StepEngine) })
 	data := rand.GetRand(int(BlockSize) * 10)
 	var offset, size uint64 = 10, uint64(len(data))
 	in := bytes.NewReadWriteSeeker(data)
 	out := bytes.NewReadWriteSeeker(make([]byte, len(data)))
 	ck := rand.GetRand(16)
 	isDecrypt := true
-	blocks := calculateBlocks(size, isDecrypt)
+	blocks := calculateBlocks(size, isDecrypt, PKCS7Padding)
 	buffers := calculateBuffers(blocks)
 	bufferSize := calculateBufferSize(blocks)
-	m.InitMode(offset, size, in, out, ck, true)
+	if err := m.InitMode(offset, size, in, out, ck, true); err != nil {
+		t.Fatalf("Init mode failed with %v", err)
+	}
 	switch {
 	case m.In == nil:
 		t.Errorf("Init mode failed input not set")
@@ -57,10 +62,10 @@ func TestInitMode(t *testing.T) {
 
 // TestInitModeDecryptOffsetSeek tests the offset seek during initialization on the input during decryption.
 func TestInitModeDecryptOffsetSeek(t *testing.T) {
-	in := bytes.NewReadWriteSeeker(make([]byte, 100))
-	out := bytes.NewReadWriteSeeker(make([]byte, 100))
+	in := bytes.NewReadWriteSeeker(make([]byte, 96))
+	out := bytes.NewReadWriteSeeker(make([]byte, 96))
 	m := Mode{}
-	m.InitMode(10, 100, in, out, nil, true)
+	m.InitMode(10, 96, in, out, nil, true)
 	if in.Position() != 10 {
 		t.Errorf("Decrypt offset seek failed")
 	} else if out.Position() != 0 {
@@ -93,6 +98,44 @@ func TestInitModeReset(t *testing.T) {
 		t.Errorf("Init mode failed flushed not reset")
 	}
 }
+
+// TestInitModeShortInput tests that decrypting an input that is not a whole number of blocks fails.
+func TestInitModeShortInput(t *testing.T) {
+	test := func(size uint64) {
+		in := bytes.NewReadWriteSeeker(make([]byte, size))
+		out := bytes.NewReadWriteSeeker(make([]byte, 0))
+		m := Mode{}
+		if err := m.InitMode(0, size, in, out, nil, true); err != ErrShortInput {
+			t.Errorf("Init mode with %d byte input failed with %v, expected short input error", size, err)
+		}
+	}
+	test(0)
+	test(BlockSize - 1)
+	test(BlockSize*3 + 5)
+}
+
+// failSeeker is a stream that fails to seek.
+type failSeeker struct {
+	*bytes.ReadWriteSeeker
+}
+
+func (failSeeker) Seek(offset int64, whence int) (int64, error) {
+	return 0, errors.New("seek failed")
+}
+
+// TestInitModeSeekError tests that a failed offset seek is returned as an input output error.
+func TestInitModeSeekError(t *testing.T) {
+	in := failSeeker{bytes.NewReadWriteSeeker(make([]byte, 32))}
+	out := failSeeker{bytes.NewReadWriteSeeker(make([]byte, 0))}
+	m := Mode{}
+	if err := m.InitMode(0, 32, in, out, nil, true); !errors.Is(err, ErrIO) {
+		t.Errorf("Init mode failed seek on input failed with %v, expected input output error", err)
+	}
+	if err := m.InitMode(0, 32, in, out, nil, false); !errors.Is(err, ErrIO) {
+		t.Errorf("Init mode failed seek on output failed with %v, expected input output error", err)
+	}
+}
+
 func TestSetLogs(t *testing.T) {
 	m := Mode{}
 	m.SetErrorLog(log.New(os.Stdout, "test", 0))
@@ -103,3 +146,24 @@ func TestSetLogs(t *testing.T) {
 		t.Errorf("Setting logs failed")
 	}
 }
+
+// TestSetContext tests that a done context stops filling the input buffer, and that no context is never done.
+func TestSetContext(t *testing.T) {
+	m := NewMode(nil)
+	if m.Done() != nil || m.CheckContext() != nil {
+		t.Errorf("Mode without a context should never be done")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	m.SetContext(ctx)
+	cancel()
+	if _, ok := <-m.Done(); ok {
+		t.Errorf("Canceling the context should close the done channel")
+	}
+	m.In = bytes.NewReadWriteSeeker(rand.GetRand(int(BlockSize)))
+	m.InBuffer = make([]state.State, 0, 1)
+	if err := m.FillInBuffer(); err != context.Canceled {
+		t.Errorf("Filling the input buffer with a canceled context failed with %v", err)
+	} else if len(m.InBuffer) != 0 {
+		t.Errorf("Filling the input buffer with a canceled context should not read anything")
+	}
+}
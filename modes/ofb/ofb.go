@@ -0,0 +1,64 @@
+package ofb
+
+import (
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/state"
+	"io"
+)
+
+// OFB keeps the state of an output feedback process, used for encryption or decryption.
+// The key stream is generated by repeatedly encrypting the initialization vector, independently
+// of the input, so encryption and decryption are the same operation.
+type OFB struct {
+	modes.Mode
+	last   state.State    // last key stream block, starts as the initialization vector
+	cipher *cipher.Cipher // block cipher instance
+}
+
+// NewOFB creates a new output feedback instance with the given CipherFactory instance.
+// Pads the input by default, can be length preserving without padding.
+func NewOFB(cf cipher.CipherFactory) *OFB {
+	o := &OFB{
+		Mode: *modes.NewMode(cf),
+	}
+	o.Partial = true
+	return o
+}
+
+// initOFB initializes the instance to run an encryption or decryption.
+func (o *OFB) initOFB(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte, isDecrypt bool) (err error) {
+	if err = o.InitMode(offset, size, in, out, ck, isDecrypt); err != nil {
+		return
+	}
+	o.last = *state.NewStateFromBytes(nonce)
+	if o.cipher, err = o.Cf(); err != nil {
+		return
+	}
+	return o.cipher.Expand(ck)
+}
+
+// processBlock xors the ith block with the next key stream block.
+// Should be called iteratively on each block.
+func (o *OFB) processBlock(i uint64) {
+	o.last = o.cipher.Encrypt(o.last, o.Ck)
+	b := o.GetBlock(i)
+	b.Xor(o.last)
+	o.PutBlock(i, b)
+}
+
+// Encrypt encrypts the input using OFB mode.
+func (o *OFB) Encrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if err := o.initOFB(offset, size, in, out, ck, nonce, false); err != nil {
+		return err
+	}
+	return o.ProcessBlocks(o.processBlock)
+}
+
+// Decrypt decrypts the input using OFB mode.
+func (o *OFB) Decrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if err := o.initOFB(offset, size, in, out, ck, nonce, true); err != nil {
+		return err
+	}
+	return o.ProcessBlocks(o.processBlock)
+}
@@ -0,0 +1,85 @@
+package ofb
+
+import (
+	"bytes"
+	"encoding/hex"
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	mbytes "github.com/emil2k/go-aes/util/bytes"
+	"github.com/emil2k/go-aes/util/rand"
+	"testing"
+)
+
+// Example vectors from NIST SP 800-38A, appendix F.4, for AES-128.
+const (
+	vectorKey       = "2b7e151628aed2a6abf7158809cf4f3c"
+	vectorIV        = "000102030405060708090a0b0c0d0e0f"
+	vectorPlaintext = "6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e51" +
+		"30c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710"
+	vectorOFB = "3b3fd92eb72dad20333449f8e83cfb4a7789508d16918f03f53c52dac54ed825" +
+		"9740051e9c5fecf64344f7a82260edcc304c6528f659c77866a510d9c1d6ae5e"
+)
+
+func TestEncryptDecrypt(t *testing.T) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.StepEngine)
+	}
+	modes.EncryptDecryptTest(t, NewOFB(cf), ck, nonce)
+}
+
+// TestNoPadding tests encryption and decryption of a partial last block without padding.
+func TestNoPadding(t *testing.T) {
+	ck := rand.GetRand(16) // random 128 bit cipher key
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	o := NewOFB(cf)
+	o.SetPadding(modes.NoPadding)
+	modes.EncryptDecryptTest(t, o, ck, nonce)
+}
+
+// TestVector encrypts the plaintext of the vector and checks that the cipher text, without the
+// padding appended by the mode, matches. Then decrypts the cipher text back to the plaintext.
+func TestVector(t *testing.T) {
+	ck, _ := hex.DecodeString(vectorKey)
+	iv, _ := hex.DecodeString(vectorIV)
+	data, _ := hex.DecodeString(vectorPlaintext)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	mode := NewOFB(cf)
+	out := mbytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := mode.Encrypt(0, uint64(len(data)), bytes.NewReader(data), out, ck, iv); err != nil {
+		t.Fatalf("Encryption failed with %v", err)
+	}
+	ct := out.Bytes()
+	if x := hex.EncodeToString(ct[:len(data)]); x != vectorOFB {
+		t.Errorf("Encryption failed with %s, expected %s", x, vectorOFB)
+	}
+	dOut := mbytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := mode.Decrypt(0, uint64(len(ct)), bytes.NewReader(ct), dOut, ck, iv); err != nil {
+		t.Fatalf("Decryption failed with %v", err)
+	}
+	if x := dOut.Bytes(); !bytes.Equal(x, data) {
+		t.Errorf("Decryption failed with %s", hex.EncodeToString(x))
+	}
+}
+
+// TestErrors tests that invalid cipher keys and inputs are returned as errors.
+func TestErrors(t *testing.T) {
+	nonce := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.StepEngine)
+	}
+	in := mbytes.NewReadWriteSeeker(rand.GetRand(20))
+	out := mbytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := NewOFB(cf).Encrypt(0, 20, in, out, rand.GetRand(24), nonce); err != cipher.ErrKeySize {
+		t.Errorf("Encrypt with mismatched cipher key size failed with %v", err)
+	}
+	if err := NewOFB(cf).Decrypt(0, 20, in, out, rand.GetRand(16), nonce); err != modes.ErrShortInput {
+		t.Errorf("Decrypt of partial block failed with %v", err)
+	}
+}
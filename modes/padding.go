@@ -0,0 +1,131 @@
+package modes
+
+import (
+	"crypto/subtle"
+)
+
+// Padding pads the last block of the input when encrypting and removes the padding when decrypting.
+type Padding interface {
+	Pad(b []byte) []byte            // pads the last partial block, shorter than a block, returns it unchanged if no padding is added
+	Unpad(b []byte) ([]byte, error) // removes the padding of the last block, returns ErrBadPadding if invalid
+	Size(n uint64) uint64           // returns the size in bytes of n bytes of input once padded
+}
+
+// Padding schemes, PKCS7Padding is the default.
+var (
+	PKCS7Padding    Padding = pkcs7Padding{}    // bytes holding the number of padding bytes, always adds padding
+	ANSIX923Padding Padding = ansiX923Padding{} // zero bytes then the number of padding bytes, always adds padding
+	ISO7816Padding  Padding = iso7816Padding{}  // a 0x80 byte then zero bytes, as ISO/IEC 7816-4, always adds padding
+	ZeroPadding     Padding = zeroPadding{}     // zero bytes only when needed, trailing zeros of the plaintext are lost
+	NoPadding       Padding = noPadding{}       // length preserving, only for modes allowing a partial last block unless a whole number of blocks
+)
+
+// paddedSize returns the size of n bytes padded with at least a byte, to a whole number of blocks.
+func paddedSize(n uint64) uint64 {
+	return (n/BlockSize + 1) * BlockSize
+}
+
+// pkcs7Padding pads with bytes holding the number of padding bytes, as PKCS#7.
+type pkcs7Padding struct{}
+
+func (pkcs7Padding) Pad(b []byte) []byte            { return padBlock(b) }
+func (pkcs7Padding) Unpad(b []byte) ([]byte, error) { return unpadBlock(b) }
+func (pkcs7Padding) Size(n uint64) uint64           { return paddedSize(n) }
+
+// ansiX923Padding pads with zero bytes followed by a byte holding the number of padding bytes.
+type ansiX923Padding struct{}
+
+func (ansiX923Padding) Pad(b []byte) []byte {
+	pad := BlockSize - uint64(len(b))
+	b = append(b, make([]byte, pad-1)...)
+	return append(b, byte(pad))
+}
+
+// Unpad checks every byte of the block whatever the padding, as unpadBlock.
+func (ansiX923Padding) Unpad(b []byte) ([]byte, error) {
+	n := len(b)
+	if n == 0 {
+		return nil, ErrBadPadding
+	}
+	pad := int(b[n-1])
+	good := subtle.ConstantTimeLessOrEq(1, pad) & subtle.ConstantTimeLessOrEq(pad, n)
+	for i := 0; i < n-1; i++ {
+		inPad := subtle.ConstantTimeLessOrEq(n-i, pad) // within the last pad bytes
+		good &= subtle.ConstantTimeByteEq(b[i], 0) | (inPad ^ 1)
+	}
+	if good != 1 {
+		return nil, ErrBadPadding
+	}
+	return b[:n-pad], nil
+}
+
+func (ansiX923Padding) Size(n uint64) uint64 { return paddedSize(n) }
+
+// iso7816Padding pads with a 0x80 byte followed by zero bytes, as ISO/IEC 7816-4.
+type iso7816Padding struct{}
+
+func (iso7816Padding) Pad(b []byte) []byte {
+	b = append(b, 0x80)
+	return append(b, make([]byte, BlockSize-uint64(len(b)))...)
+}
+
+// Unpad finds the last non zero byte, which must be 0x80, checking every byte of the block.
+func (iso7816Padding) Unpad(b []byte) ([]byte, error) {
+	var found, good, pos int
+	for i := len(b) - 1; i >= 0; i-- {
+		first := (found ^ 1) & (subtle.ConstantTimeByteEq(b[i], 0) ^ 1) // last non zero byte
+		good |= first & subtle.ConstantTimeByteEq(b[i], 0x80)
+		pos = subtle.ConstantTimeSelect(first, i, pos)
+		found |= first
+	}
+	if good != 1 {
+		return nil, ErrBadPadding
+	}
+	return b[:pos], nil
+}
+
+func (iso7816Padding) Size(n uint64) uint64 { return paddedSize(n) }
+
+// zeroPadding pads a partial last block with zero bytes, adding nothing to a whole number of blocks.
+type zeroPadding struct{}
+
+func (zeroPadding) Pad(b []byte) []byte {
+	if len(b) == 0 {
+		return b
+	}
+	return append(b, make([]byte, BlockSize-uint64(len(b)))...)
+}
+
+// Unpad removes all trailing zero bytes, including any that were part of the plaintext.
+func (zeroPadding) Unpad(b []byte) ([]byte, error) {
+	n := len(b)
+	for n > 0 && b[n-1] == 0 {
+		n--
+	}
+	return b[:n], nil
+}
+
+func (zeroPadding) Size(n uint64) uint64 {
+	return (n + BlockSize - 1) / BlockSize * BlockSize
+}
+
+// noPadding adds no padding, a partial last block is processed as a partial block.
+type noPadding struct{}
+
+func (noPadding) Pad(b []byte) []byte            { return b }
+func (noPadding) Unpad(b []byte) ([]byte, error) { return b, nil }
+func (noPadding) Size(n uint64) uint64           { return n }
+
+// SetPadding sets the padding scheme, PKCS7Padding if never set or nil. Length preserving modes
+// set NoPadding when constructed, so they are never padded.
+func (m *Mode) SetPadding(p Padding) {
+	m.pad = p
+}
+
+// Padding returns the padding scheme.
+func (m *Mode) Padding() Padding {
+	if m.pad == nil {
+		return PKCS7Padding
+	}
+	return m.pad
+}
@@ -0,0 +1,30 @@
+package modes
+
+// Progress describes how far an encryption or decryption has gotten.
+type Progress struct {
+	Blocks  uint64 // number of blocks output so far
+	Total   uint64 // number of blocks to output
+	Buffers uint64 // number of output buffers flushed so far, or sectors for modes without buffers
+}
+
+// Bytes returns the number of bytes output so far, in whole blocks.
+func (p Progress) Bytes() uint64 {
+	return p.Blocks * BlockSize
+}
+
+// ProgressFunc is called with the progress of a process after each output buffer is flushed.
+type ProgressFunc func(p Progress)
+
+// SetProgress sets the function called with the progress after each output buffer is flushed,
+// nil to stop reporting progress.
+func (m *Mode) SetProgress(f ProgressFunc) {
+	m.progress = f
+}
+
+// ReportProgress calls the progress function if one is set, for modes that output without flushing
+// the output buffer.
+func (m *Mode) ReportProgress(p Progress) {
+	if m.progress != nil {
+		m.progress(p)
+	}
+}
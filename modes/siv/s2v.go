@@ -0,0 +1,98 @@
+package siv
+
+import (
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/mac"
+)
+
+// s2v keeps the state of the S2V construction, RFC 5297 section 2.4, which turns a vector of strings
+// into a synthetic initialization vector with CMAC. Each string but the last is added with add, the
+// last string may be written in pieces once its size is known.
+type s2v struct {
+	cmac  *mac.CMAC // CMAC keyed by the first half of the cipher key
+	d     []byte    // running value, doubled then xored with the CMAC of each string
+	size  uint64    // size of the last string in bytes
+	n     uint64    // bytes of the last string written
+	short []byte    // last string when shorter than a block, padded once complete
+}
+
+// newS2V starts a S2V construction keyed by the key, the running value starts as the CMAC of a
+// zero block.
+func newS2V(cf cipher.CipherFactory, key []byte) (*s2v, error) {
+	m, err := mac.NewCMAC(cf, key)
+	if err != nil {
+		return nil, err
+	}
+	m.Write(make([]byte, mac.BlockSize))
+	return &s2v{cmac: m, d: m.Sum(nil)}, nil
+}
+
+// add adds a string that is not the last, doubling the running value and xoring in the CMAC of the string.
+func (h *s2v) add(b []byte) {
+	h.cmac.Reset()
+	h.cmac.Write(b)
+	h.d = xorBytes(dbl(h.d), h.cmac.Sum(nil))
+}
+
+// start starts the last string, of size bytes.
+func (h *s2v) start(size uint64) {
+	h.cmac.Reset()
+	h.size, h.n, h.short = size, 0, nil
+}
+
+// write writes the next piece of the last string. When the last string is at least a block long its
+// last block is xored with the running value, otherwise it is held back until the sum.
+func (h *s2v) write(p []byte) {
+	bs := uint64(mac.BlockSize)
+	if h.size < bs {
+		h.short = append(h.short, p...)
+		return
+	}
+	end := h.n + uint64(len(p))
+	if tail := h.size - bs; end > tail { // the piece overlaps the last block
+		p = append([]byte{}, p...)
+		for i := range p {
+			if pos := h.n + uint64(i); pos >= tail {
+				p[i] ^= h.d[pos-tail]
+			}
+		}
+	}
+	h.n = end
+	h.cmac.Write(p)
+}
+
+// sum returns the synthetic initialization vector, the CMAC of the last string. A last string
+// shorter than a block is padded with a one bit followed by zeros, then xored with the doubled
+// running value.
+func (h *s2v) sum() []byte {
+	if h.size < uint64(mac.BlockSize) {
+		t := make([]byte, mac.BlockSize)
+		copy(t, h.short)
+		t[len(h.short)] = 0x80
+		h.cmac.Write(xorBytes(dbl(h.d), t))
+	}
+	return h.cmac.Sum(nil)
+}
+
+// dbl doubles a block in GF(2^128), shifting it one bit to the left as a big endian integer and
+// xoring the constant 0x87 into the last byte if the most significant bit was set.
+func dbl(in []byte) []byte {
+	out := make([]byte, len(in))
+	for i := range in {
+		out[i] = in[i] << 1
+		if i+1 < len(in) {
+			out[i] |= in[i+1] >> 7
+		}
+	}
+	out[len(out)-1] ^= 0x87 & -(in[0] >> 7)
+	return out
+}
+
+// xorBytes returns the xor of two blocks of the same length.
+func xorBytes(a, b []byte) []byte {
+	out := make([]byte, len(a))
+	for i := range a {
+		out[i] = a[i] ^ b[i]
+	}
+	return out
+}
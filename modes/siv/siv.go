@@ -0,0 +1,234 @@
+package siv
+
+import (
+	"crypto/subtle"
+	"io"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/state"
+)
+
+const SIVSize uint64 = 16 // size of the synthetic initialization vector in bytes, which is also the tag
+const NonceSize int = 16  // size of the nonces generated by the command in bytes, any size is allowed
+
+// SIV keeps the state of a synthetic initialization vector process, AES-SIV as specified by
+// RFC 5297, used for authenticated encryption or decryption resistant to nonce reuse. The S2V
+// construction derives the synthetic initialization vector from the additional data, the nonce,
+// and the plaintext with CMAC, then the plaintext is encrypted in counter mode starting from it.
+// Encrypting the same input with a repeated nonce only reveals that the inputs are equal.
+// The cipher key is twice the size of the block cipher key, the first half keys the CMAC and the
+// second half keys the counter mode, so AES-SIV takes 256, 384, or 512 bit cipher keys.
+// The cipher text is the synthetic initialization vector followed by the encrypted plaintext of
+// the same length.
+type SIV struct {
+	modes.Mode
+	cipher *cipher.Cipher // block cipher instance for the counter mode, keyed by the second half of the cipher key
+	macKey []byte         // first half of the cipher key
+	ctrKey []byte         // second half of the cipher key
+	q      []byte         // first counter block, the synthetic initialization vector with two bits cleared
+	aad    []byte         // additional authenticated data
+}
+
+// NewSIV constructs a new synthetic initialization vector instance with logs that discard output.
+// The CipherFactory must create block ciphers for half the size of the cipher key.
+func NewSIV(cf cipher.CipherFactory) *SIV {
+	s := &SIV{
+		Mode: *modes.NewMode(cf),
+	}
+	s.Partial = true
+	s.SetPadding(modes.NoPadding)
+	return s
+}
+
+// SetAdditionalData sets the additional data authenticated, but not encrypted, by Encrypt and Decrypt.
+func (s *SIV) SetAdditionalData(aad []byte) {
+	s.aad = aad
+}
+
+// initKeys splits the cipher key into the keys of the CMAC and the counter mode, then creates the
+// block cipher for the counter mode. Returns cipher.ErrKeySize if the cipher key is not 256, 384,
+// or 512 bits, or its halves do not match the cipher key size of the cipher factory.
+func (s *SIV) initKeys(ck []byte) (err error) {
+	if len(ck) != 32 && len(ck) != 48 && len(ck) != 64 {
+		return cipher.ErrKeySize
+	}
+	s.macKey, s.ctrKey = ck[:len(ck)/2], ck[len(ck)/2:]
+	if s.cipher, err = s.Cf(); err != nil {
+		return
+	}
+	return s.cipher.Expand(s.ctrKey)
+}
+
+// initS2V starts the S2V construction with the additional data and the nonce, a nil nonce is
+// omitted for deterministic encryption, leaving the plaintext of size bytes to be written.
+func (s *SIV) initS2V(aad [][]byte, nonce []byte, size uint64) (*s2v, error) {
+	h, err := newS2V(s.Cf, s.macKey)
+	if err != nil {
+		return nil, err
+	}
+	for _, ad := range aad {
+		h.add(ad)
+	}
+	if nonce != nil {
+		h.add(nonce)
+	}
+	h.start(size)
+	return h, nil
+}
+
+// components returns the additional data set on the instance as the strings passed to S2V.
+func (s *SIV) components() [][]byte {
+	if s.aad == nil {
+		return nil
+	}
+	return [][]byte{s.aad}
+}
+
+// setCounter sets the first counter block from the synthetic initialization vector, clearing the
+// 31st and 63rd bits from the right so implementations can increment 32 or 64 bit integers.
+func (s *SIV) setCounter(v []byte) {
+	s.q = append([]byte{}, v...)
+	s.q[8] &= 0x7f
+	s.q[12] &= 0x7f
+}
+
+// keyStream returns the ith block of the key stream, the encryption of the ith counter block.
+func (s *SIV) keyStream(i uint64) state.State {
+	return s.cipher.Encrypt(getCounterBlock(s.q, i), s.ctrKey)
+}
+
+// Seal encrypts and authenticates the plaintext, also authenticating each string of additional
+// data. A nil nonce gives deterministic encryption. Returns the synthetic initialization vector
+// followed by the cipher text, which has the same length as the plaintext.
+func (s *SIV) Seal(ck []byte, nonce []byte, plaintext []byte, aad ...[]byte) ([]byte, error) {
+	if err := s.initKeys(ck); err != nil {
+		return nil, err
+	}
+	h, err := s.initS2V(aad, nonce, uint64(len(plaintext)))
+	if err != nil {
+		return nil, err
+	}
+	h.write(plaintext)
+	v := h.sum()
+	s.setCounter(v)
+	out := make([]byte, len(plaintext))
+	modes.XorKeyStream(out, plaintext, 0, s.keyStream)
+	return append(v, out...), nil
+}
+
+// Open decrypts the cipher text following the synthetic initialization vector then verifies it.
+// Returns modes.ErrAuthentication without any plaintext if the synthetic initialization vector does not
+// verify.
+func (s *SIV) Open(ck []byte, nonce []byte, sealed []byte, aad ...[]byte) ([]byte, error) {
+	if uint64(len(sealed)) < SIVSize {
+		return nil, modes.ErrShortTag
+	}
+	if err := s.initKeys(ck); err != nil {
+		return nil, err
+	}
+	v, ct := sealed[:SIVSize], sealed[SIVSize:]
+	s.setCounter(v)
+	out := make([]byte, len(ct))
+	modes.XorKeyStream(out, ct, 0, s.keyStream)
+	h, err := s.initS2V(aad, nonce, uint64(len(out)))
+	if err != nil {
+		return nil, err
+	}
+	h.write(out)
+	if subtle.ConstantTimeCompare(h.sum(), v) != 1 {
+		return nil, modes.ErrAuthentication
+	}
+	return out, nil
+}
+
+// processBlock encrypts or decrypts the ith block, xoring it with the key stream.
+func (s *SIV) processBlock(i uint64) {
+	b := s.GetBlock(i)
+	b.Xor(s.keyStream(i))
+	s.PutBlock(i, b)
+}
+
+// hash reads through the size bytes of plaintext, or cipher text decrypting it, writing the
+// plaintext to the S2V construction. Nothing is written to the output. Seeks the input back to
+// where it started when done.
+func (s *SIV) hash(h *s2v, size uint64) error {
+	return s.ReadChunks(size, nil, func(i uint64, chunk []byte) {
+		if s.IsDecrypt {
+			modes.XorKeyStream(chunk, chunk, i, s.keyStream)
+		}
+		h.write(chunk)
+	})
+}
+
+// Encrypt encrypts the input using SIV mode, the synthetic initialization vector is written to the
+// output before the cipher text. As it authenticates the plaintext the input is read twice,
+// seeking back to where it started. A nil nonce gives deterministic encryption.
+func (s *SIV) Encrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if err := s.InitMode(offset, size, in, out, ck, false); err != nil {
+		return err
+	}
+	if err := s.initKeys(ck); err != nil {
+		return err
+	}
+	h, err := s.initS2V(s.components(), nonce, size)
+	if err != nil {
+		return err
+	}
+	if err := s.hash(h, size); err != nil {
+		return err
+	}
+	v := h.sum()
+	s.setCounter(v)
+	if _, err := s.Out.Write(v); err != nil {
+		return &modes.IOError{Op: "write synthetic initialization vector", Err: err}
+	}
+	return s.ProcessBlocks(s.processBlock)
+}
+
+// Decrypt verifies the synthetic initialization vector at the start of the input, then decrypts the
+// input using SIV mode. The size includes the synthetic initialization vector. As it authenticates
+// the plaintext the input is decrypted twice, nothing is written to the output if it does not
+// verify, returns modes.ErrAuthentication instead.
+func (s *SIV) Decrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if size < SIVSize {
+		return modes.ErrShortTag
+	}
+	if err := s.InitMode(offset+SIVSize, size-SIVSize, in, out, ck, true); err != nil {
+		return err
+	}
+	if err := s.initKeys(ck); err != nil {
+		return err
+	}
+	if _, err := s.In.Seek(int64(offset), 0); err != nil {
+		return &modes.IOError{Op: "seek input", Err: err}
+	}
+	v := make([]byte, SIVSize)
+	if _, err := io.ReadFull(s.In, v); err != nil {
+		return &modes.IOError{Op: "read synthetic initialization vector", Err: err}
+	}
+	s.setCounter(v)
+	h, err := s.initS2V(s.components(), nonce, size-SIVSize)
+	if err != nil {
+		return err
+	}
+	if err := s.hash(h, size-SIVSize); err != nil {
+		return err
+	}
+	if subtle.ConstantTimeCompare(h.sum(), v) != 1 {
+		return modes.ErrAuthentication
+	}
+	return s.ProcessBlocks(s.processBlock)
+}
+
+// getCounterBlock gets the ith counter block, adding i to the first counter block as a big endian
+// integer modulo 2^128.
+func getCounterBlock(q []byte, i uint64) state.State {
+	cb := append([]byte{}, q...)
+	for k := len(cb) - 1; k >= 0 && i > 0; k-- {
+		i += uint64(cb[k])
+		cb[k] = byte(i)
+		i >>= 8
+	}
+	return *state.NewStateFromBytes(cb)
+}
@@ -0,0 +1,15 @@
+package siv
+
+import (
+	"testing"
+
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+func BenchmarkEncrypt(b *testing.B) {
+	ck := rand.GetRand(32) // random 256 bit cipher key, AES-SIV-128
+	nonce := rand.GetRand(NonceSize)
+	s := newTestSIV(len(ck))
+	modes.EncryptBenchmark(b, s, ck, nonce)
+}
@@ -0,0 +1,208 @@
+package siv
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+// sivTest is a test case from RFC 5297 appendix A.
+type sivTest struct {
+	ck, nonce, pt, sealed string   // hex encoded, the nonce is omitted if empty
+	aad                   []string // hex encoded strings of additional data
+}
+
+var sivTests = []sivTest{
+	{ // A.1 deterministic authenticated encryption
+		ck:     "fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+		aad:    []string{"101112131415161718191a1b1c1d1e1f2021222324252627"},
+		pt:     "112233445566778899aabbccddee",
+		sealed: "85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c",
+	},
+	{ // A.2 nonce-based authenticated encryption
+		ck: "7f7e7d7c7b7a79787776757473727170404142434445464748494a4b4c4d4e4f",
+		aad: []string{
+			"00112233445566778899aabbccddeeffdeaddadadeaddadaffeeddccbbaa99887766554433221100",
+			"102030405060708090a0",
+		},
+		nonce:  "09f911029d74e35bd84156c5635688c0",
+		pt:     "7468697320697320736f6d6520706c61696e7465787420746f20656e6372797074207573696e67205349562d414553",
+		sealed: "7bdb6e3b432667eb06f4d14bff2fbd0fcb900f2fddbe404326601965c889bf17dba77ceb094fa663b7a3f748ba8af829ea64ad544a272e9c485b62a3fd5c0d",
+	},
+}
+
+// decodeHex decodes a hex string, panics if invalid.
+func decodeHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err.Error())
+	}
+	return b
+}
+
+// decode returns the decoded nonce, nil if omitted, and strings of additional data of the test case.
+func (tt sivTest) decode() (nonce []byte, aad [][]byte) {
+	if tt.nonce != "" {
+		nonce = decodeHex(tt.nonce)
+	}
+	for _, ad := range tt.aad {
+		aad = append(aad, decodeHex(ad))
+	}
+	return
+}
+
+// newTestSIV creates a SIV instance for the cipher key size in bytes, twice the block cipher key size.
+func newTestSIV(ckLen int) *SIV {
+	return NewSIV(func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CipherKeySize(ckLen*4), cipher.TableEngine)
+	})
+}
+
+func TestSeal(t *testing.T) {
+	for i, tt := range sivTests {
+		ck := decodeHex(tt.ck)
+		nonce, aad := tt.decode()
+		s := newTestSIV(len(ck))
+		if x, err := s.Seal(ck, nonce, decodeHex(tt.pt), aad...); err != nil || !bytes.Equal(x, decodeHex(tt.sealed)) {
+			t.Errorf("Seal failed for test %d with %s", i, hex.EncodeToString(x))
+		}
+	}
+}
+
+func TestOpen(t *testing.T) {
+	for i, tt := range sivTests {
+		ck := decodeHex(tt.ck)
+		nonce, aad := tt.decode()
+		s := newTestSIV(len(ck))
+		if x, err := s.Open(ck, nonce, decodeHex(tt.sealed), aad...); err != nil {
+			t.Errorf("Open failed for test %d with error : %s", i, err.Error())
+		} else if !bytes.Equal(x, decodeHex(tt.pt)) {
+			t.Errorf("Open failed for test %d with %s", i, hex.EncodeToString(x))
+		}
+	}
+}
+
+func TestOpenTampered(t *testing.T) {
+	tt := sivTests[1]
+	ck := decodeHex(tt.ck)
+	nonce, aad := tt.decode()
+	s := newTestSIV(len(ck))
+	sealed := decodeHex(tt.sealed)
+	sealed[20] ^= 0x01
+	if x, err := s.Open(ck, nonce, sealed, aad...); err != modes.ErrAuthentication {
+		t.Errorf("Open tampered cipher text should fail authentication")
+	} else if x != nil {
+		t.Errorf("Open tampered cipher text should not return plaintext")
+	}
+	if _, err := s.Open(ck, nonce, decodeHex(tt.sealed), aad[0]); err != modes.ErrAuthentication {
+		t.Errorf("Open with missing additional data should fail authentication")
+	}
+	if _, err := s.Open(ck, nil, decodeHex(tt.sealed), aad...); err != modes.ErrAuthentication {
+		t.Errorf("Open with missing nonce should fail authentication")
+	}
+	if _, err := s.Open(ck, nonce, sealed[:SIVSize-1], aad...); err != modes.ErrShortTag {
+		t.Errorf("Open input shorter than synthetic initialization vector should fail")
+	}
+}
+
+// TestNonceReuse tests that sealing with a repeated nonce only reveals whether the plaintexts are equal.
+func TestNonceReuse(t *testing.T) {
+	ck := rand.GetRand(32)
+	nonce := rand.GetRand(NonceSize)
+	pt := rand.GetRand(40)
+	s := newTestSIV(len(ck))
+	a, _ := s.Seal(ck, nonce, pt)
+	b, _ := s.Seal(ck, nonce, pt)
+	if !bytes.Equal(a, b) {
+		t.Errorf("Sealing equal plaintexts with the same nonce should match")
+	}
+	other := append([]byte{}, pt...)
+	other[len(other)-1] ^= 0x01
+	c, _ := s.Seal(ck, nonce, other)
+	if bytes.Equal(a[:SIVSize], c[:SIVSize]) || bytes.Equal(a[SIVSize:len(a)-1], c[SIVSize:len(c)-1]) {
+		t.Errorf("Sealing plaintexts differing in the last byte with the same nonce should differ throughout")
+	}
+}
+
+func TestKeySize(t *testing.T) {
+	s := newTestSIV(32)
+	if _, err := s.Seal(rand.GetRand(16), nil, nil); err != cipher.ErrKeySize {
+		t.Errorf("Seal with a 128 bit cipher key should fail with key size error, got %v", err)
+	}
+}
+
+// TestS2VPieces tests that writing the last string in pieces, across its last block, matches
+// writing it at once.
+func TestS2VPieces(t *testing.T) {
+	ck := rand.GetRand(16)
+	cf := func() (*cipher.Cipher, error) { return cipher.NewCipher(cipher.CK128, cipher.TableEngine) }
+	for _, size := range []int{0, 5, 16, 17, 40} {
+		data, ad := rand.GetRand(size), rand.GetRand(3)
+		whole, _ := newS2V(cf, ck)
+		whole.add(ad)
+		pieces, _ := newS2V(cf, ck)
+		pieces.add(ad)
+		whole.start(uint64(size))
+		whole.write(data)
+		pieces.start(uint64(size))
+		for i := range data {
+			pieces.write(data[i : i+1])
+		}
+		if x, y := whole.sum(), pieces.sum(); !bytes.Equal(x, y) {
+			t.Errorf("S2V of %d bytes in pieces failed with %s, expected %s", size, hex.EncodeToString(y), hex.EncodeToString(x))
+		}
+	}
+}
+
+func TestDbl(t *testing.T) {
+	test := func(in, out string) {
+		if x := dbl(decodeHex(in)); !bytes.Equal(x, decodeHex(out)) {
+			t.Errorf("Doubling %s failed with %s", in, hex.EncodeToString(x))
+		}
+	}
+	test("00000000000000000000000000000001", "00000000000000000000000000000002")
+	test("80000000000000000000000000000000", "00000000000000000000000000000087")
+}
+
+func TestGetCounterBlock(t *testing.T) {
+	q := decodeHex("000000000000000000000000fffffffe")
+	out := decodeHex("00000000000000000000000100000001")
+	cb := getCounterBlock(q, 3) // carries past the last 4 bytes
+	if x := cb.GetBytes(); !bytes.Equal(x, out) {
+		t.Errorf("Getting counter block failed with %s", hex.EncodeToString(x))
+	}
+}
+
+func TestEncryptDecrypt(t *testing.T) {
+	ck := rand.GetRand(32) // random 256 bit cipher key, AES-SIV-128
+	nonce := rand.GetRand(NonceSize)
+	s := newTestSIV(len(ck))
+	s.SetAdditionalData(rand.GetRand(20))
+	modes.EncryptDecryptTest(t, s, ck, nonce)
+}
+
+// TestContext tests stopping when the context is done, including while verifying the input.
+func TestContext(t *testing.T) {
+	ck := rand.GetRand(32)
+	modes.ContextTest(t, newTestSIV(len(ck)), ck, rand.GetRand(NonceSize))
+}
+
+// TestAuth tests that encrypting matches sealing, and that modified input fails to decrypt, for
+// each cipher key size, including deterministic encryption without a nonce.
+func TestAuth(t *testing.T) {
+	for _, ckLen := range []int{32, 48, 64} {
+		ck := rand.GetRand(ckLen)
+		s := newTestSIV(len(ck))
+		nonce := rand.GetRand(NonceSize)
+		if ckLen == 48 {
+			nonce = nil
+		}
+		modes.AuthTest(t, s, ck, nonce, SIVSize, func(plaintext []byte, aad []byte) ([]byte, error) {
+			return s.Seal(ck, nonce, plaintext, aad)
+		})
+	}
+}
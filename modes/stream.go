@@ -0,0 +1,198 @@
+package modes
+
+import (
+	"github.com/emil2k/go-aes/state"
+	"io"
+)
+
+const streamReadSize int = 32 * 1024 // number of bytes to read from the input of a stream reader at a time
+
+// StreamFunc processes the next blocks of a stream in place, blocks are passed in order so the
+// function can keep track of its position in the stream.
+type StreamFunc func(blocks []state.State)
+
+// StreamWriter runs a block cipher mode on everything written to it, writing the output to an
+// underlying writer, without needing to know the length of the input in advance.
+// Whole blocks are processed as they are written, the remainder is padded when closed.
+type StreamWriter struct {
+	Partial bool       // whether the last block can be partial without padding, as for modes xoring a key stream
+	w       io.Writer  // output stream
+	process StreamFunc // processes whole blocks
+	pad     Padding    // padding scheme, PKCS7Padding if nil
+	pending []byte     // partial block waiting for more input
+	closed  bool       // whether the stream was closed
+	err     error      // first error encountered, returned on all later calls
+}
+
+// NewStreamWriter creates a stream writer that processes blocks with the passed function.
+func NewStreamWriter(w io.Writer, process StreamFunc) *StreamWriter {
+	return &StreamWriter{w: w, process: process}
+}
+
+// SetPadding sets the padding scheme, PKCS7Padding if never set or nil. Must be set before writing.
+// Without padding a partial last block is only allowed for key stream modes.
+func (s *StreamWriter) SetPadding(p Padding) {
+	s.pad = p
+}
+
+// Write processes the whole blocks available, keeping any partial block until more is written.
+func (s *StreamWriter) Write(p []byte) (int, error) {
+	if s.closed {
+		return 0, ErrClosed
+	} else if s.err != nil {
+		return 0, s.err
+	}
+	s.pending = append(s.pending, p...)
+	whole := uint64(len(s.pending)) / BlockSize * BlockSize
+	if s.err = s.flush(s.pending[:whole]); s.err != nil {
+		return 0, s.err
+	}
+	s.pending = append(s.pending[:0], s.pending[whole:]...)
+	return len(p), nil
+}
+
+// Close pads and processes the last block, writing it to the output. Depending on the padding
+// scheme a whole block of padding is added when the input is a whole number of blocks.
+// Returns ErrShortInput if the last block is partial once padded, unless a key stream mode.
+// Does not close the underlying writer.
+func (s *StreamWriter) Close() error {
+	if s.closed {
+		return s.err
+	}
+	s.closed = true
+	if s.err == nil {
+		last := streamPadding(s.pad).Pad(s.pending)
+		if uint64(len(last))%BlockSize != 0 && !s.Partial {
+			s.err = ErrShortInput
+		} else {
+			s.err = s.flush(last)
+		}
+	}
+	return s.err
+}
+
+// flush processes the blocks in the data and writes the output, trimmed to the length of a partial
+// last block.
+func (s *StreamWriter) flush(data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	blocks := bytesToBlocks(data)
+	s.process(blocks)
+	if _, err := s.w.Write(blocksToBytes(blocks)[:len(data)]); err != nil {
+		return &IOError{"write output", err}
+	}
+	return nil
+}
+
+// StreamReader runs a block cipher mode on everything read from an underlying reader, without
+// needing to know the length of the input in advance. The last block is held back until the end
+// of the input is reached, then its padding is removed.
+type StreamReader struct {
+	Partial bool       // whether the last block can be partial without padding, as for modes xoring a key stream
+	r       io.Reader  // input stream
+	process StreamFunc // processes whole blocks
+	pad     Padding    // padding scheme, PKCS7Padding if nil
+	buf     []byte     // buffer for reading the input
+	pending []byte     // input read but not yet processed
+	out     []byte     // processed output waiting to be read
+	err     error      // error returned once the output is drained
+}
+
+// NewStreamReader creates a stream reader that processes blocks with the passed function.
+func NewStreamReader(r io.Reader, process StreamFunc) *StreamReader {
+	return &StreamReader{r: r, process: process, buf: make([]byte, streamReadSize)}
+}
+
+// SetPadding sets the padding scheme, PKCS7Padding if never set or nil. Must be set before reading.
+// Without padding the last block can be partial for key stream modes.
+func (s *StreamReader) SetPadding(p Padding) {
+	s.pad = p
+}
+
+// Read reads processed output, reading more input as needed.
+// Returns ErrShortInput if the input is not a whole number of blocks, unless a key stream mode
+// without padding, or shorter than the padding, ErrBadPadding if the last block has invalid padding, or an IOError if
+// reading the input fails.
+func (s *StreamReader) Read(p []byte) (int, error) {
+	for len(s.out) == 0 && s.err == nil {
+		s.fill()
+	}
+	if len(s.out) == 0 {
+		return 0, s.err
+	}
+	n := copy(p, s.out)
+	s.out = s.out[n:]
+	return n, nil
+}
+
+// fill reads from the input and processes whole blocks, always holding back at least the last
+// block until the end of the input, which is unpadded.
+func (s *StreamReader) fill() {
+	n, err := s.r.Read(s.buf)
+	s.pending = append(s.pending, s.buf[:n]...)
+	switch {
+	case err == io.EOF:
+		p := streamPadding(s.pad)
+		if n := uint64(len(s.pending)); n < p.Size(0) || (n%BlockSize != 0 && (p != NoPadding || !s.Partial)) {
+			s.err = ErrShortInput
+			return
+		}
+		out := s.flush(s.pending)
+		if uint64(len(out))%BlockSize == 0 && len(out) > 0 { // unpad the last whole block
+			last, err := p.Unpad(out[uint64(len(out))-BlockSize:])
+			if err != nil {
+				s.err = err
+				return
+			}
+			out = append(out[:uint64(len(out))-BlockSize], last...)
+		}
+		s.out = out
+		s.pending, s.err = nil, io.EOF
+	case err != nil:
+		s.err = &IOError{"read input", err}
+	case len(s.pending) > 0:
+		whole := (uint64(len(s.pending)) - 1) / BlockSize * BlockSize
+		s.out = s.flush(s.pending[:whole])
+		s.pending = append(s.pending[:0], s.pending[whole:]...)
+	}
+}
+
+// flush processes the blocks in the data and returns the output, trimmed to the length of a
+// partial last block.
+func (s *StreamReader) flush(data []byte) []byte {
+	if len(data) == 0 {
+		return nil
+	}
+	blocks := bytesToBlocks(data)
+	s.process(blocks)
+	return blocksToBytes(blocks)[:len(data)]
+}
+
+// streamPadding returns the padding scheme of a stream, PKCS7Padding if nil.
+func streamPadding(p Padding) Padding {
+	if p == nil {
+		return PKCS7Padding
+	}
+	return p
+}
+
+// bytesToBlocks splits data into states, a partial last block is filled with zeros.
+func bytesToBlocks(data []byte) []state.State {
+	blocks := make([]state.State, (uint64(len(data))+BlockSize-1)/BlockSize)
+	for i := range blocks {
+		b := make([]byte, BlockSize)
+		copy(b, data[uint64(i)*BlockSize:])
+		blocks[i] = *state.NewStateFromBytes(b)
+	}
+	return blocks
+}
+
+// blocksToBytes joins the bytes of the states.
+func blocksToBytes(blocks []state.State) []byte {
+	out := make([]byte, 0, uint64(len(blocks))*BlockSize)
+	for _, b := range blocks {
+		out = append(out, b.GetBytes()...)
+	}
+	return out
+}
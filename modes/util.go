@@ -2,12 +2,18 @@ package modes
 
 import (
 	"bytes"
+	"context"
 	"encoding/hex"
+	"github.com/emil2k/go-aes/cipher"
 	mbytes "github.com/emil2k/go-aes/util/bytes"
 	"github.com/emil2k/go-aes/util/rand"
 	"github.com/emil2k/go-aes/util/test_files"
+	"io"
+	"io/ioutil"
 	"os"
 	"testing"
+	"testing/iotest"
+	"time"
 )
 
 // EncryptDecryptTest generates and encrypt decrypt test using the passed mode instance.
@@ -19,12 +25,16 @@ func EncryptDecryptTest(t *testing.T, mode ModeInterface, ck []byte, nonce []byt
 	// Setup input for encryption
 	in := bytes.NewReader(data)
 	out := mbytes.NewReadWriteSeeker(make([]byte, 0))
-	mode.Encrypt(0, uint64(len(data)), in, out, ck, nonce)
+	if err := mode.Encrypt(0, uint64(len(data)), in, out, ck, nonce); err != nil {
+		t.Fatalf("Encryption failed with %v", err)
+	}
 	// Setup input for decryption
 	dData := out.Bytes()
 	dIn := bytes.NewReader(dData)
 	dOut := mbytes.NewReadWriteSeeker(make([]byte, 0))
-	mode.Decrypt(0, uint64(len(dData)), dIn, dOut, ck, nonce)
+	if err := mode.Decrypt(0, uint64(len(dData)), dIn, dOut, ck, nonce); err != nil {
+		t.Fatalf("Decryption failed with %v", err)
+	}
 	if x := dOut.Bytes(); !bytes.Equal(x, expected) {
 		t.Errorf("Encryption followed by decryption failed with %s", hex.EncodeToString(x))
 	}
@@ -52,9 +62,177 @@ func EncryptBenchmark(b *testing.B, mode ModeInterface, ck []byte, nonce []byte)
 			panic(err.Error())
 		}
 		b.StartTimer()
-		mode.Encrypt(0, size, in, out, ck, nonce)
+		if err := mode.Encrypt(0, size, in, out, ck, nonce); err != nil {
+			panic(err.Error())
+		}
 	}
 	for i := 0; i < b.N; i++ {
 		run()
 	}
 }
+
+// DecryptBenchmark generates and runs a benchmark for decryption using the passed mode instance.
+// The test file is encrypted once before the benchmark, then decrypted from memory.
+func DecryptBenchmark(b *testing.B, mode ModeInterface, ck []byte, nonce []byte) {
+	in, err := test_files.Open1MBTestFile()
+	if err != nil {
+		panic(err.Error())
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		panic(err.Error())
+	}
+	encrypted := mbytes.NewReadWriteSeeker(make([]byte, 0, fi.Size()+int64(BlockSize)))
+	if err := mode.Encrypt(0, uint64(fi.Size()), in, encrypted, ck, nonce); err != nil {
+		panic(err.Error())
+	}
+	data := encrypted.Bytes()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		out := mbytes.NewReadWriteSeeker(make([]byte, 0, len(data)))
+		b.StartTimer()
+		if err := mode.Decrypt(0, uint64(len(data)), mbytes.NewReadWriteSeeker(data), out, ck, nonce); err != nil {
+			panic(err.Error())
+		}
+	}
+}
+
+// cancelReader cancels a context on the first read, to stop a process midway.
+type cancelReader struct {
+	io.ReadSeeker
+	cancel context.CancelFunc
+}
+
+func (r *cancelReader) Read(p []byte) (int, error) {
+	r.cancel()
+	return r.ReadSeeker.Read(p)
+}
+
+// AuthTest generates a test of an authenticated mode, whose output is overhead bytes longer than its
+// input. Input spanning several buffer blocks with a partial last block must match sealing it with
+// the passed function, then decrypt following a header. Decrypting after modifying the cipher text
+// or the additional data must return ErrAuthentication without writing any output, and decrypting
+// input shorter than the overhead must return ErrShortTag.
+func AuthTest(t *testing.T, mode AuthModeInterface, ck []byte, nonce []byte, overhead uint64,
+	seal func(plaintext []byte, aad []byte) ([]byte, error)) {
+	data := rand.GetRand(int(BlockSize*NBufferBlocks)*2 + 5)
+	aad := rand.GetRand(20)
+	mode.SetAdditionalData(aad)
+	encrypted := mbytes.NewReadWriteSeeker(nil)
+	if err := mode.Encrypt(0, uint64(len(data)), bytes.NewReader(data), encrypted, ck, nonce); err != nil {
+		t.Fatalf("Encryption failed with %v", err)
+	}
+	ct := encrypted.Bytes()
+	if uint64(len(ct)) != uint64(len(data))+overhead {
+		t.Errorf("Encryption of %d bytes output %d bytes, expected %d", len(data), len(ct), uint64(len(data))+overhead)
+	}
+	if expected, err := seal(data, aad); err != nil || !bytes.Equal(ct, expected) {
+		t.Errorf("Encryption does not match sealing the same input, sealing failed with %v", err)
+	}
+	header := rand.GetRand(7) // the cipher text is decrypted at an offset
+	decrypt := func(in []byte, size uint64) ([]byte, error) {
+		out := mbytes.NewReadWriteSeeker(nil)
+		err := mode.Decrypt(uint64(len(header)), size, bytes.NewReader(append(header, in...)), out, ck, nonce)
+		return out.Bytes(), err
+	}
+	if x, err := decrypt(ct, uint64(len(ct))); err != nil {
+		t.Errorf("Decryption failed with %v", err)
+	} else if !bytes.Equal(x, data) {
+		t.Errorf("Decryption does not match the input")
+	}
+	tampered := append([]byte{}, ct...)
+	tampered[len(tampered)/2] ^= 0x80
+	if x, err := decrypt(tampered, uint64(len(tampered))); err != ErrAuthentication {
+		t.Errorf("Decrypting tampered input should return authentication error, got %v", err)
+	} else if len(x) != 0 {
+		t.Errorf("Decrypting tampered input should not write any plaintext")
+	}
+	mode.SetAdditionalData(rand.GetRand(20))
+	if _, err := decrypt(ct, uint64(len(ct))); err != ErrAuthentication {
+		t.Errorf("Decrypting with different additional data should return authentication error, got %v", err)
+	}
+	if _, err := decrypt(ct, overhead-1); err != ErrShortTag {
+		t.Errorf("Decrypting input shorter than the tag should return short tag error, got %v", err)
+	}
+}
+
+// ContextTest generates a test of stopping the passed mode instance with a context. The test checks
+// that a canceled context or passed deadline stops encryption and decryption, that canceling while
+// decrypting input of more than a buffer block or sector stops it midway, and that the context is
+// no longer checked afterwards.
+func ContextTest(t *testing.T, mode ModeInterface, ck []byte, nonce []byte) {
+	data := rand.GetRand(2048)
+	encrypted := mbytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := mode.Encrypt(0, uint64(len(data)), bytes.NewReader(data), encrypted, ck, nonce); err != nil {
+		t.Fatalf("Encrypt failed with %v", err)
+	}
+	ct := encrypted.Bytes()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := EncryptContext(ctx, mode, 0, uint64(len(data)), bytes.NewReader(data), mbytes.NewReadWriteSeeker(nil), ck, nonce); err != context.Canceled {
+		t.Errorf("Encrypt with canceled context failed with %v", err)
+	}
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	if err := DecryptContext(ctx, mode, 0, uint64(len(ct)), bytes.NewReader(ct), mbytes.NewReadWriteSeeker(nil), ck, nonce); err != context.DeadlineExceeded {
+		t.Errorf("Decrypt with passed deadline failed with %v", err)
+	}
+	ctx, cancel = context.WithCancel(context.Background())
+	in := &cancelReader{bytes.NewReader(ct), cancel}
+	if err := DecryptContext(ctx, mode, 0, uint64(len(ct)), in, mbytes.NewReadWriteSeeker(nil), ck, nonce); err != context.Canceled {
+		t.Errorf("Decrypt canceled midway failed with %v", err)
+	}
+	if err := mode.Decrypt(0, uint64(len(ct)), bytes.NewReader(ct), mbytes.NewReadWriteSeeker(nil), ck, nonce); err != nil {
+		t.Errorf("Decrypt after the context was canceled failed with %v", err)
+	}
+}
+
+// StreamTest generates a test of the streaming writer and reader of a mode. The test checks that
+// writing the input in pieces matches encrypting it with the passed mode instance, and that
+// reading one byte at a time decrypts it.
+func StreamTest(t *testing.T, mode ModeInterface, cf cipher.CipherFactory,
+	newWriter func(io.Writer, cipher.CipherFactory, []byte, []byte) (*StreamWriter, error),
+	newReader func(io.Reader, cipher.CipherFactory, []byte, []byte) (*StreamReader, error),
+	ck []byte, nonce []byte) {
+	data := rand.GetRand(int(BlockSize)*40 + 7)
+	expected := mbytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := mode.Encrypt(0, uint64(len(data)), bytes.NewReader(data), expected, ck, nonce); err != nil {
+		t.Fatalf("Encryption failed with %v", err)
+	}
+	// Write in uneven pieces
+	out := new(bytes.Buffer)
+	sw, err := newWriter(out, cf, ck, nonce)
+	if err != nil {
+		t.Fatalf("Creating stream writer failed with %v", err)
+	}
+	for i := 0; i < len(data); i += 37 {
+		end := i + 37
+		if end > len(data) {
+			end = len(data)
+		}
+		if _, err := sw.Write(data[i:end]); err != nil {
+			t.Fatalf("Stream write failed with %v", err)
+		}
+	}
+	if err := sw.Close(); err != nil {
+		t.Fatalf("Stream close failed with %v", err)
+	}
+	if x := out.Bytes(); !bytes.Equal(x, expected.Bytes()) {
+		t.Errorf("Stream encryption failed with %s, expected %s", hex.EncodeToString(x), hex.EncodeToString(expected.Bytes()))
+	}
+	// Read back one byte at a time
+	sr, err := newReader(iotest.OneByteReader(bytes.NewReader(out.Bytes())), cf, ck, nonce)
+	if err != nil {
+		t.Fatalf("Creating stream reader failed with %v", err)
+	}
+	if x, err := ioutil.ReadAll(sr); err != nil {
+		t.Errorf("Stream decryption failed with %v", err)
+	} else if !bytes.Equal(x, data) {
+		t.Errorf("Stream decryption failed with %s", hex.EncodeToString(x))
+	}
+	if _, err := newWriter(out, cf, ck[1:], nonce); err != cipher.ErrKeySize {
+		t.Errorf("Creating stream writer with invalid cipher key failed with %v", err)
+	}
+}
@@ -0,0 +1,253 @@
+package xts
+
+import (
+	"errors"
+	"io"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/state"
+)
+
+const DefaultSectorSize int = 512 // default size of a sector in bytes
+
+// ErrSectorSize is returned when the sector size is smaller than a block.
+var ErrSectorSize = errors.New("xts : sector size smaller than a block")
+
+// ErrShortSector is returned when the last sector of a whole input is shorter than a block.
+var ErrShortSector = errors.New("xts : last sector shorter than a block")
+
+// XTS keeps the state of an XEX-based tweaked-codebook mode with ciphertext stealing process,
+// as specified by IEEE 1619, used for encryption or decryption of sectors.
+// The cipher key is twice the size of the block cipher key, the first half keys the encryption of
+// the data and the second half keys the encryption of the tweak. Only 128 and 256 bit block cipher
+// keys are allowed, XTS-AES-128 and XTS-AES-256 respectively.
+// The cipher text has the same length as the plaintext, each sector is processed independently
+// so sectors can be encrypted or decrypted in any order.
+type XTS struct {
+	modes.Mode
+	SectorSize int            // size of a sector in bytes, when processing whole files
+	data       *cipher.Cipher // block cipher instance for the data, keyed by the first half of the cipher key
+	tweak      *cipher.Cipher // block cipher instance for the tweak, keyed by the second half of the cipher key
+	dataKey    []byte         // first half of the cipher key
+	tweakKey   []byte         // second half of the cipher key
+}
+
+// NewXTS creates a new XTS instance with the given CipherFactory instance, which must create
+// block ciphers for half the size of the cipher key.
+func NewXTS(cf cipher.CipherFactory) *XTS {
+	x := &XTS{
+		Mode:       *modes.NewMode(cf),
+		SectorSize: DefaultSectorSize,
+	}
+	x.SetPadding(modes.NoPadding)
+	return x
+}
+
+// initCiphers creates the block ciphers for the data and the tweak from the halves of the cipher key.
+// Returns cipher.ErrKeySize if the cipher key is not 256 or 512 bits, or its halves do not match
+// the cipher key size of the cipher factory.
+func (x *XTS) initCiphers(ck []byte) (err error) {
+	if len(ck) != 32 && len(ck) != 64 {
+		return cipher.ErrKeySize
+	}
+	x.dataKey, x.tweakKey = ck[:len(ck)/2], ck[len(ck)/2:]
+	if x.data, err = x.Cf(); err != nil {
+		return
+	}
+	if err = x.data.Expand(x.dataKey); err != nil {
+		return
+	}
+	if x.tweak, err = x.Cf(); err != nil {
+		return
+	}
+	return x.tweak.Expand(x.tweakKey)
+}
+
+// EncryptSector encrypts the plaintext of a sector, its sector number being the tweak.
+// The plaintext must be at least a block long, otherwise returns modes.ErrShortBlock.
+func (x *XTS) EncryptSector(ck []byte, sector uint64, plaintext []byte) ([]byte, error) {
+	if uint64(len(plaintext)) < modes.BlockSize {
+		return nil, modes.ErrShortBlock
+	}
+	if err := x.initCiphers(ck); err != nil {
+		return nil, err
+	}
+	return x.processSector(sector, plaintext, false), nil
+}
+
+// DecryptSector decrypts the cipher text of a sector, its sector number being the tweak.
+// The cipher text must be at least a block long, otherwise returns modes.ErrShortBlock.
+func (x *XTS) DecryptSector(ck []byte, sector uint64, ciphertext []byte) ([]byte, error) {
+	if uint64(len(ciphertext)) < modes.BlockSize {
+		return nil, modes.ErrShortBlock
+	}
+	if err := x.initCiphers(ck); err != nil {
+		return nil, err
+	}
+	return x.processSector(sector, ciphertext, true), nil
+}
+
+// processSector encrypts or decrypts a sector of at least a block, the ciphers must already be
+// initialized. A trailing partial block steals the end of the cipher text of the previous block,
+// which is then processed with the tweak of the partial block and output in its place.
+func (x *XTS) processSector(sector uint64, in []byte, isDecrypt bool) []byte {
+	bs := int(modes.BlockSize)
+	out := make([]byte, len(in))
+	t := x.getTweak(sector)
+	full, rem := len(in)/bs, len(in)%bs
+	if rem != 0 {
+		full-- // last full block is processed along with the partial block
+	}
+	for i := 0; i < full; i++ {
+		x.processBlock(out[i*bs:], in[i*bs:], t, isDecrypt)
+		mulAlpha(t)
+	}
+	if rem == 0 {
+		return out
+	}
+	next := append([]byte{}, t...)
+	mulAlpha(next)
+	if isDecrypt { // the last full block of cipher text was encrypted with the later tweak
+		t, next = next, t
+	}
+	last := full * bs
+	stolen := make([]byte, bs)
+	x.processBlock(stolen, in[last:], t, isDecrypt)
+	pp := make([]byte, bs)
+	copy(pp, in[last+bs:])
+	copy(pp[rem:], stolen[rem:])
+	copy(out[last+bs:], stolen[:rem])
+	x.processBlock(out[last:], pp, next, isDecrypt)
+	return out
+}
+
+// processBlock encrypts or decrypts the block at the start of src into dst, xoring the tweak
+// before and after the block cipher.
+func (x *XTS) processBlock(dst, src, t []byte, isDecrypt bool) {
+	b := make([]byte, modes.BlockSize)
+	for i := range b {
+		b[i] = src[i] ^ t[i]
+	}
+	var s state.State
+	if isDecrypt {
+		s = x.data.Decrypt(*state.NewStateFromBytes(b), x.dataKey)
+	} else {
+		s = x.data.Encrypt(*state.NewStateFromBytes(b), x.dataKey)
+	}
+	for i, v := range s.GetBytes() {
+		dst[i] = v ^ t[i]
+	}
+}
+
+// getTweak returns the tweak of the first block of a sector, the encryption of the sector number
+// as a 16 byte little endian integer.
+func (x *XTS) getTweak(sector uint64) []byte {
+	b := make([]byte, modes.BlockSize)
+	for i := 0; i < 8; i++ {
+		b[i] = byte(sector >> uint(i*8))
+	}
+	s := x.tweak.Encrypt(*state.NewStateFromBytes(b), x.tweakKey)
+	return s.GetBytes()
+}
+
+// mulAlpha multiplies the tweak by the primitive element alpha in GF(2^128), in place, the tweak
+// is a little endian integer reduced by x^128 + x^7 + x^2 + x + 1.
+func mulAlpha(t []byte) {
+	var carry byte
+	for i := range t {
+		next := t[i] >> 7
+		t[i] = t[i]<<1 | carry
+		carry = next
+	}
+	t[0] ^= 0x87 & -carry
+}
+
+// initXTS initializes the instance to run an encryption or decryption of a whole input.
+// Returns ErrShortSector if the input ends with a sector shorter than a block, before anything is
+// processed.
+func (x *XTS) initXTS(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, isDecrypt bool) error {
+	if x.SectorSize < int(modes.BlockSize) {
+		return ErrSectorSize
+	}
+	if size < modes.BlockSize {
+		return modes.ErrShortBlock
+	}
+	if last := size % uint64(x.SectorSize); last != 0 && last < modes.BlockSize {
+		return ErrShortSector
+	}
+	if err := x.initCiphers(ck); err != nil {
+		return err
+	}
+	x.In, x.Out, x.Ck, x.IsDecrypt = in, out, ck, isDecrypt
+	// Seek the offset in the input file if decrypting or the output file if encrypting.
+	if isDecrypt {
+		if _, seekErr := in.Seek(int64(offset), 0); seekErr != nil {
+			return &modes.IOError{Op: "seek input", Err: seekErr}
+		}
+	} else {
+		if _, seekErr := out.Seek(int64(offset), 0); seekErr != nil {
+			return &modes.IOError{Op: "seek output", Err: seekErr}
+		}
+	}
+	return nil
+}
+
+// processSectors reads, processes, and writes size bytes one sector at a time, numbering the
+// sectors consecutively from the first sector number. The last sector is short when the size is not
+// a whole number of sectors, so each sector matches processing it alone. Reports the progress after
+// each sector, returns the context error if the context is done before a sector.
+func (x *XTS) processSectors(size uint64, first uint64) error {
+	buf := make([]byte, x.SectorSize)
+	for sector, remain := first, size; remain > 0; sector++ {
+		if err := x.CheckContext(); err != nil {
+			return err
+		}
+		n := uint64(x.SectorSize)
+		if remain < n {
+			n = remain
+		}
+		if _, err := io.ReadFull(x.In, buf[:n]); err != nil {
+			return &modes.IOError{Op: "read input", Err: err}
+		}
+		if _, err := x.Out.Write(x.processSector(sector, buf[:n], x.IsDecrypt)); err != nil {
+			return &modes.IOError{Op: "write output", Err: err}
+		}
+		remain -= n
+		x.ReportProgress(modes.Progress{Blocks: (size - remain) / modes.BlockSize, Total: size / modes.BlockSize, Buffers: sector - first + 1})
+	}
+	x.DebugLog.Println("processed", size, "bytes from sector", first)
+	return nil
+}
+
+// getFirstSector returns the sector number of the first sector of a whole input, from the nonce as
+// a big endian integer of up to 8 bytes, any preceding bytes are ignored.
+func getFirstSector(nonce []byte) uint64 {
+	if len(nonce) > 8 {
+		nonce = nonce[len(nonce)-8:]
+	}
+	var s uint64
+	for _, b := range nonce {
+		s = s<<8 | uint64(b)
+	}
+	return s
+}
+
+// Encrypt encrypts the input using XTS mode, one sector at a time, the nonce is the sector number
+// of the first sector. The cipher text has the same length as the input, which must be at least a
+// block, as must the last sector when the input is not a whole number of sectors.
+func (x *XTS) Encrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if err := x.initXTS(offset, size, in, out, ck, false); err != nil {
+		return err
+	}
+	return x.processSectors(size, getFirstSector(nonce))
+}
+
+// Decrypt decrypts the input using XTS mode, one sector at a time, the nonce is the sector number
+// of the first sector.
+func (x *XTS) Decrypt(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error {
+	if err := x.initXTS(offset, size, in, out, ck, true); err != nil {
+		return err
+	}
+	return x.processSectors(size, getFirstSector(nonce))
+}
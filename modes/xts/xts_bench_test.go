@@ -0,0 +1,31 @@
+package xts
+
+import (
+	"testing"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+func BenchmarkEncrypt(b *testing.B) {
+	ck := rand.GetRand(32) // random XTS-AES-128 cipher key
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	modes.EncryptBenchmark(b, NewXTS(cf), ck, rand.GetRand(8))
+}
+
+func BenchmarkEncryptSector(b *testing.B) {
+	ck := rand.GetRand(32) // random XTS-AES-128 cipher key
+	cf := func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CK128, cipher.TableEngine)
+	}
+	x := NewXTS(cf)
+	sector := rand.GetRand(DefaultSectorSize)
+	b.SetBytes(int64(DefaultSectorSize))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		x.EncryptSector(ck, uint64(i), sector)
+	}
+}
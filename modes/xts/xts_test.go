@@ -0,0 +1,206 @@
+package xts
+
+import (
+	"bytes"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	mbytes "github.com/emil2k/go-aes/util/bytes"
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+// sequence returns n bytes counting up from zero, wrapping around, the plaintext of several vectors.
+func sequence(n int) string {
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = byte(i)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Test vectors from IEEE 1619-2007, appendix B, the sector number being the data unit sequence number.
+var vectors = []struct {
+	key1, key2 string
+	sector     uint64
+	plaintext  string
+	ciphertext string
+}{
+	{ // vector 1
+		strings.Repeat("00", 16), strings.Repeat("00", 16), 0,
+		strings.Repeat("00", 32),
+		"917cf69ebd68b2ec9b9fe9a3eadda692cd43d2f59598ed858c02c2652fbf922e",
+	},
+	{ // vector 2
+		strings.Repeat("11", 16), strings.Repeat("22", 16), 0x3333333333,
+		strings.Repeat("44", 32),
+		"c454185e6a16936e39334038acef838bfb186fff7480adc4289382ecd6d394f0",
+	},
+	{ // vector 3
+		"fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0", strings.Repeat("22", 16), 0x3333333333,
+		strings.Repeat("44", 32),
+		"af85336b597afc1a900b2eb21ec949d292df4c047e0b21532186a5971a227a89",
+	},
+	{ // vector 4
+		"27182818284590452353602874713526", "31415926535897932384626433832795", 0,
+		sequence(512),
+		"27a7479befa1d476489f308cd4cfa6e2a96e4bbe3208ff25287dd3819616e89c" +
+			"c78cf7f5e543445f8333d8fa7f56000005279fa5d8b5e4ad40e736ddb4d35412" +
+			"328063fd2aab53e5ea1e0a9f332500a5df9487d07a5c92cc512c8866c7e860ce" +
+			"93fdf166a24912b422976146ae20ce846bb7dc9ba94a767aaef20c0d61ad0265" +
+			"5ea92dc4c4e41a8952c651d33174be51a10c421110e6d81588ede82103a252d8" +
+			"a750e8768defffed9122810aaeb99f9172af82b604dc4b8e51bcb08235a6f434" +
+			"1332e4ca60482a4ba1a03b3e65008fc5da76b70bf1690db4eae29c5f1badd03c" +
+			"5ccf2a55d705ddcd86d449511ceb7ec30bf12b1fa35b913f9f747a8afd1b130e" +
+			"94bff94effd01a91735ca1726acd0b197c4e5b03393697e126826fb6bbde8ecc" +
+			"1e08298516e2c9ed03ff3c1b7860f6de76d4cecd94c8119855ef5297ca67e9f3" +
+			"e7ff72b1e99785ca0a7e7720c5b36dc6d72cac9574c8cbbc2f801e23e56fd344" +
+			"b07f22154beba0f08ce8891e643ed995c94d9a69c9f1b5f499027a78572aeebd" +
+			"74d20cc39881c213ee770b1010e4bea718846977ae119f7a023ab58cca0ad752" +
+			"afe656bb3c17256a9f6e9bf19fdd5a38fc82bbe872c5539edb609ef4f79c203e" +
+			"bb140f2e583cb2ad15b4aa5b655016a8449277dbd477ef2c8d6c017db738b18d" +
+			"eb4a427d1923ce3ff262735779a418f20a282df920147beabe421ee5319d0568",
+	},
+	{ // vector 10, XTS-AES-256
+		"2718281828459045235360287471352662497757247093699959574966967627",
+		"3141592653589793238462643383279502884197169399375105820974944592", 0xff,
+		sequence(512),
+		"1c3b3a102f770386e4836c99e370cf9bea00803f5e482357a4ae12d414a3e63b" +
+			"5d31e276f8fe4a8d66b317f9ac683f44680a86ac35adfc3345befecb4bb188fd" +
+			"5776926c49a3095eb108fd1098baec70aaa66999a72a82f27d848b21d4a741b0" +
+			"c5cd4d5fff9dac89aeba122961d03a757123e9870f8acf1000020887891429ca" +
+			"2a3e7a7d7df7b10355165c8b9a6d0a7de8b062c4500dc4cd120c0f7418dae3d0" +
+			"b5781c34803fa75421c790dfe1de1834f280d7667b327f6c8cd7557e12ac3a0f" +
+			"93ec05c52e0493ef31a12d3d9260f79a289d6a379bc70c50841473d1a8cc81ec" +
+			"583e9645e07b8d9670655ba5bbcfecc6dc3966380ad8fecb17b6ba02469a020a" +
+			"84e18e8f84252070c13e9f1f289be54fbc481457778f616015e1327a02b140f1" +
+			"505eb309326d68378f8374595c849d84f4c333ec4423885143cb47bd71c5edae" +
+			"9be69a2ffeceb1bec9de244fbe15992b11b77c040f12bd8f6a975a44a0f90c29" +
+			"a9abc3d4d893927284c58754cce294529f8614dcd2aba991925fedc4ae74ffac" +
+			"6e333b93eb4aff0479da9a410e4450e0dd7ae4c6e2910900575da401fc07059f" +
+			"645e8b7e9bfdef33943054ff84011493c27b3429eaedb4ed5376441a77ed4385" +
+			"1ad77f16f541dfd269d50d6a5f14fb0aab1cbb4c1550be97f7ab4066193c4caa" +
+			"773dad38014bd2092fa755c824bb5e54c4f36ffda9fcea70b9c6e693e148c151",
+	},
+	{ // vector 15, ciphertext stealing
+		"fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0", "bfbebdbcbbbab9b8b7b6b5b4b3b2b1b0", 0x123456789a,
+		sequence(17),
+		"6c1625db4671522d3d7599601de7ca09ed",
+	},
+}
+
+// newCipherFactory returns a cipher factory for block ciphers with half the size of the cipher key.
+func newCipherFactory(ck []byte, e cipher.Engine) cipher.CipherFactory {
+	return func() (*cipher.Cipher, error) {
+		return cipher.NewCipher(cipher.CipherKeySize(len(ck)*4), e)
+	}
+}
+
+func TestVectors(t *testing.T) {
+	for i, v := range vectors {
+		ck, _ := hex.DecodeString(v.key1 + v.key2)
+		pt, _ := hex.DecodeString(v.plaintext)
+		for _, e := range []cipher.Engine{cipher.StepEngine, cipher.TableEngine, cipher.BitslicedEngine} {
+			x := NewXTS(newCipherFactory(ck, e))
+			ct, err := x.EncryptSector(ck, v.sector, pt)
+			if err != nil {
+				t.Fatalf("Vector %d encryption failed with %v", i, err)
+			}
+			if h := hex.EncodeToString(ct); h != v.ciphertext {
+				t.Errorf("Vector %d encryption with engine %d failed with %s, expected %s", i, e, h, v.ciphertext)
+			}
+			dt, err := x.DecryptSector(ck, v.sector, ct)
+			if err != nil {
+				t.Fatalf("Vector %d decryption failed with %v", i, err)
+			}
+			if !bytes.Equal(dt, pt) {
+				t.Errorf("Vector %d decryption with engine %d failed with %s", i, e, hex.EncodeToString(dt))
+			}
+		}
+	}
+}
+
+// TestStealing tests that every partial block length is reversed by decryption.
+func TestStealing(t *testing.T) {
+	ck := rand.GetRand(32)
+	x := NewXTS(newCipherFactory(ck, cipher.TableEngine))
+	for n := int(modes.BlockSize); n <= 3*int(modes.BlockSize); n++ {
+		pt := rand.GetRand(n)
+		ct, err := x.EncryptSector(ck, uint64(n), pt)
+		if err != nil {
+			t.Fatalf("Encryption of %d bytes failed with %v", n, err)
+		}
+		if len(ct) != n {
+			t.Errorf("Encryption of %d bytes returned %d bytes", n, len(ct))
+		}
+		if dt, _ := x.DecryptSector(ck, uint64(n), ct); !bytes.Equal(dt, pt) {
+			t.Errorf("Decryption of %d bytes failed with %s", n, hex.EncodeToString(dt))
+		}
+	}
+}
+
+// TestSectors tests that encrypting a whole input matches encrypting each sector separately,
+// including a short last sector, and that a last sector shorter than a block is rejected.
+func TestSectors(t *testing.T) {
+	ck := rand.GetRand(64) // random XTS-AES-256 cipher key
+	x := NewXTS(newCipherFactory(ck, cipher.TableEngine))
+	x.SectorSize = 64
+	data := rand.GetRand(3*x.SectorSize + 20)
+	out := mbytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := x.Encrypt(0, uint64(len(data)), bytes.NewReader(data), out, ck, []byte{0x01, 0x00}); err != nil {
+		t.Fatalf("Encryption failed with %v", err)
+	}
+	var expected []byte
+	for _, s := range [][]byte{data[:64], data[64:128], data[128:192], data[192:]} {
+		ct, _ := x.EncryptSector(ck, 256+uint64(len(expected)/64), s)
+		expected = append(expected, ct...)
+	}
+	if b := out.Bytes(); !bytes.Equal(b, expected) {
+		t.Errorf("Encryption of sectors failed with %s", hex.EncodeToString(b))
+	}
+	dOut := mbytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := x.Decrypt(0, uint64(len(expected)), bytes.NewReader(expected), dOut, ck, []byte{0x01, 0x00}); err != nil {
+		t.Fatalf("Decryption failed with %v", err)
+	}
+	if b := dOut.Bytes(); !bytes.Equal(b, data) {
+		t.Errorf("Decryption of sectors failed with %s", hex.EncodeToString(b))
+	}
+	out = mbytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := x.Encrypt(0, uint64(len(data)-15), bytes.NewReader(data), out, ck, nil); err != ErrShortSector {
+		t.Errorf("Encryption with a last sector shorter than a block failed with %v", err)
+	} else if len(out.Bytes()) != 0 {
+		t.Errorf("Encryption with a last sector shorter than a block should not write any output")
+	}
+}
+
+// TestContext tests stopping between sectors when the context is done.
+func TestContext(t *testing.T) {
+	ck := rand.GetRand(32) // random XTS-AES-128 cipher key
+	modes.ContextTest(t, NewXTS(newCipherFactory(ck, cipher.TableEngine)), ck, rand.GetRand(8))
+}
+
+// TestErrors tests that invalid cipher keys, sector sizes and inputs are returned as errors.
+func TestErrors(t *testing.T) {
+	ck := rand.GetRand(32)
+	x := NewXTS(newCipherFactory(ck, cipher.TableEngine))
+	if _, err := x.EncryptSector(ck, 0, rand.GetRand(15)); err != modes.ErrShortBlock {
+		t.Errorf("Encryption of partial block failed with %v", err)
+	}
+	if _, err := x.EncryptSector(rand.GetRand(48), 0, rand.GetRand(16)); err != cipher.ErrKeySize {
+		t.Errorf("Encryption with XTS-AES-192 cipher key failed with %v", err)
+	}
+	if _, err := x.DecryptSector(rand.GetRand(64), 0, rand.GetRand(16)); err != cipher.ErrKeySize {
+		t.Errorf("Decryption with mismatched cipher key size failed with %v", err)
+	}
+	in := mbytes.NewReadWriteSeeker(rand.GetRand(15))
+	out := mbytes.NewReadWriteSeeker(make([]byte, 0))
+	if err := x.Decrypt(0, 15, in, out, ck, nil); err != modes.ErrShortBlock {
+		t.Errorf("Decryption of partial block failed with %v", err)
+	}
+	x.SectorSize = 8
+	if err := x.Encrypt(0, 15, in, out, ck, nil); err != ErrSectorSize {
+		t.Errorf("Encryption with small sector size failed with %v", err)
+	}
+}
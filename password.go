@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+
+	"github.com/emil2k/go-aes/kdf"
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+// usePassword returns whether the cipher key is derived from a password, instead of a key file.
+func usePassword() bool {
+	return args.password != "" || args.passfile != ""
+}
+
+// readPassword returns the password from the command arguments, or the first line of the password file.
+func readPassword() ([]byte, error) {
+	if args.password != "" && args.passfile != "" {
+		return nil, errors.New("specify either a password or a password file, not both")
+	} else if args.password != "" {
+		return []byte(args.password), nil
+	}
+	f, err := openFile(args.passfile)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFile(f)
+	password, err := readFromFile(f)
+	if err != nil {
+		return nil, err
+	}
+	if i := bytes.IndexAny(password, "\r\n"); i >= 0 {
+		password = password[:i]
+	}
+	if len(password) == 0 {
+		return nil, errors.New("password file is empty")
+	}
+	return password, nil
+}
+
+// keyLength returns the length in bytes of the cipher key for the header key size, twice as long
+// for XTS mode, which keys the encryption of the data and of the tweak separately, and for SIV mode,
+// which keys the CMAC and the counter mode separately. Followed by the key of the message
+// authentication code if the header is authenticated.
+func keyLength(h *header) int {
+	n := int(h.keySize / 8)
+	if h.mode == xtsMode || h.mode == sivMode {
+		n *= 2
+	}
+	return n + authKeyLength(h)
+}
+
+// newCipherKey generates a random cipher key of the header key size, or derives it from the
+// password with a random salt, recording the key derivation parameters in the header.
+func newCipherKey(h *header) ([]byte, error) {
+	if !usePassword() {
+		h.kdf = noKDF
+		return rand.GetRand(keyLength(h)), nil
+	}
+	h.kdf, h.iterations, h.salt = pbkdf2KDF, uint32(kdf.DefaultIterations), rand.GetRand(kdf.SaltSize)
+	return deriveCipherKey(h)
+}
+
+// deriveCipherKey derives the cipher key from the password, using the key derivation parameters
+// of the header.
+func deriveCipherKey(h *header) ([]byte, error) {
+	password, err := readPassword()
+	if err != nil {
+		return nil, err
+	}
+	verboseLog.Println("deriving cipher key with", h.iterations, "iterations")
+	return kdf.PBKDF2(password, h.salt, int(h.iterations), keyLength(h))
+}
+
+// readCipherKey returns the cipher key used to encrypt the input described by the header, either
+// read from the key file or derived from the password.
+func readCipherKey(h *header) ([]byte, error) {
+	switch {
+	case h.kdf == noKDF && usePassword():
+		return nil, errors.New("input was encrypted with a key file, not a password")
+	case h.kdf != noKDF && !usePassword():
+		return nil, errors.New("input was encrypted with a password, specify it with -password or -passfile")
+	case h.kdf != noKDF:
+		return deriveCipherKey(h)
+	}
+	return readKeyFile(h)
+}
+
+// readKeyFile reads the cipher key from the key file, checking that its size matches the header.
+func readKeyFile(h *header) ([]byte, error) {
+	kfile, err := openFile(args.key)
+	if err != nil {
+		return nil, err
+	}
+	defer closeFile(kfile)
+	if info, err := kfile.Stat(); err != nil {
+		return nil, err
+	} else if !info.Mode().IsRegular() {
+		return nil, errors.New("key file is not a regular file")
+	} else if size := info.Size(); size != int64(keyLength(h)) {
+		return nil, fmt.Errorf("cipher key is %d bits, input was encrypted with a %d bit cipher key", size*8, keyLength(h)*8)
+	}
+	return readFromFile(kfile)
+}
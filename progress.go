@@ -0,0 +1,65 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/emil2k/go-aes/modes"
+)
+
+const progressWidth int = 30 // width of the progress bar in characters
+
+// progressBar renders the progress of an encryption or decryption on a single line, with the
+// throughput and the estimated time remaining.
+type progressBar struct {
+	w     io.Writer // usually standard error, so it does not mix with output to standard output
+	start time.Time // when the process started, to calculate the throughput
+}
+
+// newProgressBar creates a progress bar written to w, starting now.
+func newProgressBar(w io.Writer) *progressBar {
+	return &progressBar{w: w, start: time.Now()}
+}
+
+// update renders the progress over the previous line, ending the line once all blocks are output.
+func (b *progressBar) update(p modes.Progress) {
+	fmt.Fprint(b.w, "\r"+renderProgress(p, time.Since(b.start)))
+	if p.Blocks >= p.Total {
+		fmt.Fprintln(b.w)
+	}
+}
+
+// renderProgress formats the progress after the elapsed time as a bar followed by the percentage,
+// the throughput and the estimated time remaining.
+func renderProgress(p modes.Progress, elapsed time.Duration) string {
+	frac := 1.0
+	if p.Total > 0 && p.Blocks < p.Total {
+		frac = float64(p.Blocks) / float64(p.Total)
+	}
+	filled := int(frac * float64(progressWidth))
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", progressWidth-filled)
+	var rate float64 // bytes per second
+	if s := elapsed.Seconds(); s > 0 {
+		rate = float64(p.Bytes()) / s
+	}
+	eta := "?"
+	if frac == 1 {
+		eta = "0s"
+	} else if rate > 0 {
+		remain := float64((p.Total-p.Blocks)*modes.BlockSize) / rate
+		eta = (time.Duration(remain * float64(time.Second))).Round(time.Second).String()
+	}
+	return fmt.Sprintf("[%s] %5.1f%% %s/s ETA %s", bar, frac*100, formatBytes(rate), eta)
+}
+
+// formatBytes formats a number of bytes with a binary unit prefix.
+func formatBytes(n float64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	i := 0
+	for ; n >= 1024 && i < len(units)-1; i++ {
+		n /= 1024
+	}
+	return fmt.Sprintf("%.1f %s", n, units[i])
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/emil2k/go-aes/modes"
+)
+
+func TestRenderProgress(t *testing.T) {
+	p := modes.Progress{Blocks: 1 << 16, Total: 1 << 18, Buffers: 1} // 1 MiB of 4 MiB
+	expected := "[=======                       ]  25.0% 512.0 KiB/s ETA 6s"
+	if x := renderProgress(p, 2*time.Second); x != expected {
+		t.Errorf("Rendering progress failed with %q, expected %q", x, expected)
+	}
+	p.Blocks = p.Total
+	if x := renderProgress(p, 2*time.Second); !strings.HasPrefix(x, "[="+strings.Repeat("=", progressWidth-1)+"] 100.0%") || !strings.HasSuffix(x, "ETA 0s") {
+		t.Errorf("Rendering complete progress failed with %q", x)
+	}
+	if x := renderProgress(modes.Progress{Total: 10}, 0); !strings.HasSuffix(x, "0.0 B/s ETA ?") {
+		t.Errorf("Rendering progress without throughput failed with %q", x)
+	}
+}
+
+// TestProgressBar tests that the progress bar is rendered over the same line, ending it once complete.
+func TestProgressBar(t *testing.T) {
+	var buf bytes.Buffer
+	b := newProgressBar(&buf)
+	b.update(modes.Progress{Blocks: 1, Total: 2, Buffers: 1})
+	b.update(modes.Progress{Blocks: 2, Total: 2, Buffers: 2})
+	if x := buf.String(); strings.Count(x, "\r") != 2 || !strings.HasSuffix(x, "\n") || strings.Count(x, "\n") != 1 {
+		t.Errorf("Updating progress bar failed with %q", x)
+	}
+}
+
+func TestFormatBytes(t *testing.T) {
+	for n, expected := range map[float64]string{0: "0.0 B", 1023: "1023.0 B", 1536: "1.5 KiB", 3 << 30: "3.0 GiB"} {
+		if x := formatBytes(n); x != expected {
+			t.Errorf("Formatting %v bytes failed with %s, expected %s", n, x, expected)
+		}
+	}
+}
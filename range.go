@@ -0,0 +1,54 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/emil2k/go-aes/modes/ctr"
+)
+
+// parseRange parses a byte range of the plaintext of the form start:length, the length may be
+// omitted to decrypt to the end of the plaintext.
+func parseRange(s string) (start uint64, length uint64, err error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid range %q, expected start:length", s)
+	}
+	if start, err = strconv.ParseUint(parts[0], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid range start %q", parts[0])
+	}
+	if parts[1] == "" {
+		return start, math.MaxUint64, nil
+	}
+	if length, err = strconv.ParseUint(parts[1], 10, 64); err != nil {
+		return 0, 0, fmt.Errorf("invalid range length %q", parts[1])
+	}
+	return start, length, nil
+}
+
+// checkRange parses the byte range and checks that it can be decrypted from the input, which must
+// be a file encrypted with counter mode.
+func checkRange(h *header) (start uint64, length uint64, err error) {
+	if h.mode != ctrMode {
+		name, _ := modeName(h.mode)
+		return 0, 0, fmt.Errorf("decrypting a range requires counter mode, the input was encrypted with %s mode", name)
+	} else if args.input == stdPath {
+		return 0, 0, errors.New("decrypting a range requires an input file, not standard input")
+	}
+	return parseRange(args.byteRange)
+}
+
+// decryptRange decrypts the byte range of the plaintext from the cipher text of size bytes
+// following the header in the input file, writing it to the output.
+func decryptRange(c *ctr.Counter, ifile *os.File, ofile *os.File, h *header, size uint64, ck []byte, start uint64, length uint64) error {
+	b, err := c.DecryptRange(h.size(), size, ifile, ck, h.nonce, start, length)
+	if err != nil {
+		return err
+	}
+	verboseLog.Println("decrypted", len(b), "bytes from byte", start)
+	return writeToFile(ofile, b...)
+}
@@ -0,0 +1,177 @@
+package state
+
+const NBitslicedStates int = 4 // number of states processed in parallel when bitsliced
+
+// Bitsliced holds NBitslicedStates states transposed into 8 bit planes, the ith plane holding
+// the ith bit of every byte. Bit k*16+j of a plane belongs to the jth byte of the kth state,
+// so each state occupies a 16 bit lane and each column a 4 bit group within the lane.
+// All operations use only boolean operations and fixed shifts, so they run in constant time
+// without any data dependent memory accesses.
+type Bitsliced [8]uint64
+
+const (
+	lanes   uint64 = 0x0001000100010001 // repeats a 16 bit pattern over every lane
+	nibbles uint64 = 0x1111111111111111 // repeats a 4 bit pattern over every column
+)
+
+// NewBitsliced returns the passed states transposed into bit planes.
+// Passed slice may contain at most NBitslicedStates states, missing states are zero.
+func NewBitsliced(in []State) Bitsliced {
+	var b Bitsliced
+	for k, s := range in {
+		bs := s.GetBytes()
+		for j := uint(0); j < 16; j++ {
+			for i := uint(0); i < 8; i++ {
+				b[i] |= uint64(bs[j]>>i&1) << (uint(k)*16 + j)
+			}
+		}
+	}
+	return b
+}
+
+// States transposes the bit planes back into states, filling the passed slice.
+// Passed slice may contain at most NBitslicedStates states.
+func (b *Bitsliced) States(out []State) {
+	for k := range out {
+		bs := make([]byte, 16)
+		for j := uint(0); j < 16; j++ {
+			for i := uint(0); i < 8; i++ {
+				bs[j] |= byte(b[i]>>(uint(k)*16+j)&1) << i
+			}
+		}
+		out[k] = *NewStateFromBytes(bs)
+	}
+}
+
+// Xor xors the input bit planes with the bit planes.
+func (b *Bitsliced) Xor(input Bitsliced) {
+	for i := range b {
+		b[i] ^= input[i]
+	}
+}
+
+// gfMul multiplies every byte of the bit planes in the Rijndael field, reducing by x^8+x^4+x^3+x+1.
+func gfMul(x, y Bitsliced) Bitsliced {
+	var t [15]uint64
+	for i := 0; i < 8; i++ {
+		for j := 0; j < 8; j++ {
+			t[i+j] ^= x[i] & y[j]
+		}
+	}
+	for i := 14; i >= 8; i-- {
+		t[i-4] ^= t[i]
+		t[i-5] ^= t[i]
+		t[i-7] ^= t[i]
+		t[i-8] ^= t[i]
+	}
+	var out Bitsliced
+	copy(out[:], t[:8])
+	return out
+}
+
+// gfInv inverts every byte of the bit planes in the Rijndael field, by raising to the power 254.
+// Zero maps to zero.
+func gfInv(x Bitsliced) Bitsliced {
+	x2 := gfMul(x, x)
+	x3 := gfMul(x2, x)
+	x6 := gfMul(x3, x3)
+	x12 := gfMul(x6, x6)
+	x15 := gfMul(x12, x3)
+	x30 := gfMul(x15, x15)
+	x60 := gfMul(x30, x30)
+	x120 := gfMul(x60, x60)
+	x240 := gfMul(x120, x120)
+	x252 := gfMul(x240, x12)
+	return gfMul(x252, x2)
+}
+
+// affine applies the affine transformation of the s-box to every byte, xoring the constant c.
+// Each output bit is the xor of the input bits at the passed offsets, modulo 8.
+func affine(x Bitsliced, c byte, offsets ...int) Bitsliced {
+	var out Bitsliced
+	for i := range out {
+		for _, o := range offsets {
+			out[i] ^= x[(i+o)%8]
+		}
+		out[i] ^= -uint64(c >> uint(i) & 1) // all ones if the constant bit is set
+	}
+	return out
+}
+
+// Sub substitutes all the bytes through the forward s-box, computed as an inversion followed by
+// the affine transformation.
+func (b *Bitsliced) Sub() {
+	*b = affine(gfInv(*b), 0x63, 0, 4, 5, 6, 7)
+}
+
+// InvSub substitutes all the bytes through the inverse s-box, computed as the inverse affine
+// transformation followed by an inversion.
+func (b *Bitsliced) InvSub() {
+	*b = gfInv(affine(*b, 0x05, 2, 5, 7))
+}
+
+// rotLanes rotates the bits within each 16 bit lane, moving bit j of a lane to bit j-n.
+func rotLanes(w uint64, n uint) uint64 {
+	return w>>n&(lanes*(0xFFFF>>n)) | w<<(16-n)&(lanes*(0xFFFF<<(16-n)&0xFFFF))
+}
+
+// rotCols rotates the bits within each column, moving row r of a column to row r-n.
+func rotCols(w uint64, n uint) uint64 {
+	return w>>n&(nibbles*(0xF>>n)) | w<<(4-n)&(nibbles*(0xF<<(4-n)&0xF))
+}
+
+// shiftPlanes rotates the last 3 rows of every state, rotating row r by n(r) columns.
+func (b *Bitsliced) shiftPlanes(n func(r uint) uint) {
+	for i, w := range b {
+		out := w & (nibbles * 0x1) // row 0 is not shifted
+		for r := uint(1); r < 4; r++ {
+			out |= rotLanes(w&(nibbles*(0x1<<r)), 4*n(r))
+		}
+		b[i] = out
+	}
+}
+
+// Shift rotates the bytes in the last 3 rows of every state, same as State.Shift.
+func (b *Bitsliced) Shift() {
+	b.shiftPlanes(func(r uint) uint { return r })
+}
+
+// InvShift rotates the bytes in the last 3 rows of every state, inverse of Shift.
+func (b *Bitsliced) InvShift() {
+	b.shiftPlanes(func(r uint) uint { return 4 - r })
+}
+
+// xtime multiplies every byte of the bit planes by {02} in the Rijndael field.
+func xtime(x Bitsliced) Bitsliced {
+	return Bitsliced{x[7], x[0] ^ x[7], x[1], x[2] ^ x[7], x[3] ^ x[7], x[4], x[5], x[6]}
+}
+
+// rotPlanes rotates the rows of every column of the bit planes by n.
+func rotPlanes(x Bitsliced, n uint) Bitsliced {
+	for i := range x {
+		x[i] = rotCols(x[i], n)
+	}
+	return x
+}
+
+// Mix mixes all the columns of every state, same as State.Mix.
+// Each byte becomes {02}(a0 ^ a1) ^ a1 ^ a2 ^ a3, where a0 is the byte and the rest follow it in the column.
+func (b *Bitsliced) Mix() {
+	r1, r2, r3 := rotPlanes(*b, 1), rotPlanes(*b, 2), rotPlanes(*b, 3)
+	t := *b
+	t.Xor(r1)
+	t = xtime(t)
+	t.Xor(r1)
+	t.Xor(r2)
+	t.Xor(r3)
+	*b = t
+}
+
+// InvMix reverses the mixing of all the columns of every state, same as State.InvMix.
+// Multiplying by {04}x^2 + {05} before mixing is equivalent to the inverse mix.
+func (b *Bitsliced) InvMix() {
+	t := *b
+	t.Xor(rotPlanes(*b, 2))
+	b.Xor(xtime(xtime(t)))
+	b.Mix()
+}
@@ -0,0 +1,119 @@
+package state
+
+import (
+	"testing"
+)
+
+// randStates returns NBitslicedStates states with random contents.
+func randStates() []State {
+	out := make([]State, NBitslicedStates)
+	for i := range out {
+		out[i] = randState()
+	}
+	return out
+}
+
+// testBitsliced checks that a bitsliced operation matches the operation on each state.
+func testBitsliced(t *testing.T, name string, op func(b *Bitsliced), stateOp func(s *State)) {
+	for i := 0; i < 20; i++ {
+		in := randStates()
+		b := NewBitsliced(in)
+		op(&b)
+		out := make([]State, len(in))
+		b.States(out)
+		for k := range in {
+			expected := in[k]
+			stateOp(&expected)
+			if out[k] != expected {
+				t.Errorf("Bitsliced %s failed on state %d with %s, expected %s", name, k, out[k], expected)
+			}
+		}
+	}
+}
+
+func TestNewBitsliced(t *testing.T) {
+	s := State{High: 0, Low: 0x0301} // first byte 0x01, second byte 0x03
+	b := NewBitsliced([]State{{}, s})
+	if b[0] != 0x3<<16 || b[1] != 0x2<<16 {
+		t.Errorf("New bitsliced failed with %x", b)
+	}
+	for i := 2; i < 8; i++ {
+		if b[i] != 0 {
+			t.Errorf("New bitsliced failed with %x", b)
+		}
+	}
+}
+
+func TestBitslicedStates(t *testing.T) {
+	testBitsliced(t, "transpose", func(b *Bitsliced) {}, func(s *State) {})
+}
+
+func TestBitslicedPartial(t *testing.T) {
+	in := randStates()[:1]
+	b := NewBitsliced(in)
+	out := make([]State, NBitslicedStates)
+	b.States(out)
+	if out[0] != in[0] {
+		t.Errorf("Bitsliced partial failed with %s, expected %s", out[0], in[0])
+	}
+	for _, s := range out[1:] {
+		if s != (State{}) {
+			t.Errorf("Bitsliced partial missing states should be zero, not %s", s)
+		}
+	}
+}
+
+func TestBitslicedXor(t *testing.T) {
+	rk := randState()
+	testBitsliced(t, "xor", func(b *Bitsliced) {
+		b.Xor(NewBitsliced([]State{rk, rk, rk, rk}))
+	}, func(s *State) {
+		s.Xor(rk)
+	})
+}
+
+func TestBitslicedSub(t *testing.T) {
+	testBitsliced(t, "sub", (*Bitsliced).Sub, (*State).Sub)
+}
+
+func TestBitslicedInvSub(t *testing.T) {
+	testBitsliced(t, "inverse sub", (*Bitsliced).InvSub, (*State).InvSub)
+}
+
+// TestBitslicedSubAll tests the bitsliced s-box against every byte value.
+func TestBitslicedSubAll(t *testing.T) {
+	for i := 0; i < 256; i += 64 {
+		in := make([]byte, 64)
+		for j := range in {
+			in[j] = byte(i + j)
+		}
+		states := []State{*NewStateFromBytes(in[0:]), *NewStateFromBytes(in[16:]), *NewStateFromBytes(in[32:]), *NewStateFromBytes(in[48:])}
+		b := NewBitsliced(states)
+		b.Sub()
+		out := make([]State, NBitslicedStates)
+		b.States(out)
+		for k := range out {
+			for j, x := range out[k].GetBytes() {
+				if v := in[k*16+j]; x != sbox[v] {
+					t.Errorf("Bitsliced sub failed for %02x with %02x, expected %02x", v, x, sbox[v])
+				}
+			}
+		}
+	}
+}
+
+func TestBitslicedShift(t *testing.T) {
+	testBitsliced(t, "shift", (*Bitsliced).Shift, (*State).Shift)
+}
+
+func TestBitslicedInvShift(t *testing.T) {
+	testBitsliced(t, "inverse shift", (*Bitsliced).InvShift, (*State).InvShift)
+}
+
+func TestBitslicedMix(t *testing.T) {
+	testBitsliced(t, "mix", (*Bitsliced).Mix, (*State).Mix)
+}
+
+func TestBitslicedInvMix(t *testing.T) {
+	testBitsliced(t, "inverse mix", (*Bitsliced).InvMix, (*State).InvMix)
+}
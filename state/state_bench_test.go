@@ -112,3 +112,41 @@ func BenchmarkSetRow(b *testing.B) {
 		newState().SetRow(1, 0x01020304)
 	}
 }
+
+func BenchmarkRound(b *testing.B) {
+	rk := *newState()
+	for i := 0; i < b.N; i++ {
+		newState().Round(rk)
+	}
+}
+
+func BenchmarkInvRound(b *testing.B) {
+	rk := *newState()
+	for i := 0; i < b.N; i++ {
+		newState().InvRound(rk)
+	}
+}
+
+func BenchmarkBitslicedSub(b *testing.B) {
+	bs := NewBitsliced([]State{*newState(), *newState(), *newState(), *newState()})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bs.Sub()
+	}
+}
+
+func BenchmarkBitslicedMix(b *testing.B) {
+	bs := NewBitsliced([]State{*newState(), *newState(), *newState(), *newState()})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		bs.Mix()
+	}
+}
+
+func BenchmarkNewBitsliced(b *testing.B) {
+	in := []State{*newState(), *newState(), *newState(), *newState()}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		NewBitsliced(in)
+	}
+}
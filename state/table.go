@@ -0,0 +1,83 @@
+package state
+
+import (
+	rj "github.com/emil2k/go-math/rijndael"
+)
+
+// Precomputed round tables, each entry is the column produced by a single substituted byte
+// once mixed. The tables for rows 1, 2, and 3 are the row 0 table rotated by 1, 2, and 3 bytes.
+var te0, te1, te2, te3 [256]uint32 // forward round tables
+var td0, td1, td2, td3 [256]uint32 // inverse round tables
+var sbox, invSbox [256]byte        // precomputed forward and inverse s-boxes
+
+// init precomputes the s-boxes and the round tables.
+func init() {
+	rot := func(col uint32) uint32 {
+		return col<<8 | col>>24
+	}
+	for i := 0; i < 256; i++ {
+		s, is := rj.Sbox(byte(i)), rj.InvSbox(byte(i))
+		sbox[i], invSbox[i] = s, is
+		te0[i] = uint32(rj.Mul(0x02, s)) + uint32(s)<<8 + uint32(s)<<16 + uint32(rj.Mul(0x03, s))<<24
+		td0[i] = uint32(rj.Mul(0x0e, is)) + uint32(rj.Mul(0x09, is))<<8 + uint32(rj.Mul(0x0d, is))<<16 + uint32(rj.Mul(0x0b, is))<<24
+		te1[i], td1[i] = rot(te0[i]), rot(td0[i])
+		te2[i], td2[i] = rot(te1[i]), rot(td1[i])
+		te3[i], td3[i] = rot(te2[i]), rot(td2[i])
+	}
+}
+
+// cols returns the columns of the state.
+func (s *State) cols() (c0, c1, c2, c3 uint32) {
+	return uint32(s.Low), uint32(s.Low >> 32), uint32(s.High), uint32(s.High >> 32)
+}
+
+// setCols sets the columns of the state.
+func (s *State) setCols(c0, c1, c2, c3 uint32) {
+	s.Low = uint64(c0) + uint64(c1)<<32
+	s.High = uint64(c2) + uint64(c3)<<32
+}
+
+// Round runs a full round of encryption through the round tables, equivalent to Sub, Shift, Mix,
+// and then xoring the round key.
+func (s *State) Round(rk State) {
+	c0, c1, c2, c3 := s.cols()
+	s.setCols(
+		te0[byte(c0)]^te1[byte(c1>>8)]^te2[byte(c2>>16)]^te3[byte(c3>>24)],
+		te0[byte(c1)]^te1[byte(c2>>8)]^te2[byte(c3>>16)]^te3[byte(c0>>24)],
+		te0[byte(c2)]^te1[byte(c3>>8)]^te2[byte(c0>>16)]^te3[byte(c1>>24)],
+		te0[byte(c3)]^te1[byte(c0>>8)]^te2[byte(c1>>16)]^te3[byte(c2>>24)])
+	s.Xor(rk)
+}
+
+// FinalRound runs the last round of encryption, equivalent to Sub, Shift, and then xoring the round key.
+func (s *State) FinalRound(rk State) {
+	c0, c1, c2, c3 := s.cols()
+	col := func(a, b, c, d uint32) uint32 {
+		return uint32(sbox[byte(a)]) + uint32(sbox[byte(b>>8)])<<8 + uint32(sbox[byte(c>>16)])<<16 + uint32(sbox[byte(d>>24)])<<24
+	}
+	s.setCols(col(c0, c1, c2, c3), col(c1, c2, c3, c0), col(c2, c3, c0, c1), col(c3, c0, c1, c2))
+	s.Xor(rk)
+}
+
+// InvRound runs a full round of the equivalent inverse cipher through the round tables, equivalent
+// to InvSub, InvShift, InvMix, and then xoring the round key.
+func (s *State) InvRound(rk State) {
+	c0, c1, c2, c3 := s.cols()
+	s.setCols(
+		td0[byte(c0)]^td1[byte(c3>>8)]^td2[byte(c2>>16)]^td3[byte(c1>>24)],
+		td0[byte(c1)]^td1[byte(c0>>8)]^td2[byte(c3>>16)]^td3[byte(c2>>24)],
+		td0[byte(c2)]^td1[byte(c1>>8)]^td2[byte(c0>>16)]^td3[byte(c3>>24)],
+		td0[byte(c3)]^td1[byte(c2>>8)]^td2[byte(c1>>16)]^td3[byte(c0>>24)])
+	s.Xor(rk)
+}
+
+// InvFinalRound runs the last round of the equivalent inverse cipher, equivalent to InvSub, InvShift,
+// and then xoring the round key.
+func (s *State) InvFinalRound(rk State) {
+	c0, c1, c2, c3 := s.cols()
+	col := func(a, b, c, d uint32) uint32 {
+		return uint32(invSbox[byte(a)]) + uint32(invSbox[byte(b>>8)])<<8 + uint32(invSbox[byte(c>>16)])<<16 + uint32(invSbox[byte(d>>24)])<<24
+	}
+	s.setCols(col(c0, c3, c2, c1), col(c1, c0, c3, c2), col(c2, c1, c0, c3), col(c3, c2, c1, c0))
+	s.Xor(rk)
+}
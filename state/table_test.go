@@ -0,0 +1,66 @@
+package state
+
+import (
+	"testing"
+
+	"github.com/emil2k/go-aes/util/rand"
+)
+
+// randState returns a state with random contents.
+func randState() State {
+	return *NewStateFromBytes(rand.GetRand(16))
+}
+
+func TestRound(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		s, rk := randState(), randState()
+		expected := s
+		expected.Sub()
+		expected.Shift()
+		expected.Mix()
+		expected.Xor(rk)
+		if s.Round(rk); s != expected {
+			t.Errorf("Round failed with %s, expected %s", s, expected)
+		}
+	}
+}
+
+func TestFinalRound(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		s, rk := randState(), randState()
+		expected := s
+		expected.Sub()
+		expected.Shift()
+		expected.Xor(rk)
+		if s.FinalRound(rk); s != expected {
+			t.Errorf("Final round failed with %s, expected %s", s, expected)
+		}
+	}
+}
+
+func TestInvRound(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		s, rk := randState(), randState()
+		expected := s
+		expected.InvSub()
+		expected.InvShift()
+		expected.InvMix()
+		expected.Xor(rk)
+		if s.InvRound(rk); s != expected {
+			t.Errorf("Inverse round failed with %s, expected %s", s, expected)
+		}
+	}
+}
+
+func TestInvFinalRound(t *testing.T) {
+	for i := 0; i < 100; i++ {
+		s, rk := randState(), randState()
+		expected := s
+		expected.InvSub()
+		expected.InvShift()
+		expected.Xor(rk)
+		if s.InvFinalRound(rk); s != expected {
+			t.Errorf("Inverse final round failed with %s, expected %s", s, expected)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/modes"
+	"github.com/emil2k/go-aes/modes/cbc"
+	"github.com/emil2k/go-aes/modes/ctr"
+	mbytes "github.com/emil2k/go-aes/util/bytes"
+)
+
+const stdPath string = "-" // path standing for standard input or standard output
+
+// streamWriterFactory creates a writer encrypting everything written to it.
+type streamWriterFactory func(w io.Writer, cf cipher.CipherFactory, ck []byte, nonce []byte) (*modes.StreamWriter, error)
+
+// streamReaderFactory creates a reader decrypting everything read from it.
+type streamReaderFactory func(r io.Reader, cf cipher.CipherFactory, ck []byte, nonce []byte) (*modes.StreamReader, error)
+
+// isStream returns whether the input or output is standard input or output, which can not be seeked
+// and has no known size so must be processed as a stream.
+func isStream() bool {
+	return args.input == stdPath || args.output == stdPath
+}
+
+// openInput opens the input file, or returns standard input for the "-" path.
+func openInput(name string) (*os.File, error) {
+	if name == stdPath {
+		return os.Stdin, nil
+	}
+	return openFile(name)
+}
+
+// createOutput creates the output file, or returns standard output for the "-" path.
+func createOutput(name string) (*os.File, error) {
+	if name == stdPath {
+		return os.Stdout, nil
+	}
+	return createFile(name)
+}
+
+// getStreams returns the constructors of the encrypting writer and decrypting reader of the mode
+// identifier, nil if the mode can not be streamed.
+func getStreams(id byte) (streamWriterFactory, streamReaderFactory) {
+	switch id {
+	case ctrMode:
+		return ctr.NewEncryptingWriter, ctr.NewDecryptingReader
+	case cbcMode:
+		return cbc.NewEncryptingWriter, cbc.NewDecryptingReader
+	default:
+		return nil, nil
+	}
+}
+
+// encryptStream encrypts the input stream to the output stream.
+// Modes that can not be streamed encrypt the whole input buffered in memory.
+func encryptStream(id byte, mode modes.ModeInterface, cf cipher.CipherFactory, in io.Reader, out io.Writer, ck []byte, nonce []byte) error {
+	newWriter, _ := getStreams(id)
+	if newWriter == nil {
+		verboseLog.Println("mode can not be streamed, buffering input")
+		return bufferMode(mode.Encrypt, in, out, ck, nonce)
+	}
+	w, err := newWriter(out, cf, ck, nonce)
+	if err != nil {
+		return err
+	}
+	w.SetPadding(mode.Padding())
+	if _, err := io.Copy(w, in); err != nil {
+		return err
+	}
+	return w.Close()
+}
+
+// decryptStream decrypts the input stream to the output stream.
+// Modes that can not be streamed decrypt the whole input buffered in memory, so authenticated modes
+// verify the input before writing any output.
+func decryptStream(id byte, mode modes.ModeInterface, cf cipher.CipherFactory, in io.Reader, out io.Writer, ck []byte, nonce []byte) error {
+	_, newReader := getStreams(id)
+	if newReader == nil {
+		verboseLog.Println("mode can not be streamed, buffering input")
+		return bufferMode(mode.Decrypt, in, out, ck, nonce)
+	}
+	r, err := newReader(in, cf, ck, nonce)
+	if err != nil {
+		return err
+	}
+	r.SetPadding(mode.Padding())
+	_, err = io.Copy(out, r)
+	return err
+}
+
+// bufferMode reads the whole input into memory, runs the encryption or decryption of a mode on it,
+// then writes the output. The input and output are both held in memory, so the memory used is about
+// twice the size of the input.
+func bufferMode(run func(offset uint64, size uint64, in io.ReadSeeker, out io.WriteSeeker, ck []byte, nonce []byte) error,
+	in io.Reader, out io.Writer, ck []byte, nonce []byte) error {
+	data, err := ioutil.ReadAll(in)
+	if err != nil {
+		return err
+	}
+	buf := mbytes.NewReadWriteSeeker(make([]byte, 0, len(data)))
+	if err := run(0, uint64(len(data)), bytes.NewReader(data), buf, ck, nonce); err != nil {
+		return err
+	}
+	_, err = out.Write(buf.Bytes())
+	return err
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"io/ioutil"
+
+	"github.com/emil2k/go-aes/cipher"
+	"github.com/emil2k/go-aes/keywrap"
+)
+
+// Subcommands for wrapping key files under a key encryption key.
+const (
+	wrapCommand   string = "wrap"   // wraps the input key file
+	unwrapCommand string = "unwrap" // unwraps the input wrapped key
+)
+
+// wrapKeyFile executes the wrap subcommand, wrapping the input key file with AES key wrap under
+// the key encryption key and storing the wrapped key.
+func wrapKeyFile() error {
+	return runKeyWrap(keywrap.Wrap, "wrapped key stored in")
+}
+
+// unwrapKeyFile executes the unwrap subcommand, unwrapping the input wrapped key with the key
+// encryption key and storing the key file. Returns keywrap.ErrIntegrity if the wrapped key was
+// modified or the key encryption key is wrong.
+func unwrapKeyFile() error {
+	return runKeyWrap(keywrap.Unwrap, "unwrapped key stored in")
+}
+
+// runKeyWrap reads the key encryption key and the input, runs the wrapping or unwrapping, then
+// writes the result to the output.
+func runKeyWrap(run func(cf cipher.CipherFactory, kek []byte, in []byte) ([]byte, error), done string) error {
+	kek, err := readKey()
+	if err != nil {
+		return err
+	}
+	cf, err := getCipherFactory()
+	if err != nil {
+		return err
+	}
+	ifile, err := openInput(args.input)
+	if err != nil {
+		return err
+	}
+	defer closeFile(ifile)
+	in, err := ioutil.ReadAll(ifile)
+	if err != nil {
+		return err
+	}
+	out, err := run(cf, kek, in)
+	if err != nil {
+		return err
+	}
+	ofile, err := createOutput(args.output)
+	if err != nil {
+		return err
+	}
+	defer closeFile(ofile)
+	if err := writeToFile(ofile, out...); err != nil {
+		return err
+	}
+	standardLog.Println(done, ofile.Name())
+	return nil
+}